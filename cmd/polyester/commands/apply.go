@@ -1,50 +1,81 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/jeffrom/polyester/planner"
 	"github.com/jeffrom/polyester/planner/execute"
+	"github.com/jeffrom/polyester/planner/format"
+	"github.com/jeffrom/polyester/stdio"
 )
 
 func newApplyCmd() *cobra.Command {
 	opts := planner.ApplyOpts{}
+	var output string
 	cmd := &cobra.Command{
 		Use:   "apply [plan...]",
 		Short: "read, check, and execute plans",
+		Long: `Reads, checks, and executes plans.
+
+Exits with status 0 if every plan completed, 1 if no plans completed, and 2 if
+some plans failed while others completed, which can happen with --keep-going.
+
+With --dry-run, the summary is followed by why each operation would run and a
+diff of the files it would write, as with "polyester diff".
+
+Progress is printed as a line per operation by default. --output table prints a
+row per operation, with the output of operations that fail, and --output tty
+shows a live line per plan, followed by the output of plans that failed. With
+--output json, progress is written to stdout as JSON lines, one event per line,
+and all other output is written to stderr.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
+			fm, err := setupOutput(stdio.FromContext(ctx), output)
+			if err != nil {
+				return err
+			}
+			opts.Formatter = fm
+			if opts.CompiledPlan != "" && len(args) > 1 {
+				return errors.New("apply: only one manifest directory can be used with --plan-file")
+			}
 			dirs := []string{""}
 			if len(args) > 0 {
 				dirs = args
 			}
 			var results []*execute.Result
+			var applyErr error
 			for _, dir := range dirs {
-				pl, err := planner.New(dir)
-				if err != nil {
-					return err
-				}
-
-				if err := pl.Check(ctx); err != nil {
-					return err
-				}
-
-				res, err := pl.Apply(ctx, opts)
-				if err != nil {
-					return err
-				}
+				res, err := applyOne(ctx, dir, opts)
 				if res != nil {
 					results = append(results, res)
 				}
+				if err != nil {
+					applyErr = err
+					break
+				}
+			}
+			if err := fm.Close(); err != nil {
+				return err
+			}
+			if output == outputJSON {
+				return applyErr
 			}
 			for _, res := range results {
 				if err := res.TextSummary(os.Stdout); err != nil {
 					return err
 				}
+				if opts.Dryrun {
+					if err := res.WriteDiff(os.Stdout); err != nil {
+						return err
+					}
+				}
 			}
-			return nil
+			return applyErr
 		},
 	}
 
@@ -52,7 +83,48 @@ func newApplyCmd() *cobra.Command {
 	flags.BoolVarP(&opts.Dryrun, "dry-run", "n", false, "make no changes")
 	flags.StringVar(&opts.DirRoot, "dir-root", "/", "use as root directory")
 	flags.StringVar(&opts.StateDir, "state-dir", "/var/lib/polyester/state", "directory to track state")
-	flags.StringVarP(&opts.CompiledPlan, "plan-file", "f", "", "apply a pre-compiled plan")
+	flags.StringArrayVarP(&opts.IdentityPaths, "age-identity", "i", nil, "age identity `file`(s) to decrypt secrets with")
+	flags.BoolVarP(&opts.KeepGoing, "keep-going", "k", false, "keep running plans that don't depend on a failed plan")
+	flags.IntVarP(&opts.Concurrency, "concurrency", "j", 0, "maximum number of plans to evaluate or run at once (default: number of CPUs)")
+	addOutputFlag(cmd, &output)
+	flags.StringVarP(&opts.CompiledPlan, "plan-file", "f", "", "apply a manifest archive or compiled plan `file`")
 
 	return cmd
 }
+
+func applyOne(ctx context.Context, dir string, opts planner.ApplyOpts) (res *execute.Result, err error) {
+	start := time.Now()
+	opts.Formatter.Write(format.Event{Type: format.EventApplyStart, Dir: dir})
+	defer func() {
+		ev := format.Event{
+			Type:       format.EventApplyFinish,
+			Dir:        dir,
+			DurationMS: format.Milliseconds(time.Since(start)),
+		}
+		if res != nil {
+			ev.Changed = res.Changed()
+			ev.Status = res.Status().String()
+		}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		opts.Formatter.Write(ev)
+	}()
+
+	var pl *planner.Planner
+	if opts.CompiledPlan != "" {
+		pl, err = planner.NewFromPlanFile(opts.CompiledPlan, dir)
+	} else {
+		pl, err = planner.New(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer pl.Close()
+	pl.Concurrency = opts.Concurrency
+
+	if err := pl.Check(ctx); err != nil {
+		return nil, err
+	}
+	return pl.Apply(ctx, opts)
+}
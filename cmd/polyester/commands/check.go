@@ -1,35 +1,87 @@
 package commands
 
 import (
+	"context"
+	"errors"
+
 	"github.com/spf13/cobra"
 
+	"github.com/jeffrom/polyester/compiler"
 	"github.com/jeffrom/polyester/planner"
+	"github.com/jeffrom/polyester/planner/format"
+	"github.com/jeffrom/polyester/stdio"
 )
 
 func newCheckCmd() *cobra.Command {
+	var output string
+	var concurrency int
 	cmd := &cobra.Command{
 		Use:   "check [plan...]",
 		Short: "check plans for validation errors",
+		Long: `Checks plans for validation errors.
+
+Every error found is reported, each on its own line, prefixed with the
+file:line:col of the plan script that caused it when it is known.
+
+With --output json, a check event is written to stdout as a JSON line for each
+plan, and all other output is written to stderr. Validation errors are also
+listed in the event's errors field.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
+			fm, err := setupOutput(stdio.FromContext(ctx), output)
+			if err != nil {
+				return err
+			}
 			dirs := []string{""}
 			if len(args) > 0 {
 				dirs = args
 			}
 			for _, dir := range dirs {
-				pl, err := planner.New(dir)
+				err := checkOne(ctx, dir, concurrency)
+				ev := format.Event{Type: format.EventCheck, Dir: dir}
 				if err != nil {
-					return err
+					ev.Error = err.Error()
+					ev.Errors = checkErrors(err)
 				}
-
-				if err := pl.Check(ctx); err != nil {
+				fm.Write(ev)
+				if err != nil {
 					return err
 				}
 			}
-			return nil
+			return fm.Close()
 		},
 	}
 
-	// flags := cmd.Flags()
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "j", 0, "maximum number of plan scripts to evaluate at once (default: number of CPUs)")
+	addOutputFlag(cmd, &output)
 	return cmd
 }
+
+func checkOne(ctx context.Context, dir string, concurrency int) error {
+	pl, err := planner.New(dir)
+	if err != nil {
+		return err
+	}
+	pl.Concurrency = concurrency
+	return pl.Check(ctx)
+}
+
+// checkErrors converts validation errors for a check event.
+func checkErrors(err error) []format.CheckError {
+	var verrs compiler.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil
+	}
+	res := make([]format.CheckError, len(verrs))
+	for i, verr := range verrs {
+		res[i] = format.CheckError{
+			File:      verr.File,
+			Line:      verr.Line,
+			Col:       verr.Col,
+			Plan:      verr.Plan,
+			Operation: verr.Operation,
+			Message:   verr.Err.Error(),
+		}
+	}
+	return res
+}
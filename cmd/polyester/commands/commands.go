@@ -40,6 +40,12 @@ func ExecArgs(ctx context.Context, args []string) error {
 
 	rootCmd.AddCommand(newCheckCmd())
 	rootCmd.AddCommand(newApplyCmd())
+	rootCmd.AddCommand(newDiffCmd())
+	rootCmd.AddCommand(newDriftCmd())
+	rootCmd.AddCommand(newPackCmd())
+	rootCmd.AddCommand(newCompileCmd())
+	rootCmd.AddCommand(newRunCmd())
+	rootCmd.AddCommand(newSecretCmd())
 
 	rootCmd.SetArgs(args)
 	return rootCmd.ExecuteContext(ctx)
@@ -60,6 +66,7 @@ type operatorCommandFunc func(op operator.Interface) *cobra.Command
 // file. These are the commands that are called in plan scripts.
 func operatorCommandForPlan(op operator.Interface) *cobra.Command {
 	info := op.Info()
+	compiler.AddNotifyFlag(info)
 	cmd := info.Data().Command
 
 	cobraCmd := cmd.Command
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/planner"
+)
+
+type compileOpts struct {
+	outFile     string
+	concurrency int
+}
+
+func newCompileCmd() *cobra.Command {
+	opts := compileOpts{}
+	cmd := &cobra.Command{
+		Use:   "compile [dir]",
+		Args:  cobra.MaximumNArgs(1),
+		Short: "writes the compiled plan",
+		Long: `Compiles the manifest in dir and writes the fully resolved plan, including
+subplans, dependencies, operation targets, and a checksum of the manifest.
+
+The compiled plan can be applied with polyester apply --plan-file, which skips
+evaluating plan scripts. The manifest must not change between compiling and
+applying.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := ""
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			pl, err := planner.New(dir)
+			if err != nil {
+				return err
+			}
+			pl.Concurrency = opts.concurrency
+			if err := pl.Check(cmd.Context()); err != nil {
+				return err
+			}
+
+			f, err := os.Create(opts.outFile)
+			if err != nil {
+				return err
+			}
+			if err := pl.Compile(cmd.Context(), f); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.outFile, "out-file", "plan.json", "`file` to write the compiled plan to")
+	flags.IntVarP(&opts.concurrency, "concurrency", "j", 0, "maximum number of plan scripts to evaluate at once (default: number of CPUs)")
+	return cmd
+}
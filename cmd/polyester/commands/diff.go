@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/planner"
+	"github.com/jeffrom/polyester/planner/format"
+	"github.com/jeffrom/polyester/stdio"
+)
+
+func newDiffCmd() *cobra.Command {
+	opts := planner.ApplyOpts{Diff: true}
+	cmd := &cobra.Command{
+		Use:   "diff [plan...]",
+		Short: "explain what apply would change",
+		Long: `Explains why each operation apply would run is dirty, without making changes.
+
+For each dirty operation, the state entries that changed since the last apply
+are listed, such as a file checksum, mode, modification time, or key. If the
+operation is only dirty because an earlier operation in the plan is dirty, that
+operation is named instead. Operations that write files, such as copy and
+template, are followed by a unified diff of each file they would change.
+
+The diff is written to stdout, and all other output is written to stderr.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			std := stdio.FromContext(ctx)
+			std.Out = std.Stderr()
+			fm := format.NewPlain(std.Stdout())
+			opts.Formatter = fm
+
+			if opts.CompiledPlan != "" && len(args) > 1 {
+				return errors.New("diff: only one manifest directory can be used with --plan-file")
+			}
+			dirs := []string{""}
+			if len(args) > 0 {
+				dirs = args
+			}
+			for _, dir := range dirs {
+				res, err := applyOne(ctx, dir, opts)
+				if err != nil {
+					return err
+				}
+				if err := res.WriteDiff(os.Stdout); err != nil {
+					return err
+				}
+			}
+			return fm.Close()
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.DirRoot, "dir-root", "/", "use as root directory")
+	flags.StringVar(&opts.StateDir, "state-dir", "/var/lib/polyester/state", "directory to track state")
+	flags.StringArrayVarP(&opts.IdentityPaths, "age-identity", "i", nil, "age identity `file`(s) to decrypt secrets with")
+	flags.StringVarP(&opts.CompiledPlan, "plan-file", "f", "", "diff a manifest archive or compiled plan `file`")
+
+	return cmd
+}
@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/planner"
+	"github.com/jeffrom/polyester/planner/format"
+	"github.com/jeffrom/polyester/stdio"
+)
+
+func newDriftCmd() *cobra.Command {
+	opts := planner.ApplyOpts{Drift: true}
+	cmd := &cobra.Command{
+		Use:   "drift [plan...]",
+		Short: "report files changed since the last apply",
+		Long: `Reports files that changed since they were last applied, without making changes.
+
+Files written by operations such as template and copy are compared with their
+state after the last apply, so a destination that was edited by hand is
+reported even when the template and its data haven't changed. Each drifted file
+is followed by a unified diff from its desired contents to its contents on
+disk, with secret values masked.
+
+The report is written to stdout, and all other output is written to stderr.
+Exits with status 1 if any file drifted.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			std := stdio.FromContext(ctx)
+			std.Out = std.Stderr()
+			fm := format.NewPlain(std.Stdout())
+			opts.Formatter = fm
+
+			if opts.CompiledPlan != "" && len(args) > 1 {
+				return errors.New("drift: only one manifest directory can be used with --plan-file")
+			}
+			dirs := []string{""}
+			if len(args) > 0 {
+				dirs = args
+			}
+			drifted := 0
+			for _, dir := range dirs {
+				res, err := applyOne(ctx, dir, opts)
+				if err != nil {
+					return err
+				}
+				if err := res.WriteDrift(os.Stdout); err != nil {
+					return err
+				}
+				drifted += res.Drifted()
+			}
+			if err := fm.Close(); err != nil {
+				return err
+			}
+			if drifted > 0 {
+				return fmt.Errorf("drift: %d file(s) changed since the last apply", drifted)
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.DirRoot, "dir-root", "/", "use as root directory")
+	flags.StringVar(&opts.StateDir, "state-dir", "/var/lib/polyester/state", "directory to track state")
+	flags.StringArrayVarP(&opts.IdentityPaths, "age-identity", "i", nil, "age identity `file`(s) to decrypt secrets with")
+	flags.StringVarP(&opts.CompiledPlan, "plan-file", "f", "", "check a manifest archive or compiled plan `file` for drift")
+
+	return cmd
+}
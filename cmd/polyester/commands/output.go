@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/planner/format"
+	"github.com/jeffrom/polyester/stdio"
+)
+
+const (
+	outputText  = "text"
+	outputTable = "table"
+	outputTTY   = "tty"
+	outputJSON  = "json"
+)
+
+func addOutputFlag(cmd *cobra.Command, output *string) {
+	cmd.Flags().StringVarP(output, "output", "o", outputText, "output `format` (text, table, tty, json)")
+}
+
+// setupOutput returns the formatter for the output format. For JSON output,
+// events are written to stdout, so all other output is redirected to stderr.
+func setupOutput(std *stdio.StdIO, output string) (format.Formatter, error) {
+	switch output {
+	case outputText:
+		return format.NewPlain(std.Stdout()), nil
+	case outputTable:
+		return format.NewTable(std.Stdout()), nil
+	case outputTTY:
+		return format.NewTTY(std.Stdout()), nil
+	case outputJSON:
+		events := format.NewJSONWriter(std.Stdout())
+		std.Out = std.Stderr()
+		return events, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", output)
+}
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/manifest"
+	"github.com/jeffrom/polyester/stdio"
+)
+
+type packOpts struct {
+	outDir  string
+	name    string
+	version string
+}
+
+func newPackCmd() *cobra.Command {
+	opts := packOpts{}
+	cmd := &cobra.Command{
+		Use:   "pack [dir]",
+		Args:  cobra.MaximumNArgs(1),
+		Short: "writes a manifest archive",
+		Long: `Writes a versioned, gzipped archive of the manifest in dir.
+
+The archive name and version are read from polyester.yaml in the manifest
+directory, and can be overridden with --name and --version. The name defaults
+to the name of the manifest directory. Archives can be applied with
+polyester apply --plan-file.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			std := stdio.FromContext(cmd.Context())
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			m, err := manifest.LoadDir(dir)
+			if err != nil {
+				return err
+			}
+
+			meta := &manifest.Metadata{}
+			if m.Metadata != nil {
+				meta = m.Metadata
+			}
+			if opts.name != "" {
+				meta.Name = opts.name
+			}
+			if opts.version != "" {
+				meta.Version = opts.version
+			}
+			if meta.Name == "" {
+				abs, err := filepath.Abs(dir)
+				if err != nil {
+					return err
+				}
+				meta.Name = filepath.Base(abs)
+			}
+			m.Metadata = meta
+
+			p, err := manifest.Save(m, opts.outDir)
+			if err != nil {
+				return err
+			}
+			std.Println(p)
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.outDir, "out-dir", ".", "`dir` to write the archive to")
+	flags.StringVar(&opts.name, "name", "", "manifest `name` (default: polyester.yaml name, or the directory name)")
+	flags.StringVar(&opts.version, "version", "", "manifest `version` (default: polyester.yaml version)")
+	return cmd
+}
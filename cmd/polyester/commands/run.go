@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator/templates"
+	"github.com/jeffrom/polyester/stdio"
+)
+
+// ExitError is returned when a child process run by polyester exits with a
+// non-zero status, so polyester can exit with the same status.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string { return fmt.Sprintf("exit status %d", e.Code) }
+
+// ExitCode returns the exit status of the child process.
+func (e *ExitError) ExitCode() int { return e.Code }
+
+type runOpts struct {
+	dir           string
+	plan          string
+	identityPaths []string
+	envSecrets    []string
+}
+
+var envNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func newRunCmd() *cobra.Command {
+	opts := runOpts{}
+	cmd := &cobra.Command{
+		Use:   "run [flags] -- command [args...]",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "run a command with secrets in its environment",
+		Long: `Runs command with age-encrypted secrets from a manifest set as environment
+variables.
+
+Each --env-secret NAME=secret decrypts secret, its path under secrets/ without
+the .age extension, and sets it as $NAME, without a trailing newline. With
+--plan, the plan's secrets override the manifest's, as they do for templates.
+Identities are read from ~/.config/polyester/age and any passed with
+--age-identity.
+
+Secrets are only held in memory and passed to the command through its
+environment, and are never written to disk. Signals received by polyester are
+forwarded to the command, and polyester exits with the command's exit status,
+or 128 plus the signal number if a signal killed it, as shells do.`,
+		Example: `  polyester run --env-secret DB_PASSWORD=db/password -- myapp --port 8080`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			env, err := opts.secretEnv()
+			if err != nil {
+				return err
+			}
+			return runChild(cmd, args, env)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.SetInterspersed(false)
+	flags.StringVarP(&opts.dir, "dir", "C", ".", "manifest `directory`")
+	flags.StringVarP(&opts.plan, "plan", "p", "", "also read secrets from `plan`, overriding the manifest's")
+	flags.StringArrayVarP(&opts.identityPaths, "age-identity", "i", nil, "age identity `file`(s) to decrypt secrets with")
+	flags.StringArrayVarP(&opts.envSecrets, "env-secret", "e", nil, "set environment variable `NAME=secret` to the decrypted secret")
+
+	return cmd
+}
+
+// secretEnv returns the decrypted secrets as NAME=value environment
+// variables.
+func (o runOpts) secretEnv() ([]string, error) {
+	if len(o.envSecrets) == 0 {
+		return nil, nil
+	}
+	dirs := []string{filepath.Join(o.dir, "secrets")}
+	if o.plan != "" {
+		dirs = append(dirs, filepath.Join(o.dir, "plans", o.plan, "secrets"))
+	}
+	ids, err := templates.LoadIdentities(o.identityPaths)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("run: no age identities, pass one with --age-identity")
+	}
+
+	env := make([]string, len(o.envSecrets))
+	for i, envSecret := range o.envSecrets {
+		parts := strings.SplitN(envSecret, "=", 2)
+		if len(parts) != 2 || parts[1] == "" || !envNameRE.MatchString(parts[0]) {
+			return nil, fmt.Errorf("run: invalid --env-secret %q, expected NAME=secret", envSecret)
+		}
+		b, err := templates.DecryptSecret(dirs, parts[1], ids...)
+		if err != nil {
+			return nil, err
+		}
+		env[i] = parts[0] + "=" + strings.TrimSuffix(string(b), "\n")
+	}
+	return env, nil
+}
+
+// runChild runs args with env added to the environment, forwarding signals
+// until it exits.
+func runChild(cmd *cobra.Command, args []string, env []string) error {
+	std := stdio.FromContext(cmd.Context())
+	c := exec.Command(args[0], args[1:]...)
+	c.Env = append(os.Environ(), env...)
+	c.Stdin = std.Stdin()
+	c.Stdout = std.Stdout()
+	c.Stderr = std.Stderr()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardSignals...)
+	defer signal.Stop(sigs)
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				if err := c.Process.Signal(sig); err != nil {
+					std.Debug("run: failed to forward signal:", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := c.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code := exitErr.ExitCode()
+		if code < 0 {
+			code = signalExitCode(exitErr)
+		}
+		return &ExitError{Code: code}
+	}
+	return err
+}
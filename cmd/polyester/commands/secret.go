@@ -0,0 +1,450 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/manifest"
+	"github.com/jeffrom/polyester/operator/templates"
+	"github.com/jeffrom/polyester/stdio"
+)
+
+type secretOpts struct {
+	dir           string
+	plan          string
+	identityPaths []string
+	recipients    []string
+}
+
+func newSecretCmd() *cobra.Command {
+	opts := &secretOpts{}
+	cmd := &cobra.Command{
+		Use:   "secret",
+		Short: "manage a manifest's age-encrypted secrets",
+		Long: `Encrypts, decrypts, edits and rekeys the secrets in a manifest's secrets/
+directories.
+
+Secrets are encrypted to every recipient listed in the .recipients file of their
+secrets directory, one age recipient per line. A plan's secrets directory
+without its own .recipients file uses the manifest's. Plaintext is never
+written inside the manifest, and each secrets directory gets a .gitignore that
+ignores everything but encrypted secrets, so plaintext can't be committed by
+accident. polyester secret ls exits non-zero if plaintext is found, and can be
+used as a pre-commit hook.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Usage()
+		},
+	}
+
+	flags := cmd.PersistentFlags()
+	flags.StringVarP(&opts.dir, "dir", "C", ".", "manifest `directory`")
+	flags.StringVarP(&opts.plan, "plan", "p", "", "use the secrets directory of `plan` instead of the manifest's")
+
+	cmd.AddCommand(newSecretEncryptCmd(opts))
+	cmd.AddCommand(newSecretDecryptCmd(opts))
+	cmd.AddCommand(newSecretEditCmd(opts))
+	cmd.AddCommand(newSecretRekeyCmd(opts))
+	cmd.AddCommand(newSecretLsCmd(opts))
+	return cmd
+}
+
+func newSecretEncryptCmd(opts *secretOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "encrypt name [file|-]",
+		Args:  cobra.RangeArgs(1, 2),
+		Short: "encrypt a file, or stdin, as a secret",
+		Long: `Encrypts file, or stdin if it is omitted or -, to secrets/<name>.age.
+
+The secret is encrypted to the recipients in the secrets directory's
+.recipients file. If there is no .recipients file yet, it is created with the
+recipients passed with --recipient.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var r io.Reader = os.Stdin
+			if len(args) > 1 && args[1] != "-" {
+				f, err := os.Open(args[1])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			plaintext, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+
+			recipients, err := opts.initRecipients()
+			if err != nil {
+				return err
+			}
+			return opts.writeSecret(args[0], plaintext, recipients)
+		},
+	}
+	cmd.Flags().StringArrayVarP(&opts.recipients, "recipient", "r", nil, "age `recipient` to create the .recipients file with")
+	return cmd
+}
+
+func newSecretDecryptCmd(opts *secretOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "decrypt name",
+		Args:  cobra.ExactArgs(1),
+		Short: "decrypt a secret to stdout",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ids, err := templates.LoadIdentities(opts.identityPaths)
+			if err != nil {
+				return err
+			}
+			b, err := opts.readSecret(args[0], ids)
+			if err != nil {
+				return err
+			}
+			_, err = stdio.FromContext(cmd.Context()).Stdout().Write(b)
+			return err
+		},
+	}
+	addIdentityFlag(cmd, opts)
+	return cmd
+}
+
+func newSecretEditCmd(opts *secretOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "edit name",
+		Args:  cobra.ExactArgs(1),
+		Short: "edit a secret with $EDITOR",
+		Long: `Decrypts a secret to a temporary file outside of the manifest, opens it with
+$EDITOR, and encrypts it again if it changed. The temporary file is only
+readable by the current user, and is removed afterwards. A secret that doesn't
+exist yet is created.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if err := validSecretName(name); err != nil {
+				return err
+			}
+			recipients, err := opts.initRecipients()
+			if err != nil {
+				return err
+			}
+			var plaintext []byte
+			if _, err := os.Stat(opts.secretPath(name)); err == nil {
+				ids, err := templates.LoadIdentities(opts.identityPaths)
+				if err != nil {
+					return err
+				}
+				plaintext, err = opts.readSecret(name, ids)
+				if err != nil {
+					return err
+				}
+			}
+
+			edited, err := editTemp(cmd, plaintext)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(edited, plaintext) && plaintext != nil {
+				stdio.FromContext(cmd.Context()).Info("secret: no changes to", name)
+				return nil
+			}
+			return opts.writeSecret(name, edited, recipients)
+		},
+	}
+	addIdentityFlag(cmd, opts)
+	return cmd
+}
+
+func newSecretRekeyCmd(opts *secretOpts) *cobra.Command {
+	var add, remove []string
+	cmd := &cobra.Command{
+		Use:   "rekey",
+		Args:  cobra.NoArgs,
+		Short: "add or remove recipients and re-encrypt secrets",
+		Long: `Adds and removes recipients in a .recipients file, and re-encrypts every secret
+that uses it. Without --add or --remove, secrets are re-encrypted to the
+current recipients, such as after editing .recipients by hand.
+
+With --plan, a plan that doesn't have its own .recipients file gets one,
+starting from the manifest's recipients.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			std := stdio.FromContext(cmd.Context())
+			recipPath := filepath.Join(opts.secretsDir(), manifest.RecipientsFile)
+			_, lines, err := manifest.ReadRecipients(filepath.Join(opts.dir, opts.recipientsPath()))
+			if err != nil {
+				return err
+			}
+			lines, err = editRecipients(lines, add, remove)
+			if err != nil {
+				return err
+			}
+			if len(lines) == 0 {
+				return errors.New("secret: refusing to remove every recipient")
+			}
+			// validate before decrypting anything
+			recipients, err := age.ParseRecipients(strings.NewReader(strings.Join(lines, "\n")))
+			if err != nil {
+				return fmt.Errorf("secret: invalid recipient: %w", err)
+			}
+
+			secrets, _, err := manifest.ListSecrets(opts.dir)
+			if err != nil {
+				return err
+			}
+			ids, err := templates.LoadIdentities(opts.identityPaths)
+			if err != nil {
+				return err
+			}
+			// decrypt everything first so a missing identity doesn't leave
+			// secrets encrypted to different recipients.
+			plaintexts := make(map[string][]byte)
+			var rekeyed []manifest.Secret
+			for _, secret := range secrets {
+				if secret.Dir != opts.secretsDir() && manifest.RecipientsPath(opts.dir, secret.Dir) != recipPath {
+					continue
+				}
+				b, err := decryptFile(filepath.Join(opts.dir, secret.Path), ids)
+				if err != nil {
+					return err
+				}
+				plaintexts[secret.Path] = b
+				rekeyed = append(rekeyed, secret)
+			}
+
+			if err := manifest.WriteRecipients(filepath.Join(opts.dir, recipPath), lines); err != nil {
+				return err
+			}
+			for _, secret := range rekeyed {
+				if err := encryptFile(filepath.Join(opts.dir, secret.Path), plaintexts[secret.Path], recipients); err != nil {
+					return err
+				}
+				std.Info("secret: rekeyed", secret.Path)
+			}
+			return nil
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringArrayVar(&add, "add", nil, "age `recipient` to add")
+	flags.StringArrayVar(&remove, "remove", nil, "age `recipient` to remove")
+	addIdentityFlag(cmd, opts)
+	return cmd
+}
+
+func newSecretLsCmd(opts *secretOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Args:  cobra.NoArgs,
+		Short: "list secrets and report plaintext",
+		Long: `Lists each secret in the manifest with the .recipients file it is encrypted to.
+Any other file in a secrets directory is reported as plaintext, and the
+command exits with status 1.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			std := stdio.FromContext(cmd.Context())
+			secrets, plaintext, err := manifest.ListSecrets(opts.dir)
+			if err != nil {
+				return err
+			}
+			out := std.Stdout()
+			for _, secret := range secrets {
+				if opts.plan != "" && secret.Dir != opts.secretsDir() {
+					continue
+				}
+				fmt.Fprintf(out, "%s\t%s\n", secret.Path, manifest.RecipientsPath(opts.dir, secret.Dir))
+			}
+			for _, p := range plaintext {
+				std.Warning("secret: plaintext file:", p)
+			}
+			if len(plaintext) > 0 {
+				return fmt.Errorf("secret: %d plaintext file(s) in secrets directories", len(plaintext))
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func addIdentityFlag(cmd *cobra.Command, opts *secretOpts) {
+	cmd.Flags().StringArrayVarP(&opts.identityPaths, "age-identity", "i", nil, "age identity `file`(s) to decrypt secrets with")
+}
+
+func (o *secretOpts) secretsDir() string {
+	if o.plan != "" {
+		return filepath.Join("plans", o.plan, "secrets")
+	}
+	return "secrets"
+}
+
+func (o *secretOpts) recipientsPath() string {
+	return manifest.RecipientsPath(o.dir, o.secretsDir())
+}
+
+func (o *secretOpts) secretPath(name string) string {
+	return filepath.Join(o.dir, o.secretsDir(), name+manifest.SecretExt)
+}
+
+func validSecretName(name string) error {
+	clean := filepath.Clean(name)
+	if name == "" || filepath.IsAbs(name) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("secret: invalid secret name %q", name)
+	}
+	return nil
+}
+
+// initRecipients returns the recipients secrets are encrypted to, creating the
+// recipients file from --recipient if it doesn't exist.
+func (o *secretOpts) initRecipients() ([]age.Recipient, error) {
+	p := filepath.Join(o.dir, o.recipientsPath())
+	recipients, _, err := manifest.ReadRecipients(p)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) > 0 {
+		if len(o.recipients) > 0 {
+			return nil, fmt.Errorf("secret: %s already exists, use polyester secret rekey --add to add recipients", o.recipientsPath())
+		}
+		return recipients, nil
+	}
+	if len(o.recipients) == 0 {
+		return nil, fmt.Errorf("secret: no recipients in %s, pass at least one with --recipient", o.recipientsPath())
+	}
+
+	lines, err := editRecipients(nil, o.recipients, nil)
+	if err != nil {
+		return nil, err
+	}
+	recipients, err = age.ParseRecipients(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		return nil, fmt.Errorf("secret: invalid recipient: %w", err)
+	}
+	if err := manifest.WriteRecipients(p, lines); err != nil {
+		return nil, err
+	}
+	return recipients, nil
+}
+
+func (o *secretOpts) readSecret(name string, ids []age.Identity) ([]byte, error) {
+	if err := validSecretName(name); err != nil {
+		return nil, err
+	}
+	return decryptFile(o.secretPath(name), ids)
+}
+
+func (o *secretOpts) writeSecret(name string, plaintext []byte, recipients []age.Recipient) error {
+	if err := validSecretName(name); err != nil {
+		return err
+	}
+	if err := manifest.ProtectSecretsDir(filepath.Join(o.dir, o.secretsDir())); err != nil {
+		return err
+	}
+	return encryptFile(o.secretPath(name), plaintext, recipients)
+}
+
+func editRecipients(lines, add, remove []string) ([]string, error) {
+	removed := make(map[string]bool)
+	for _, r := range remove {
+		found := false
+		for _, line := range lines {
+			if line == r {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("secret: recipient %q not found", r)
+		}
+		removed[r] = true
+	}
+
+	var res []string
+	seen := make(map[string]bool)
+	for _, line := range append(lines, add...) {
+		line = strings.TrimSpace(line)
+		if line == "" || removed[line] || seen[line] {
+			continue
+		}
+		seen[line] = true
+		res = append(res, line)
+	}
+	return res, nil
+}
+
+func decryptFile(p string, ids []age.Identity) ([]byte, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("secret: no age identities, pass one with --age-identity")
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := templates.Decrypt(f, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("secret: failed to decrypt %s: %w", p, err)
+	}
+	return b, nil
+}
+
+// encryptFile atomically writes plaintext, encrypted to recipients, to p.
+func encryptFile(p string, plaintext []byte, recipients []age.Recipient) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".polyester-secret-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := templates.Encrypt(f, plaintext, true, recipients...); err != nil {
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// editTemp writes b to a temporary file outside of the manifest, opens it
+// with $EDITOR, and returns its contents after the editor exits.
+func editTemp(cmd *cobra.Command, b []byte) ([]byte, error) {
+	tmpDir, err := os.MkdirTemp("", "polyester-secret-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := os.Chmod(tmpDir, 0700); err != nil {
+		return nil, err
+	}
+	p := filepath.Join(tmpDir, "secret")
+	if err := os.WriteFile(p, b, 0600); err != nil {
+		return nil, err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	std := stdio.FromContext(cmd.Context())
+	c := exec.CommandContext(cmd.Context(), "sh", "-c", editor+` "$1"`, "sh", p)
+	c.Stdin = os.Stdin
+	c.Stdout = std.Stdout()
+	c.Stderr = std.Stderr()
+	if err := c.Run(); err != nil {
+		return nil, fmt.Errorf("secret: editor failed: %w", err)
+	}
+
+	edited, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errors.New("secret: edited file was removed")
+	}
+	return edited, err
+}
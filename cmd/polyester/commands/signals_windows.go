@@ -0,0 +1,16 @@
+package commands
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// forwardSignals are the signals polyester run passes on to its child.
+var forwardSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// signalExitCode returns 1, since processes aren't killed by signals on
+// windows.
+func signalExitCode(exitErr *exec.ExitError) int {
+	return 1
+}
@@ -2,20 +2,37 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/jeffrom/polyester/cmd/polyester/commands"
+	"github.com/jeffrom/polyester/planner/execute"
 	"github.com/jeffrom/polyester/stdio"
 )
 
 func main() {
 	if err := run(os.Args); err != nil {
+		var exitErr *commands.ExitError
+		if errors.As(err, &exitErr) {
+			// the child process has already reported its error
+			os.Exit(exitErr.Code)
+		}
 		fmt.Fprintln(os.Stderr, "Error:", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
+// exitCode returns 2 when some plans failed while others completed, and 1 for
+// any other error.
+func exitCode(err error) int {
+	var failErr *execute.FailureError
+	if errors.As(err, &failErr) {
+		return failErr.ExitCode()
+	}
+	return 1
+}
+
 func run(rawArgs []string) error {
 	ctx := stdio.SetContext(context.Background(), &stdio.StdIO{})
 	return commands.ExecArgs(ctx, rawArgs[1:])
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jeffrom/polyester/cmd/polyester/commands"
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestRun(t *testing.T) {
+	dir := testenv.Path("testdata", "template")
+	key := testenv.Path("testdata", "age.agent.key")
+
+	err := run([]string{"polyester", "run", "-C", dir, "-i", key, "--plan", "nice",
+		"--env-secret", "WOW=wow", "--env-secret", "EXT=with.ext", "--",
+		"sh", "-c", `test "$WOW" = "it's nested and a real wow" && test "$EXT" = "i'm a file w/ an extension"`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = run([]string{"polyester", "run", "-C", dir, "-i", key, "--", "sh", "-c", "exit 3"})
+	var exitErr *commands.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Errorf("expected exit status 3, got %v", err)
+	}
+
+	err = run([]string{"polyester", "run", "-C", dir, "-i", key, "--", "sh", "-c", "kill -TERM $$"})
+	if !errors.As(err, &exitErr) || exitErr.Code != 128+15 {
+		t.Errorf("expected exit status %d for a child killed by SIGTERM, got %v", 128+15, err)
+	}
+
+	for _, envSecret := range []string{"WOW", "1WOW=wow", "WOW=missing"} {
+		if err := run([]string{"polyester", "run", "-C", dir, "-i", key, "-e", envSecret, "--", "true"}); err == nil {
+			t.Errorf("expected --env-secret %q to fail", envSecret)
+		}
+	}
+}
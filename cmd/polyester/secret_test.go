@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/jeffrom/polyester/cmd/polyester/commands"
+	"github.com/jeffrom/polyester/stdio"
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestSecret(t *testing.T) {
+	tmpdir := testenv.TempDir(t, "")
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	// identities are also read from ~/.config/polyester/age, which shouldn't
+	// be the real one.
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", filepath.Join(tmpdir, "home"))
+	defer os.Setenv("HOME", home)
+
+	dir := filepath.Join(tmpdir, "manifest")
+	testenv.Mkdirs(t, 0755, filepath.Join(dir, "plans", "web"), filepath.Join(dir, "plans", "db"))
+	testenv.WriteFile(t, filepath.Join(dir, "polyester.sh"), "P plan web db\n")
+	testenv.WriteFile(t, filepath.Join(dir, "plans", "web", "plan.sh"), "P touch /tmp/web\n")
+	testenv.WriteFile(t, filepath.Join(dir, "plans", "db", "plan.sh"), "P touch /tmp/db\n")
+
+	alice, aliceKey := genIdentity(t, tmpdir, "alice")
+	bob, bobKey := genIdentity(t, tmpdir, "bob")
+	carol, carolKey := genIdentity(t, tmpdir, "carol")
+
+	plain := filepath.Join(tmpdir, "plain")
+	encrypt := func(plan, name, plaintext string, args ...string) {
+		t.Helper()
+		testenv.WriteFile(t, plain, plaintext)
+		args = append([]string{"secret", "encrypt", "-C", dir, "--plan", plan, name, plain}, args...)
+		if _, err := runSecret(args...); err != nil {
+			t.Fatalf("encrypt %s failed: %v", name, err)
+		}
+	}
+	decrypt := func(plan, name, key string) (string, error) {
+		return runSecret("secret", "decrypt", "-C", dir, "--plan", plan, "-i", key, name)
+	}
+	expectDecrypt := func(plan, name, key, expect string) {
+		t.Helper()
+		got, err := decrypt(plan, name, key)
+		if err != nil {
+			t.Fatalf("decrypt %s with %s failed: %v", name, filepath.Base(key), err)
+		}
+		if got != expect {
+			t.Errorf("expected %s to decrypt to %q, got %q", name, expect, got)
+		}
+	}
+	expectNoDecrypt := func(plan, name, key string) {
+		t.Helper()
+		if _, err := decrypt(plan, name, key); err == nil {
+			t.Errorf("expected %s not to decrypt with %s", name, filepath.Base(key))
+		}
+	}
+
+	// the manifest's recipients are created by the first encrypt, and web,
+	// which has no .recipients of its own, inherits them. db gets its own
+	// from rekey --plan.
+	encrypt("", "db/password", "hunter2", "-r", alice.Recipient().String())
+	encrypt("web", "api", "web api key")
+	if _, err := runSecret("secret", "rekey", "-C", dir, "--plan", "db", "-i", aliceKey,
+		"--add", carol.Recipient().String(), "--remove", alice.Recipient().String()); err != nil {
+		t.Fatal("rekey --plan failed:", err)
+	}
+	encrypt("db", "root", "db root")
+	expectNoDecrypt("db", "root", aliceKey)
+	expectDecrypt("", "db/password", aliceKey, "hunter2")
+	expectDecrypt("web", "api", aliceKey, "web api key")
+	expectDecrypt("db", "root", carolKey, "db root")
+	expectNoDecrypt("", "db/password", bobKey)
+	if _, err := os.Stat(filepath.Join(dir, "plans", "web", "secrets", ".recipients")); err == nil {
+		t.Error("expected web not to get its own .recipients")
+	}
+
+	// adding a recipient re-encrypts the manifest's secrets and web's, but not
+	// db's.
+	if _, err := runSecret("secret", "rekey", "-C", dir, "-i", aliceKey, "-i", carolKey, "--add", bob.Recipient().String()); err != nil {
+		t.Fatal("rekey --add failed:", err)
+	}
+	expectDecrypt("", "db/password", bobKey, "hunter2")
+	expectDecrypt("web", "api", bobKey, "web api key")
+	expectNoDecrypt("db", "root", bobKey)
+
+	if _, err := runSecret("secret", "rekey", "-C", dir, "-i", bobKey, "--remove", alice.Recipient().String()); err != nil {
+		t.Fatal("rekey --remove failed:", err)
+	}
+	expectNoDecrypt("", "db/password", aliceKey)
+	expectNoDecrypt("web", "api", aliceKey)
+	expectDecrypt("", "db/password", bobKey, "hunter2")
+	expectDecrypt("web", "api", bobKey, "web api key")
+	expectDecrypt("db", "root", carolKey, "db root")
+	recips := testenv.ReadFile(t, filepath.Join(dir, "secrets", ".recipients"))
+	if strings.TrimSpace(recips) != bob.Recipient().String() {
+		t.Errorf("expected only bob in .recipients, got:\n%s", recips)
+	}
+
+	_, err := runSecret("secret", "rekey", "-C", dir, "-i", bobKey, "--remove", bob.Recipient().String())
+	if err == nil || !strings.Contains(err.Error(), "refusing to remove every recipient") {
+		t.Errorf("expected rekey to refuse to remove the last recipient, got %v", err)
+	}
+	expectDecrypt("", "db/password", bobKey, "hunter2")
+
+	out, err := runSecret("secret", "ls", "-C", dir)
+	if err != nil {
+		t.Fatal("ls failed:", err)
+	}
+	expect := "plans/db/secrets/root.age\tplans/db/secrets/.recipients\n" +
+		"plans/web/secrets/api.age\tsecrets/.recipients\n" +
+		"secrets/db/password.age\tsecrets/.recipients\n"
+	if out != expect {
+		t.Errorf("expected ls output:\n%s\ngot:\n%s", expect, out)
+	}
+
+	testenv.WriteFile(t, filepath.Join(dir, "plans", "web", "secrets", "api.txt"), "web api key")
+	if _, err := runSecret("secret", "ls", "-C", dir); err == nil {
+		t.Error("expected ls to fail with plaintext in a secrets directory")
+	} else if code := exitCode(err); code != 1 {
+		t.Errorf("expected ls to exit 1 with plaintext, got %d", code)
+	}
+}
+
+// runSecret runs polyester with args, and returns its stdout.
+func runSecret(args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	ctx := stdio.SetContext(context.Background(), &stdio.StdIO{Out: out, Err: &bytes.Buffer{}})
+	err := commands.ExecArgs(ctx, args)
+	return out.String(), err
+}
+
+// genIdentity generates an X25519 identity, and writes it to a key file in
+// dir.
+func genIdentity(t testing.TB, dir, name string) (*age.X25519Identity, string) {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, name+".key")
+	testenv.WriteFile(t, p, id.String()+"\n")
+	return id, p
+}
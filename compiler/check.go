@@ -3,88 +3,186 @@ package compiler
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"io"
+	"sort"
+	"strings"
 
-	"github.com/spf13/cobra"
-
-	"github.com/jeffrom/polyester/compiler/shell"
+	"github.com/jeffrom/polyester/manifest"
 	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/planop"
 )
 
-// TODO multiple validation errors
+// ValidationError is a problem found in a plan. File, Line and, for errors
+// found by Lint, Col are the position in the plan script that caused it, if
+// it's known.
+type ValidationError struct {
+	File string
+	Line uint
+	Col  uint
+	// Plan is the plan the error was found in.
+	Plan string
+	// Operation is the name of the operator the error was found in, if any.
+	Operation string
+	Err       error
+}
 
-func preValidate(ctx context.Context, im *intermediatePlan) error {
-	for name, b := range im.compiled {
-		if err := preValidateOne(ctx, name, bytes.NewReader(b)); err != nil {
-			return err
+func (e *ValidationError) Error() string {
+	switch {
+	case e.File != "" && e.Col > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Col, e.Err)
+	case e.File != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+	case e.File != "":
+		return fmt.Sprintf("%s: %s", e.File, e.Err)
+	case e.Plan != "":
+		return fmt.Sprintf("compiler: plan %q: %s", e.Plan, e.Err)
+	}
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// ValidationErrors are all the problems found in a manifest or plan. Its
+// message has one error per line, in file:line:col: message form when the
+// position is known.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Add adds err, if it isn't nil, with the position and plan of base. Each
+// error in operator.Errors is added separately.
+func (errs *ValidationErrors) Add(base ValidationError, err error) {
+	if err == nil {
+		return
+	}
+	var opErrs operator.Errors
+	if errors.As(err, &opErrs) {
+		for _, err := range opErrs {
+			errs.Add(base, err)
 		}
+		return
 	}
-	return nil
+	next := base
+	next.Err = err
+	*errs = append(*errs, &next)
 }
 
-func preValidateOne(ctx context.Context, name string, r io.Reader) error {
-	psh, err := shell.Parse(r)
-	if err != nil {
-		return err
+// merge adds the errors in err if it's ValidationErrors, and returns any other
+// error.
+func (errs *ValidationErrors) merge(err error) error {
+	var verrs ValidationErrors
+	if errors.As(err, &verrs) {
+		*errs = append(*errs, verrs...)
+		return nil
 	}
+	return err
+}
 
-	stmts, err := psh.Extract()
-	if err != nil {
+// Err returns errs, or nil if it is empty.
+func (errs ValidationErrors) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Check lints the plan scripts in m and compiles them, and returns
+// ValidationErrors for every problem either finds, starting with the lint
+// errors. Errors the compiler finds in calls Lint already reported are only
+// reported once.
+func (c *Compiler) Check(ctx context.Context, m *manifest.Manifest) error {
+	var errs ValidationErrors
+	if err := errs.merge(Lint(ctx, m)); err != nil {
 		return err
 	}
-	octx := operator.NewContext(ctx, nil, nil, nil)
+	linted := make(map[string]bool, len(errs))
+	for _, err := range errs {
+		linted[err.key()] = true
+	}
 
-	for _, callExpr := range stmts {
-		lits := shell.Literals(callExpr.Args)
-		cmd, rawArgs := lits[1], lits[2:]
-		opc, ok := allOps[cmd]
-		if !ok {
-			return fmt.Errorf("%s:%s-%s: unrecognized polyester operator %q", name, callExpr.Pos(), callExpr.End(), cmd)
+	_, err := c.Compile(ctx, m)
+	var compileErrs ValidationErrors
+	if err := compileErrs.merge(err); err != nil {
+		errs.Add(ValidationError{}, err)
+	}
+	for _, err := range compileErrs {
+		if !linted[err.key()] {
+			errs = append(errs, err)
+		}
+	}
+	return errs.Err()
+}
+
+// key identifies the error by its line and message, which are the same
+// whether it was found by Lint or the compiler.
+func (e *ValidationError) key() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+}
+
+// OperationError returns a ValidationError, without an error, for an operation
+// in plan, positioned at the polyester call that declared it.
+func OperationError(plan string, data *operator.InfoData) ValidationError {
+	ve := ValidationError{Plan: plan, Operation: data.Name()}
+	if src := data.Source; src != nil {
+		ve.File = src.File
+		ve.Line = src.Line
+	}
+	return ve
+}
+
+// preValidate validates every operation in the evaluated plan scripts, before
+// their plans are resolved, and returns all the errors found.
+func preValidate(ctx context.Context, im *intermediatePlan) error {
+	names := make([]string, 0, len(im.compiled))
+	for name := range im.compiled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs ValidationErrors
+	for _, name := range names {
+		entries, err := readEntries(bytes.NewReader(im.compiled[name]))
+		if err != nil {
+			return err
+		}
+		preValidateOne(ctx, name, entries, &errs)
+	}
+	return errs.Err()
+}
+
+func preValidateOne(ctx context.Context, name string, entries []*operator.PlanEntry, errs *ValidationErrors) {
+	octx := operator.NewContext(ctx, nil, nil, nil)
+	for _, entry := range entries {
+		base := ValidationError{Plan: name, Operation: entry.Name}
+		if src := entry.Source; src != nil {
+			base.File = src.File
+			base.Line = src.Line
+		}
+		op, err := opFromEntry(entry)
+		if err != nil {
+			errs.Add(base, err)
+			continue
 		}
-		// fmt.Println("nice", cmd, rawArgs, opc().Info().Name())
 
-		op := opc()
 		data := op.Info().Data()
-		cobraCmd := data.Command.Command
-		validater, _ := op.(operator.Validator)
-		targ := data.Command.Target
-		cobraCmd.RunE = func(cmd *cobra.Command, args []string) error {
-			if data.Command.ApplyArgs != nil {
-				if err := data.Command.ApplyArgs(cmd, args, targ); err != nil {
-					return err
-				}
-			}
-			if validater == nil {
-				return nil
+		if opts, ok := data.Command.Target.(*planop.HandlerOpts); ok {
+			hop, err := handlerOperation(opts)
+			if err != nil {
+				errs.Add(base, fmt.Errorf("handler %q: %w", opts.Name, err))
+				continue
 			}
-			return validater.Validate(octx, targ, false)
+			op = hop
+			data = hop.Info().Data()
 		}
-		cobraCmd.SetArgs(rawArgs)
-		if err := cobraCmd.Execute(); err != nil {
-			return err
+		if validater, ok := op.(operator.Validator); ok {
+			errs.Add(base, validater.Validate(octx, data.Command.Target, false))
 		}
 	}
-	return nil
 }
-
-// NOTE postValidate doesn't make sense in this package
-// func postValidate(ctx context.Context, plan *Plan, ofs opfs.FS, pfs opfs.PlanDir) error {
-// 	all, err := plan.All()
-// 	if err != nil {
-// 		return err
-// 	}
-// 	octx := operator.NewContext(ctx, ofs, pfs, nil)
-// 	for _, plan := range allPlans {
-// 		for _, op := range plan.Operations {
-// 			validater, ok := op.(operator.Validator)
-// 			if !ok {
-// 				continue
-// 			}
-// 			if err := validater.Validate(octx, op.Info().Data().Command.Target, true); err != nil {
-// 				return err
-// 			}
-// 		}
-// 	}
-// 	return nil
-// }
@@ -0,0 +1,138 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/jeffrom/polyester/operator"
+)
+
+// compiledVersion is the version of the compiled plan format. It should be
+// incremented when the format changes in a backwards-incompatible way.
+const compiledVersion = 1
+
+// compiledPlan is the serialized form of a fully resolved Plan. Plans are
+// stored in a flat list and refer to each other by name, since a plan can be
+// the dependency of many other plans.
+type compiledPlan struct {
+	Version  int                 `json:"version"`
+	Checksum string              `json:"checksum"`
+	Main     string              `json:"main"`
+	Plans    []compiledPlanEntry `json:"plans"`
+}
+
+type compiledPlanEntry struct {
+	Name         string                `json:"name"`
+	Operations   []*operator.PlanEntry `json:"operations,omitempty"`
+	Plans        []string              `json:"plans,omitempty"`
+	Dependencies []string              `json:"dependencies,omitempty"`
+}
+
+// WriteCompiled writes plan, including its subplans, dependencies, and
+// operator targets, to w. checksum should be the checksum of the manifest the
+// plan was compiled from, so it can be verified before the plan is applied.
+func WriteCompiled(w io.Writer, plan *Plan, checksum string) error {
+	seen := make(map[string]bool)
+	_, all := allPlans(plan, seen)
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+
+	cp := compiledPlan{
+		Version:  compiledVersion,
+		Checksum: checksum,
+		Main:     plan.Name,
+	}
+	for _, p := range all {
+		ent := compiledPlanEntry{Name: p.Name}
+		for _, op := range p.Operations {
+			data := op.Info().Data()
+			targb, err := json.Marshal(data.Command.Target)
+			if err != nil {
+				return err
+			}
+			ent.Operations = append(ent.Operations, &operator.PlanEntry{
+				Name:   data.Name(),
+				Args:   targb,
+				Notify: data.Notify,
+				Source: data.Source,
+			})
+		}
+		for _, sp := range p.Plans {
+			ent.Plans = append(ent.Plans, sp.Name)
+		}
+		for _, dep := range p.Dependencies {
+			ent.Dependencies = append(ent.Dependencies, dep.Name)
+		}
+		cp.Plans = append(cp.Plans, ent)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(cp)
+}
+
+// ReadCompiled reads a plan written by WriteCompiled. It returns the plan and
+// the checksum of the manifest it was compiled from.
+func ReadCompiled(r io.Reader) (*Plan, string, error) {
+	allOptsOnce.Do(setupAllOps)
+	cp := compiledPlan{}
+	if err := json.NewDecoder(r).Decode(&cp); err != nil {
+		return nil, "", fmt.Errorf("compiler: failed to read compiled plan: %w", err)
+	}
+	if cp.Version != compiledVersion {
+		return nil, "", fmt.Errorf("compiler: unsupported compiled plan version %d (want %d)", cp.Version, compiledVersion)
+	}
+
+	plans := make(map[string]*Plan)
+	for _, ent := range cp.Plans {
+		plan := &Plan{Name: ent.Name}
+		for _, pe := range ent.Operations {
+			op, err := opFromEntry(pe)
+			if err != nil {
+				return nil, "", fmt.Errorf("compiler: plan %q: %w", ent.Name, err)
+			}
+			plan.Operations = append(plan.Operations, op)
+		}
+		plans[ent.Name] = plan
+	}
+
+	lookup := func(from, name string) (*Plan, error) {
+		plan, ok := plans[name]
+		if !ok {
+			return nil, fmt.Errorf("compiler: plan %q refers to unknown plan %q", from, name)
+		}
+		return plan, nil
+	}
+	for _, ent := range cp.Plans {
+		plan := plans[ent.Name]
+		for _, name := range ent.Plans {
+			sp, err := lookup(ent.Name, name)
+			if err != nil {
+				return nil, "", err
+			}
+			plan.Plans = append(plan.Plans, sp)
+		}
+		for _, name := range ent.Dependencies {
+			dep, err := lookup(ent.Name, name)
+			if err != nil {
+				return nil, "", err
+			}
+			plan.Dependencies = append(plan.Dependencies, dep)
+		}
+	}
+
+	main, err := lookup("compiled plan", cp.Main)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := checkCycles(main); err != nil {
+		return nil, "", fmt.Errorf("compiler: %w", err)
+	}
+	for _, plan := range plans {
+		if err := checkHandlers(plan); err != nil {
+			return nil, "", err
+		}
+	}
+	return main, cp.Checksum, nil
+}
@@ -1,6 +1,10 @@
 // Package compiler contains code to compile manifests into executable plans.
 //
-// Only POSIX shell and bash are currently supported.
+// Plan scripts are evaluated with the interpreter named by their shebang, or
+// sh if they have none. Scripts for POSIX shell, bash, zsh and ksh are parsed
+// and annotated before they are evaluated. Any other interpreter can be used
+// as long as it writes intermediate plan entries to file descriptor 3, such as
+// by running polyester with $_POLY_PLAN set to "-".
 package compiler
 
 import (
@@ -10,15 +14,24 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
+	"github.com/jeffrom/polyester/compiler/shell"
 	"github.com/jeffrom/polyester/executil"
 	"github.com/jeffrom/polyester/manifest"
 	"github.com/jeffrom/polyester/stdio"
 )
 
 type Compiler struct {
+	// Concurrency is the maximum number of plan scripts to evaluate at once.
+	// It defaults to the number of CPUs.
+	Concurrency int
+
 	selfFile string
 	environ  []string
 }
@@ -27,6 +40,19 @@ func New() *Compiler {
 	return &Compiler{}
 }
 
+// compileJob is a plan script to evaluate.
+type compileJob struct {
+	name   string
+	file   string
+	script []byte
+}
+
+// Compile evaluates the plan scripts of m and returns the resulting plan. The
+// main script is evaluated first. If it fails, only its error is returned,
+// since the subplan scripts aren't evaluated at all, so their errors are
+// reported once the main script is fixed. Otherwise the subplan scripts are
+// evaluated concurrently, and the errors of every one that failed are
+// returned as ValidationErrors.
 func (c *Compiler) Compile(ctx context.Context, m *manifest.Manifest) (*Plan, error) {
 	allOptsOnce.Do(setupAllOps)
 	std := stdio.FromContext(ctx)
@@ -44,15 +70,26 @@ func (c *Compiler) Compile(ctx context.Context, m *manifest.Manifest) (*Plan, er
 		c.selfFile = selfFile
 	}
 
-	im := newIntermediatePlan(m)
-	// TODO could do this concurrently
-	std.Debugf("compiler: execOne %q", m.Main)
-	if err := c.execOne(ctx, im, m.Main, m.MainScript); err != nil {
-		return nil, err
+	jobs := []compileJob{{name: m.Main, file: m.Main, script: m.MainScript}}
+	names := make([]string, 0, len(m.Plans))
+	for name := range m.Plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		plan := m.Plans[name]
+		jobs = append(jobs, compileJob{name: name, file: planFile(name, plan), script: plan.MainScript})
 	}
-	for name, plan := range m.Plans {
-		std.Debugf("compiler: execOne %q", name)
-		if err := c.execOne(ctx, im, name, plan.MainScript); err != nil {
+
+	im := newIntermediatePlan(m)
+	// the main script is evaluated first, and if it fails, the subplan
+	// scripts aren't evaluated at all.
+	for _, batch := range [][]compileJob{jobs[:1], jobs[1:]} {
+		results, errs := c.execAll(ctx, batch)
+		for i, job := range batch {
+			im.compiled[job.name] = results[i]
+		}
+		if err := errs.Err(); err != nil {
 			return nil, err
 		}
 	}
@@ -63,21 +100,66 @@ func (c *Compiler) Compile(ctx context.Context, m *manifest.Manifest) (*Plan, er
 	return readPlan(im)
 }
 
-func (c *Compiler) execOne(ctx context.Context, im *intermediatePlan, name string, b []byte) error {
+// execAll evaluates the plan scripts in jobs, up to c.Concurrency at a time.
+// The intermediate plans are returned in the same order as jobs, along with
+// the errors of every script that failed.
+func (c *Compiler) execAll(ctx context.Context, jobs []compileJob) ([][]byte, ValidationErrors) {
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	if concurrency > len(jobs) {
+		concurrency = len(jobs)
+	}
+
+	std := stdio.FromContext(ctx)
+	results := make([][]byte, len(jobs))
+	jobErrs := make([]error, len(jobs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < concurrency; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				job := jobs[i]
+				std.Debugf("compiler: execOne %q", job.name)
+				results[i], jobErrs[i] = c.execOne(ctx, job.name, job.file, job.script)
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var errs ValidationErrors
+	for i, err := range jobErrs {
+		errs.Add(ValidationError{File: jobs[i].file, Plan: jobs[i].name}, err)
+	}
+	return results, errs
+}
+
+// execOne evaluates the script of a plan, file, and returns its intermediate
+// plan.
+func (c *Compiler) execOne(ctx context.Context, name, file string, b []byte) ([]byte, error) {
 	std := stdio.FromContext(ctx)
-	annotated, err := annotatePlanScript(b, c.selfFile)
+	interp := shell.ParseShebang(b)
+	if err := lookInterpreter(interp); err != nil {
+		return nil, err
+	}
+	args, cleanup, err := scriptArgs(interp, b, c.selfFile, file)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	script := string(annotated)
-	// std.Debugf("compiler: annotated script: %s", script)
-	// TODO statically validate script here
+	defer cleanup()
 
 	r, w, err := os.Pipe()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	cmd := executil.CommandContext(ctx, "sh", "-c", script)
+	cmd := executil.CommandContext(ctx, interp.Command, args...)
 	cmd.Env = append(os.Environ(), c.environ...)
 	// cmd.Stdin = std.Stdin()
 	cmd.Stdout = stdio.NewPrefixWriter(std.Stdout(), name)
@@ -85,17 +167,24 @@ func (c *Compiler) execOne(ctx context.Context, im *intermediatePlan, name strin
 	cmd.ExtraFiles = []*os.File{w}
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("compiler: run failed: %w", err)
+		r.Close()
+		w.Close()
+		return nil, fmt.Errorf("run failed: %w", err)
 	}
 	defer r.Close()
 	w.Close()
 
 	buf := bytes.NewBuffer(nil)
 	if _, err := io.Copy(buf, r); err != nil {
-		return err
+		return nil, err
 	}
-	im.compiled[name] = buf.Bytes()
-	return nil
+	return buf.Bytes(), nil
+}
+
+// planFile returns the path of a subplan's script, relative to the manifest
+// directory.
+func planFile(name string, plan *manifest.Manifest) string {
+	return path.Join("plans", name, plan.Main)
 }
 
 func addSelfPathToEnviron(o *stdio.StdIO, environ []string) (string, []string, error) {
@@ -1,10 +1,18 @@
 package compiler
 
 import (
-	"context"
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/jeffrom/polyester/manifest"
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/fileop"
 	"github.com/jeffrom/polyester/testenv"
 )
 
@@ -18,7 +26,7 @@ func TestCompiler(t *testing.T) {
 		t.Fatal("manifest was nil")
 	}
 
-	plan, err := cc.Compile(context.Background(), m)
+	plan, err := cc.Compile(testenv.Context(), m)
 	if err != nil {
 		t.Fatal("compile failed:", err)
 	}
@@ -52,3 +60,393 @@ func TestCompiler(t *testing.T) {
 		t.Errorf("expected first-touch before touchy. first-touch was #%d, touchy was #%d", firstTouchIdx, touchIdx)
 	}
 }
+
+func TestCompiled(t *testing.T) {
+	m, err := manifest.LoadDir(testenv.Path("testdata", "basic"))
+	if err != nil {
+		t.Fatal("load manifest failed:", err)
+	}
+	plan, err := New().Compile(testenv.Context(), m)
+	if err != nil {
+		t.Fatal("compile failed:", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteCompiled(buf, plan, manifest.Checksum(m)); err != nil {
+		t.Fatal("write failed:", err)
+	}
+	readPlan, checksum, err := ReadCompiled(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal("read failed:", err)
+	}
+	if checksum != manifest.Checksum(m) {
+		t.Errorf("expected checksum %q, got %q", manifest.Checksum(m), checksum)
+	}
+
+	expected, err := plan.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := readPlan.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) != len(actual) {
+		t.Fatalf("expected %d plans, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		if expected[i].Name != actual[i].Name {
+			t.Errorf("plan #%d: expected %q, got %q", i, expected[i].Name, actual[i].Name)
+		}
+		if len(expected[i].Operations) != len(actual[i].Operations) {
+			t.Errorf("plan %q: expected %d operations, got %d", expected[i].Name, len(expected[i].Operations), len(actual[i].Operations))
+		}
+	}
+
+	again := &bytes.Buffer{}
+	if err := WriteCompiled(again, readPlan, checksum); err != nil {
+		t.Fatal("rewrite failed:", err)
+	}
+	if buf.String() != again.String() {
+		t.Errorf("expected compiled plan to round trip, got:\n%s\nwant:\n%s", again.String(), buf.String())
+	}
+}
+
+func TestCircularDependency(t *testing.T) {
+	a := &Plan{Name: "a"}
+	b := &Plan{Name: "b", Dependencies: []*Plan{a}}
+	c := &Plan{Name: "c", Plans: []*Plan{b}}
+	a.Dependencies = []*Plan{c}
+	main := &Plan{Name: "main", Plans: []*Plan{a}}
+
+	_, err := main.All()
+	if err == nil {
+		t.Fatal("expected circular dependency error")
+	}
+	if expect := "circular dependency: a -> c -> b -> a"; err.Error() != expect {
+		t.Errorf("expected error %q, got %q", expect, err.Error())
+	}
+}
+
+func TestCheckHandlers(t *testing.T) {
+	allOptsOnce.Do(setupAllOps)
+	tcs := []struct {
+		name    string
+		entries []*operator.PlanEntry
+		err     string
+	}{
+		{
+			name: "ok",
+			entries: []*operator.PlanEntry{
+				{Name: "handler", Args: []byte(`{"name":"reload","args":["touch","/tmp/reloaded"]}`)},
+				{Name: "touch", Args: []byte(`{"path":"/tmp/a"}`), Notify: []string{"reload"}},
+			},
+		},
+		{
+			name: "unknown",
+			entries: []*operator.PlanEntry{
+				{Name: "touch", Args: []byte(`{"path":"/tmp/a"}`), Notify: []string{"reload"}},
+			},
+			err: `compiler: plan "unknown": touch notifies unknown handler "reload"`,
+		},
+		{
+			name: "duplicate",
+			entries: []*operator.PlanEntry{
+				{Name: "handler", Args: []byte(`{"name":"reload","args":["touch","/tmp/reloaded"]}`)},
+				{Name: "handler", Args: []byte(`{"name":"reload","args":["touch","/tmp/reloaded"]}`)},
+			},
+			err: `compiler: plan "duplicate" declares handler "reload" more than once`,
+		},
+		{
+			name: "bad-operator",
+			entries: []*operator.PlanEntry{
+				{Name: "handler", Args: []byte(`{"name":"reload","args":["nope"]}`)},
+			},
+			err: `compiler: plan "bad-operator": handler "reload": unrecognized polyester operator "nope"`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			plan := &Plan{Name: tc.name}
+			for _, entry := range tc.entries {
+				op, err := opFromEntry(entry)
+				if err != nil {
+					t.Fatal(err)
+				}
+				plan.Operations = append(plan.Operations, op)
+			}
+
+			err := checkHandlers(plan)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal("unexpected error:", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error %q", tc.err)
+			}
+			if err.Error() != tc.err {
+				t.Errorf("expected error %q, got %q", tc.err, err.Error())
+			}
+		})
+	}
+}
+
+func TestCompileValidationErrors(t *testing.T) {
+	m, err := manifest.LoadDir(testenv.Path("testdata", "invalid"))
+	if err != nil {
+		t.Fatal("load manifest failed:", err)
+	}
+
+	_, err = New().Compile(testenv.Context(), m)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	expect := []string{
+		`polyester.sh:7: systemd: at least one of --enabled, --state, --restart-on or --reload-on is required`,
+		`polyester.sh:8: line: only one of --insert-after and --insert-before can be used`,
+		`polyester.sh:8: line: line is required`,
+		`polyester.sh:10: apt-repo: invalid name "bad/name"`,
+		`plans/web/plan.sh:6: apt-repo: invalid name "example/web"`,
+		`plans/web/plan.sh:6: apt-repo: uri and suite are required`,
+		`plans/web/plan.sh:6: apt-repo: only one of --key and --key-url can be used`,
+	}
+	got := strings.Split(errs.Error(), "\n")
+	if len(got) != len(expect) {
+		t.Fatalf("expected %d errors, got %d:\n%s", len(expect), len(got), errs)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("error #%d: expected %q, got %q", i, expect[i], got[i])
+		}
+	}
+	if last := errs[len(errs)-1]; last.Plan != "web" || last.Operation != "apt-repo" {
+		t.Errorf("expected error in web apt-repo, got %s %s", last.Plan, last.Operation)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	m, err := manifest.LoadDir(testenv.Path("testdata", "invalid"))
+	if err != nil {
+		t.Fatal("load manifest failed:", err)
+	}
+
+	err = New().Check(testenv.Context(), m)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	// the lint errors are followed by the compiler's, except for the
+	// apt-repo call on line 10, which both find.
+	expect := []string{
+		`polyester.sh:9:12: template: "missing.conf" not found in templates/`,
+		`polyester.sh:10:1: apt-repo: invalid name "bad/name"`,
+		`polyester.sh:7: systemd: at least one of --enabled, --state, --restart-on or --reload-on is required`,
+		`polyester.sh:8: line: only one of --insert-after and --insert-before can be used`,
+		`polyester.sh:8: line: line is required`,
+		`plans/web/plan.sh:6: apt-repo: invalid name "example/web"`,
+		`plans/web/plan.sh:6: apt-repo: uri and suite are required`,
+		`plans/web/plan.sh:6: apt-repo: only one of --key and --key-url can be used`,
+	}
+	got := strings.Split(errs.Error(), "\n")
+	if len(got) != len(expect) {
+		t.Fatalf("expected %d errors, got %d:\n%s", len(expect), len(got), errs)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("error #%d: expected %q, got %q", i, expect[i], got[i])
+		}
+	}
+}
+
+func TestCompileInterpreters(t *testing.T) {
+	for _, prog := range []string{"bash", "awk"} {
+		if _, err := exec.LookPath(prog); err != nil {
+			t.Skipf("%s is required: %v", prog, err)
+		}
+	}
+	m, err := manifest.LoadDir(testenv.Path("testdata", "interpreters"))
+	if err != nil {
+		t.Fatal("load manifest failed:", err)
+	}
+	plan, err := New().Compile(testenv.Context(), m)
+	if err != nil {
+		t.Fatal("compile failed:", err)
+	}
+
+	touched := func(p *Plan) []string {
+		var res []string
+		for _, op := range p.Operations {
+			if opts, ok := op.Info().Data().Command.Target.(*fileop.TouchOpts); ok {
+				res = append(res, opts.Path)
+			}
+		}
+		return res
+	}
+	expect := []string{"/tmp/polyester-interpreters/one", "/tmp/polyester-interpreters/two"}
+	if got := touched(plan); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected bash plan to touch %q, got %q", expect, got)
+	}
+	if len(plan.Plans) != 1 {
+		t.Fatalf("expected 1 subplan, got %d", len(plan.Plans))
+	}
+	expect = []string{"/tmp/polyester-awk"}
+	if got := touched(plan.Plans[0]); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected awk plan to touch %q, got %q", expect, got)
+	}
+}
+
+func TestCompileShells(t *testing.T) {
+	// a shebang naming sh may still be run by bash, which only expands the P
+	// alias when it's told to.
+	tmpdir := testenv.TempDir(t, "")
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+	bashAsSh := filepath.Join(tmpdir, "sh")
+	if err := os.WriteFile(bashAsSh, []byte("#!/bin/sh\nexec bash \"$@\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// zsh, ksh and mksh are only tested when they're installed.
+	tcs := []struct {
+		name    string
+		shebang string
+		require string
+	}{
+		{name: "sh", shebang: "#!/bin/sh", require: "sh"},
+		{name: "env sh", shebang: "#!/usr/bin/env sh", require: "sh"},
+		{name: "dash", shebang: "#!/usr/bin/env dash", require: "dash"},
+		{name: "bash", shebang: "#!/usr/bin/env bash", require: "bash"},
+		{name: "bash as sh", shebang: "#!" + bashAsSh, require: "bash"},
+		{name: "zsh", shebang: "#!/usr/bin/env zsh", require: "zsh"},
+		{name: "ksh", shebang: "#!/usr/bin/env ksh", require: "ksh"},
+		{name: "mksh", shebang: "#!/usr/bin/env mksh", require: "mksh"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := exec.LookPath(tc.require); err != nil {
+				t.Skipf("%s is required: %v", tc.require, err)
+			}
+			m := &manifest.Manifest{
+				Main:       "polyester.sh",
+				MainScript: []byte(tc.shebang + "\nset -eu\nP touch /tmp/polyester-shells\n"),
+			}
+			plan, err := New().Compile(testenv.Context(), m)
+			if err != nil {
+				t.Fatal("compile failed:", err)
+			}
+			if len(plan.Operations) != 1 {
+				t.Fatalf("expected 1 operation, got %d", len(plan.Operations))
+			}
+			opts, ok := plan.Operations[0].Info().Data().Command.Target.(*fileop.TouchOpts)
+			if !ok || opts.Path != "/tmp/polyester-shells" {
+				t.Errorf("expected a touch of /tmp/polyester-shells, got %+v", plan.Operations[0].Info().Data().Command.Target)
+			}
+		})
+	}
+}
+
+func TestCompileMissingInterpreter(t *testing.T) {
+	m := &manifest.Manifest{
+		Main:       "polyester.sh",
+		MainScript: []byte("#!/nonexistent/fish\nP touch /tmp/fish\n"),
+	}
+	_, err := New().Compile(testenv.Context(), m)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	expect := `polyester.sh: interpreter "/nonexistent/fish" not found`
+	if !strings.HasPrefix(err.Error(), expect) {
+		t.Errorf("expected error starting with %q, got %q", expect, err)
+	}
+}
+
+func TestCompileConcurrency(t *testing.T) {
+	m, err := manifest.LoadDir(testenv.Path("testdata", "basic"))
+	if err != nil {
+		t.Fatal("load manifest failed:", err)
+	}
+
+	var expect string
+	for _, concurrency := range []int{1, 8} {
+		cc := New()
+		cc.Concurrency = concurrency
+		plan, err := cc.Compile(testenv.Context(), m)
+		if err != nil {
+			t.Fatalf("compile with concurrency %d failed: %v", concurrency, err)
+		}
+		buf := &bytes.Buffer{}
+		if err := WriteCompiled(buf, plan, manifest.Checksum(m)); err != nil {
+			t.Fatal("write failed:", err)
+		}
+		if expect == "" {
+			expect = buf.String()
+		} else if buf.String() != expect {
+			t.Errorf("expected concurrency %d to compile the same plan, got:\n%s\nwant:\n%s", concurrency, buf.String(), expect)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tmpdir := testenv.TempDir(t, "")
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+	ran := filepath.Join(tmpdir, "ran")
+
+	tcs := []struct {
+		name   string
+		main   string
+		expect []string
+		// evaluated is whether the subplan scripts were evaluated.
+		evaluated bool
+	}{
+		{
+			name: "subplans",
+			main: "P plan ok bad worse\n",
+			expect: []string{
+				`plans/bad/plan.sh: run failed: exit status 2`,
+				`plans/worse/plan.sh: run failed: exit status 3`,
+			},
+			evaluated: true,
+		},
+		{
+			// the subplan scripts aren't evaluated after the main script
+			// fails, so only its error is reported.
+			name:   "main",
+			main:   "P plan ok bad worse\nexit 4\n",
+			expect: []string{`polyester.sh: run failed: exit status 4`},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &manifest.Manifest{
+				Main:       "polyester.sh",
+				MainScript: []byte(tc.main),
+				Plans: map[string]*manifest.Manifest{
+					"ok":    {Main: "plan.sh", MainScript: []byte("touch " + ran + "\nP touch /tmp/ok\n")},
+					"bad":   {Main: "plan.sh", MainScript: []byte("exit 2\n")},
+					"worse": {Main: "plan.sh", MainScript: []byte("exit 3\n")},
+				},
+			}
+			os.Remove(ran)
+			_, err := New().Compile(testenv.Context(), m)
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected ValidationErrors, got %v", err)
+			}
+
+			got := strings.Split(errs.Error(), "\n")
+			if !reflect.DeepEqual(got, tc.expect) {
+				t.Errorf("expected errors %q, got %q", tc.expect, got)
+			}
+			_, statErr := os.Stat(ran)
+			if evaluated := statErr == nil; evaluated != tc.evaluated {
+				t.Errorf("expected subplan scripts to be evaluated: %v, got %v", tc.evaluated, evaluated)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/jeffrom/polyester/compiler/shell"
 	"github.com/jeffrom/polyester/operator"
 )
 
@@ -22,6 +23,7 @@ func AppendPlan(ctx context.Context, planFile string, info operator.Info, cobraC
 		}
 	}
 
+	info.Data().Source = operator.ParseSource(os.Getenv(shell.SourceEnv))
 	// fmt.Printf("%s: args %+v\n", info.Name(), cmd.Target)
 	return appendToFile(planFile, info)
 }
@@ -0,0 +1,100 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/planop"
+)
+
+// Handler is an operation declared with the handler operator. It runs once
+// at the end of its plan if an operation that notifies it changed its target.
+type Handler struct {
+	Name      string
+	Operation operator.Interface
+}
+
+// AddNotifyFlag adds the --notify flag, which every operator accepts in plan
+// scripts, to the operator's command.
+func AddNotifyFlag(info operator.Info) {
+	data := info.Data()
+	switch data.Name() {
+	case "plan", "dependency", "handler":
+		return
+	}
+	data.Command.Flags().StringArrayVar(&data.Notify, "notify", nil, "run handler `name` at the end of the plan if the operation changes")
+}
+
+// Handlers returns the handlers declared in the plan, in the order they were
+// declared.
+func (p Plan) Handlers() ([]Handler, error) {
+	allOptsOnce.Do(setupAllOps)
+	var handlers []Handler
+	seen := make(map[string]bool)
+	for _, op := range p.Operations {
+		data := op.Info().Data()
+		if data.Name() != "handler" {
+			continue
+		}
+		opts := data.Command.Target.(*planop.HandlerOpts)
+		if seen[opts.Name] {
+			return nil, fmt.Errorf("compiler: plan %q declares handler %q more than once", p.Name, opts.Name)
+		}
+		seen[opts.Name] = true
+
+		hop, err := handlerOperation(opts)
+		if err != nil {
+			return nil, fmt.Errorf("compiler: plan %q: handler %q: %w", p.Name, opts.Name, err)
+		}
+		hop.Info().Data().Source = data.Source
+		handlers = append(handlers, Handler{Name: opts.Name, Operation: hop})
+	}
+	return handlers, nil
+}
+
+// handlerOperation parses the operation a handler runs.
+func handlerOperation(opts *planop.HandlerOpts) (operator.Interface, error) {
+	if len(opts.Args) == 0 {
+		return nil, fmt.Errorf("no operation")
+	}
+	name, args := opts.Args[0], opts.Args[1:]
+	switch name {
+	case "plan", "dependency", "handler":
+		return nil, fmt.Errorf("%s can't be used as a handler", name)
+	}
+	opc, ok := allOps[name]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized polyester operator %q", name)
+	}
+
+	op := opc()
+	data := op.Info().Data()
+	if err := parseArgs(data.Command, args); err != nil {
+		return nil, err
+	}
+	return operation{op: op, data: data}, nil
+}
+
+// checkHandlers returns an error if the plan's handlers can't be parsed, or
+// ValidationErrors for every operation that notifies a handler the plan
+// doesn't declare.
+func checkHandlers(plan *Plan) error {
+	handlers, err := plan.Handlers()
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool, len(handlers))
+	for _, h := range handlers {
+		names[h.Name] = true
+	}
+	var errs ValidationErrors
+	for _, op := range plan.Operations {
+		data := op.Info().Data()
+		for _, name := range data.Notify {
+			if !names[name] {
+				errs.Add(OperationError(plan.Name, data), fmt.Errorf("%s notifies unknown handler %q", data.Name(), name))
+			}
+		}
+	}
+	return errs.Err()
+}
@@ -0,0 +1,224 @@
+package compiler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/jeffrom/polyester/compiler/shell"
+	"github.com/jeffrom/polyester/manifest"
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/planop"
+)
+
+// Lint statically checks the plan scripts in a manifest without running them.
+// It reports unknown operators, arguments the operators don't accept, plans
+// that don't exist under plans/, and files, templates and vars that are
+// missing from the manifest. Only calls whose arguments are all literals are
+// checked, since others are only known once the script runs, and only scripts
+// for shells polyester can parse are checked. If any problems are found, they
+// are all returned as ValidationErrors.
+func Lint(ctx context.Context, m *manifest.Manifest) error {
+	allOptsOnce.Do(setupAllOps)
+	l := &linter{ctx: ctx, m: m}
+	l.lintScript("", m.Main, m.MainScript)
+
+	names := make([]string, 0, len(m.Plans))
+	for name := range m.Plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l.lintScript(name, planFile(name, m.Plans[name]), m.Plans[name].MainScript)
+	}
+
+	return l.errs.Err()
+}
+
+type linter struct {
+	ctx  context.Context
+	m    *manifest.Manifest
+	errs ValidationErrors
+}
+
+func (l *linter) add(plan, file string, pos syntax.Pos, op string, err error) {
+	if plan == "" {
+		plan = l.m.Main
+	}
+	l.errs.Add(ValidationError{
+		File:      file,
+		Line:      pos.Line(),
+		Col:       pos.Col(),
+		Plan:      plan,
+		Operation: op,
+	}, err)
+}
+
+// lintScript lints the calls in the script of plan, which is empty for the
+// manifest's main script. Scripts for interpreters that aren't shells can't
+// be linted.
+func (l *linter) lintScript(plan, file string, b []byte) {
+	if !shell.ParseShebang(b).IsShell() {
+		return
+	}
+	psh, err := shell.ParseFile(bytes.NewReader(b), file)
+	if err != nil {
+		var perr syntax.ParseError
+		if errors.As(err, &perr) {
+			l.add(plan, file, perr.Pos, "", errors.New(perr.Text))
+			return
+		}
+		l.errs.Add(ValidationError{File: file}, err)
+		return
+	}
+	for _, callExpr := range psh.Calls() {
+		l.lintCall(plan, file, callExpr)
+	}
+}
+
+func (l *linter) lintCall(plan, file string, callExpr *syntax.CallExpr) {
+	if len(callExpr.Args) < 2 {
+		return
+	}
+	name, ok := shell.Static(callExpr.Args[1])
+	if !ok {
+		return
+	}
+	opc, ok := allOps[name]
+	if !ok {
+		l.add(plan, file, callExpr.Args[1].Pos(), "", fmt.Errorf("unrecognized polyester operator %q", name))
+		return
+	}
+
+	words := callExpr.Args[2:]
+	args := make([]string, len(words))
+	for i, word := range words {
+		arg, ok := shell.Static(word)
+		if !ok {
+			return
+		}
+		args[i] = arg
+	}
+	// finds the position of the argument with value, or the call if it's
+	// not there as is, such as a flag value in --flag=value form.
+	posOf := func(value string) syntax.Pos {
+		for i, arg := range args {
+			if arg == value {
+				return words[i].Pos()
+			}
+		}
+		return callExpr.Pos()
+	}
+
+	op := opc()
+	data := op.Info().Data()
+	AddNotifyFlag(data)
+	if err := parseArgs(data.Command, args); err != nil {
+		l.add(plan, file, callExpr.Pos(), name, fmt.Errorf("%s: %w", name, err))
+		return
+	}
+	targ := data.Command.Target
+	if validater, ok := op.(operator.Validator); ok {
+		octx := operator.NewContext(l.ctx, nil, nil, nil)
+		if err := validater.Validate(octx, targ, false); err != nil {
+			l.add(plan, file, callExpr.Pos(), name, err)
+		}
+	}
+
+	switch opts := targ.(type) {
+	case *planop.PlanOpts:
+		l.lintPlans(plan, file, name, opts.Plans, posOf)
+	case *planop.DependencyOpts:
+		l.lintPlans(plan, file, name, opts.Plans, posOf)
+	case *planop.HandlerOpts:
+		hop, err := handlerOperation(opts)
+		if err != nil {
+			l.add(plan, file, callExpr.Pos(), name, fmt.Errorf("handler %q: %w", opts.Name, err))
+			return
+		}
+		op = hop.(operation).op
+		targ = hop.Info().Data().Command.Target
+	}
+
+	if referencer, ok := op.(operator.Referencer); ok {
+		for _, ref := range referencer.References(targ) {
+			if !l.exists(plan, ref) {
+				l.add(plan, file, posOf(ref.Path), name, fmt.Errorf("%s: %q not found in %s/", name, ref.Path, ref.Kind))
+			}
+		}
+	}
+}
+
+func (l *linter) lintPlans(plan, file, op string, plans []string, posOf func(string) syntax.Pos) {
+	for _, name := range plans {
+		if _, ok := l.m.Plans[name]; !ok {
+			l.add(plan, file, posOf(name), op, fmt.Errorf("plan %q not found in plans/", name))
+		}
+	}
+}
+
+// exists returns true if the manifest has a path matching ref, resolved the
+// same way operators resolve it when the plan is applied. Paths that are only
+// resolved relative to the manifest directory at apply time are assumed to
+// exist.
+func (l *linter) exists(plan string, ref operator.Reference) bool {
+	if path.IsAbs(ref.Path) || strings.HasPrefix(ref.Path, "./") {
+		return true
+	}
+
+	var dirs []*manifest.Manifest
+	if plan != "" {
+		dirs = append(dirs, l.m.Plans[plan])
+	}
+	// templates are only looked up in the current plan's templates/.
+	if ref.Kind != "templates" || plan == "" {
+		dirs = append(dirs, l.m)
+	}
+	for _, dir := range dirs {
+		var files map[string][]byte
+		switch ref.Kind {
+		case "files":
+			files = dir.Files
+		case "templates":
+			files = dir.Templates
+		case "vars":
+			files = dir.Vars
+		}
+		for p := range files {
+			if ok, _ := doublestar.Match(ref.Path, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseArgs parses args into the operator's target the same way the
+// polyester command does when the plan script runs.
+func parseArgs(cmd *operator.Command, args []string) error {
+	if err := cmd.ParseFlags(args); err != nil {
+		return err
+	}
+	posArgs := args
+	if !cmd.DisableFlagParsing {
+		posArgs = cmd.Flags().Args()
+	}
+	if cmd.Args != nil {
+		if err := cmd.Args(cmd.Command, posArgs); err != nil {
+			return err
+		}
+	}
+	if cmd.ApplyArgs != nil {
+		if err := cmd.ApplyArgs(cmd.Command, posArgs, cmd.Target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package compiler
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jeffrom/polyester/manifest"
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestLint(t *testing.T) {
+	m, err := manifest.LoadDir(testenv.Path("testdata", "lint"))
+	if err != nil {
+		t.Fatal("load manifest failed:", err)
+	}
+
+	err = Lint(testenv.Context(), m)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	expect := []string{
+		`polyester.sh:4:1: touch: unknown flag: --nope`,
+		`polyester.sh:5:3: unrecognized polyester operator "frobnicate"`,
+		`polyester.sh:6:12: plan "missing" not found in plans/`,
+		`polyester.sh:7:14: plan "nothere" not found in plans/`,
+		`polyester.sh:9:12: template: "missing.conf" not found in templates/`,
+		`polyester.sh:11:1: handler "broken": unrecognized polyester operator "nope"`,
+		`polyester.sh:14:2: mkdir: requires at least 1 arg(s), only received 0`,
+		`plans/app/plan.sh:4:18: pcopy: "missing/*.conf" not found in files/`,
+		`plans/app/plan.sh:5:12: template: "greeting" not found in templates/`,
+		`plans/app/plan.sh:7:18: apt-repo: "app.asc" not found in files/`,
+	}
+	got := strings.Split(errs.Error(), "\n")
+	if len(got) != len(expect) {
+		t.Fatalf("expected %d errors, got %d:\n%s", len(expect), len(got), errs)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("error #%d: expected %q, got %q", i, expect[i], got[i])
+		}
+	}
+}
+
+func TestLintBasic(t *testing.T) {
+	m, err := manifest.LoadDir(testenv.Path("testdata", "basic"))
+	if err != nil {
+		t.Fatal("load manifest failed:", err)
+	}
+	if err := Lint(testenv.Context(), m); err != nil {
+		t.Fatal("expected no lint errors, got:", err)
+	}
+}
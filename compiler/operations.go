@@ -9,6 +9,7 @@ import (
 	"github.com/jeffrom/polyester/operator/gitop"
 	"github.com/jeffrom/polyester/operator/pkgop"
 	"github.com/jeffrom/polyester/operator/planop"
+	"github.com/jeffrom/polyester/operator/serviceop"
 	"github.com/jeffrom/polyester/operator/shellop"
 	"github.com/jeffrom/polyester/operator/templateop"
 	"github.com/jeffrom/polyester/operator/userop"
@@ -34,20 +35,36 @@ func opCreators() []func() operator.Interface {
 
 		func() operator.Interface { return planop.Plan{Args: &planop.PlanOpts{}} },
 		func() operator.Interface { return planop.Dependency{Args: &planop.DependencyOpts{}} },
+		func() operator.Interface { return planop.Handler{Args: &planop.HandlerOpts{}} },
 
 		func() operator.Interface { return fileop.Touch{Args: &fileop.TouchOpts{}} },
 		func() operator.Interface { return fileop.Mkdir{Args: &fileop.MkdirOpts{}} },
 		func() operator.Interface { return fileop.Copy{Args: &fileop.CopyOpts{}} },
 		func() operator.Interface { return fileop.Pcopy{Args: &fileop.PcopyOpts{}} },
 		func() operator.Interface { return fileop.AtomicCopy{Args: &fileop.AtomicCopyOpts{}} },
+		func() operator.Interface { return fileop.Line{Args: &fileop.LineOpts{}} },
 
 		func() operator.Interface { return gitop.Repo{Args: &gitop.RepoOpts{}} },
 
 		func() operator.Interface { return pkgop.AptInstall{Args: &pkgop.AptInstallOpts{}} },
+		func() operator.Interface { return pkgop.AptRemove{Args: &pkgop.AptRemoveOpts{}} },
+		func() operator.Interface { return pkgop.AptRemove{Args: &pkgop.AptRemoveOpts{}, Purge: true} },
+		func() operator.Interface { return pkgop.AptRepo{Args: &pkgop.AptRepoOpts{}} },
+		func() operator.Interface { return pkgop.AptUpdate{Args: &pkgop.AptUpdateOpts{}} },
+		func() operator.Interface { return pkgop.DnfInstall{Args: &pkgop.InstallOpts{}} },
+		func() operator.Interface { return pkgop.ApkInstall{Args: &pkgop.InstallOpts{}} },
+		func() operator.Interface { return pkgop.PacmanInstall{Args: &pkgop.InstallOpts{}} },
+		func() operator.Interface { return pkgop.PkgInstall{Args: &pkgop.PkgInstallOpts{}} },
+
+		func() operator.Interface { return serviceop.Service{Args: &serviceop.ServiceOpts{}} },
+		func() operator.Interface { return serviceop.Systemd{Args: &serviceop.SystemdOpts{}} },
 
 		func() operator.Interface { return shellop.Shell{Args: &shellop.ShellOpts{}} },
 
 		func() operator.Interface { return userop.Useradd{Args: &userop.UseraddOpts{}} },
+		func() operator.Interface { return userop.Userdel{Args: &userop.UserdelOpts{}} },
+		func() operator.Interface { return userop.Groupadd{Args: &userop.GroupaddOpts{}} },
+		func() operator.Interface { return userop.AuthorizedKey{Args: &userop.AuthorizedKeyOpts{}} },
 
 		func() operator.Interface { return templateop.Template{Args: &templateop.TemplateOpts{}} },
 	}
@@ -97,3 +114,11 @@ func (op operation) GetState(octx operator.Context) (state.State, error) {
 func (op operation) Run(octx operator.Context) error {
 	return op.op.Run(octx)
 }
+
+// Validate validates the operation if its operator is an operator.Validator.
+func (op operation) Validate(octx operator.Context, targ interface{}, evaluated bool) error {
+	if validater, ok := op.op.(operator.Validator); ok {
+		return validater.Validate(octx, targ, evaluated)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 
 	"github.com/ghodss/yaml"
 
@@ -24,7 +25,7 @@ type Plan struct {
 func (p Plan) RealOps() []operator.Interface {
 	var res []operator.Interface
 	for _, op := range p.Operations {
-		if name := op.Info().Name(); name == "plan" || name == "dependency" {
+		if name := op.Info().Name(); name == "plan" || name == "dependency" || name == "handler" {
 			continue
 		}
 		res = append(res, op)
@@ -32,7 +33,13 @@ func (p Plan) RealOps() []operator.Interface {
 	return res
 }
 
+// All returns p and every plan it refers to, sorted so each plan comes after
+// its dependencies. Plans with no ordering between them are sorted by name,
+// and main is always last.
 func (p Plan) All() ([]*Plan, error) {
+	if err := checkCycles(&p); err != nil {
+		return nil, err
+	}
 	seen := make(map[string]bool)
 	_, all := allPlans(&p, seen)
 
@@ -84,31 +91,51 @@ func (p Plan) TextSummary(w io.Writer, prevs, currs []state.State) error {
 }
 
 func readPlan(im *intermediatePlan) (*Plan, error) {
+	// plans are read in the same order regardless of the order their
+	// scripts were evaluated in, so the result is always the same.
+	names := make([]string, 0, len(im.compiled))
+	for name := range im.compiled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	plans := make(map[string]*Plan)
-	for name, b := range im.compiled {
-		plan, err := readOnePlan(name, bytes.NewReader(b))
+	for _, name := range names {
+		plan, err := readOnePlan(name, bytes.NewReader(im.compiled[name]))
 		if err != nil {
 			return nil, err
 		}
 		plans[plan.Name] = plan
 	}
 
-	for _, plan := range plans {
-		if err := resolveOnePlan(plan, plans); err != nil {
+	var errs ValidationErrors
+	for _, name := range names {
+		if err := errs.merge(resolveOnePlan(plans[name], plans)); err != nil {
 			return nil, err
 		}
 	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
 
 	main := plans["polyester.sh"]
-	return &Plan{
+	plan := &Plan{
 		Name:         "main",
 		Operations:   main.Operations,
 		Plans:        main.Plans,
 		Dependencies: main.Dependencies,
-	}, nil
+	}
+	if err := checkCycles(plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
 }
 
+// resolveOnePlan links plan to its subplans and dependencies in all. It
+// returns ValidationErrors for every unknown plan it refers to, and every
+// problem with its handlers.
 func resolveOnePlan(plan *Plan, all map[string]*Plan) error {
+	var errs ValidationErrors
 	var deps []*Plan
 	var plans []*Plan
 	for _, op := range plan.Operations {
@@ -120,25 +147,59 @@ func resolveOnePlan(plan *Plan, all map[string]*Plan) error {
 		case "plan":
 			args := targ.(*planop.PlanOpts).Plans
 			for _, arg := range args {
-				plans = append(plans, all[arg])
+				sp, ok := all[arg]
+				if !ok {
+					errs.Add(OperationError(plan.Name, data), fmt.Errorf("refers to unknown plan %q", arg))
+					continue
+				}
+				plans = append(plans, sp)
 			}
 		case "dependency":
 			args := targ.(*planop.DependencyOpts).Plans
 			for _, arg := range args {
-				deps = append(deps, all[arg])
+				dep, ok := all[arg]
+				if !ok {
+					errs.Add(OperationError(plan.Name, data), fmt.Errorf("depends on unknown plan %q", arg))
+					continue
+				}
+				deps = append(deps, dep)
 			}
 		}
 	}
 
 	plan.Dependencies = deps
 	plan.Plans = plans
-	return nil
+	if err := errs.merge(checkHandlers(plan)); err != nil {
+		return err
+	}
+	return errs.Err()
 }
 
 // readOnePlan reads some intermediate plan bytes into a struct, but does not
 // resolve its subplans or dependencies.
 func readOnePlan(name string, r io.Reader) (*Plan, error) {
-	var ops []operator.Interface
+	entries, err := readEntries(r)
+	if err != nil {
+		return nil, err
+	}
+	ops := make([]operator.Interface, len(entries))
+	for i, entry := range entries {
+		op, err := opFromEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		ops[i] = op
+	}
+
+	return &Plan{
+		Name:       name,
+		Operations: ops,
+	}, nil
+}
+
+// readEntries reads the entries of an intermediate plan.
+func readEntries(r io.Reader) ([]*operator.PlanEntry, error) {
+	var entries []*operator.PlanEntry
 	sc := bufio.NewScanner(r)
 	sc.Split(splitOp)
 	for sc.Scan() {
@@ -146,20 +207,16 @@ func readOnePlan(name string, r io.Reader) (*Plan, error) {
 		if bytes.Equal(bytes.TrimSpace(b), []byte("---")) {
 			continue
 		}
-		op, err := opFromBytes(b)
-		if err != nil {
-			return nil, err
+		entry := &operator.PlanEntry{}
+		if err := yaml.Unmarshal(b, entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal operation entry: %w", err)
 		}
-		ops = append(ops, op)
+		entries = append(entries, entry)
 	}
 	if err := sc.Err(); err != nil {
 		return nil, err
 	}
-
-	return &Plan{
-		Name:       name,
-		Operations: ops,
-	}, nil
+	return entries, nil
 }
 
 func splitOp(data []byte, atEOF bool) (int, []byte, error) {
@@ -186,13 +243,7 @@ func dropCR(data []byte) []byte {
 	return data
 }
 
-func opFromBytes(b []byte) (operator.Interface, error) {
-	// fmt.Printf("opFromBytes: %s\n", string(b))
-	entry := &operator.PlanEntry{}
-	if err := yaml.Unmarshal(b, entry); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal operation entry: %w", err)
-	}
-
+func opFromEntry(entry *operator.PlanEntry) (operator.Interface, error) {
 	opc, ok := allOps[entry.Name]
 	if !ok {
 		return nil, fmt.Errorf("did not find operation %q", entry.Name)
@@ -204,5 +255,7 @@ func opFromBytes(b []byte) (operator.Interface, error) {
 			return nil, fmt.Errorf("failed to unmarshal operation target: %w", err)
 		}
 	}
+	opData.Notify = entry.Notify
+	opData.Source = entry.Source
 	return operation{op: op, data: opData}, nil
 }
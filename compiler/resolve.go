@@ -1,6 +1,56 @@
 package compiler
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// checkCycles returns an error containing the full path of the first circular
+// reference found between p and its subplans and dependencies.
+func checkCycles(p *Plan) error {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	marks := make(map[string]int)
+	var path []string
+
+	var visit func(p *Plan) error
+	visit = func(p *Plan) error {
+		switch marks[p.Name] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for i, name := range path {
+				if name == p.Name {
+					start = i
+					break
+				}
+			}
+			cycle := append(append([]string{}, path[start:]...), p.Name)
+			return fmt.Errorf("circular dependency: %s", strings.Join(cycle, " -> "))
+		}
+
+		marks[p.Name] = visiting
+		path = append(path, p.Name)
+		for _, sp := range p.Dependencies {
+			if err := visit(sp); err != nil {
+				return err
+			}
+		}
+		for _, sp := range p.Plans {
+			if err := visit(sp); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		marks[p.Name] = visited
+		return nil
+	}
+	return visit(p)
+}
 
 func allPlans(p *Plan, seen map[string]bool) (map[string]bool, []*Plan) {
 	var plans []*Plan
@@ -36,9 +86,11 @@ func sortPlans(plans []*Plan) ([]*Plan, error) {
 	var resolved []*Plan
 	for len(deps) > 0 {
 		ready := make(map[string]bool)
+		var readyNames []string
 		for depName, depm := range deps {
 			if len(depm) == 0 {
 				ready[depName] = true
+				readyNames = append(readyNames, depName)
 			}
 		}
 
@@ -48,10 +100,13 @@ func sortPlans(plans []*Plan) ([]*Plan, error) {
 			for name := range deps {
 				circs = append(circs, name)
 			}
+			sort.Strings(circs)
 			return nil, fmt.Errorf("circular dependency: %v", circs)
 		}
 
-		for name := range ready {
+		// sort each batch so the resulting order is deterministic
+		sort.Strings(readyNames)
+		for _, name := range readyNames {
 			delete(deps, name)
 			resolved = append(resolved, m[name])
 		}
@@ -2,13 +2,18 @@ package compiler
 
 import (
 	"bytes"
+	"fmt"
 	"html/template"
+	"os"
+	"os/exec"
+	"path/filepath"
 
 	"github.com/jeffrom/polyester/compiler/shell"
 )
 
 var planBoilerplate = template.Must(template.New("boilerplate").Parse(`
 # --- START polyester script boilerplate
+[ -z "${BASH_VERSION:-}" ] || shopt -s expand_aliases
 {{- with $file := .SelfFile }}
 alias polyester={{ $file }}
 {{- end }}
@@ -18,11 +23,17 @@ alias P=polyester
 `))
 
 // annotatePlanScript adds boilerplate to plan script before executing them.
-// All it currently adds is: alias P polyester.
-// If selfFile is not polyester (ie in a test), an alias polyester=selfFile
-// will be added.
-func annotatePlanScript(planb []byte, selfFile string) ([]byte, error) {
-	psh, err := shell.Parse(bytes.NewReader(planb))
+// It adds: alias P polyester, and sets the position in file of each polyester
+// call in its environment. If selfFile is not polyester (ie in a test), an
+// alias polyester=selfFile will be added. bash only expands aliases in
+// scripts if it's told to, so the boilerplate does that whenever the script
+// is run by bash, whatever the name of the interpreter in its shebang.
+func annotatePlanScript(planb []byte, selfFile, file string) ([]byte, error) {
+	psh, err := shell.ParseFile(bytes.NewReader(planb), file)
+	if err != nil {
+		return nil, err
+	}
+	psh, err = shell.ParseFile(bytes.NewReader(psh.AnnotateSources(file)), file)
 	if err != nil {
 		return nil, err
 	}
@@ -60,3 +71,49 @@ func annotatePlanScript(planb []byte, selfFile string) ([]byte, error) {
 	copy(res[len(planDeclBoilerplate):], planb)
 	return res, nil
 }
+
+// scriptArgs returns the arguments to evaluate a plan script, file, with
+// interp. Shell scripts are annotated and passed with -c. Other scripts are
+// passed to their interpreter as is, in a temporary file that cleanup
+// removes.
+func scriptArgs(interp shell.Interpreter, b []byte, selfFile, file string) (args []string, cleanup func(), err error) {
+	args = append([]string{}, interp.Args...)
+	if interp.IsShell() {
+		annotated, err := annotatePlanScript(b, selfFile, file)
+		if err != nil {
+			return nil, nil, err
+		}
+		return append(args, "-c", string(annotated)), func() {}, nil
+	}
+
+	f, err := os.CreateTemp("", "polyester-plan-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup = func() { os.Remove(f.Name()) }
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		cleanup()
+		return nil, nil, err
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return append(args, f.Name()), cleanup, nil
+}
+
+// lookInterpreter returns an error if interp, or the program it runs with
+// env, isn't installed.
+func lookInterpreter(interp shell.Interpreter) error {
+	progs := []string{interp.Command}
+	if filepath.Base(interp.Command) != interp.Name {
+		progs = append(progs, interp.Name)
+	}
+	for _, prog := range progs {
+		if _, err := exec.LookPath(prog); err != nil {
+			return fmt.Errorf("interpreter %q not found: %w", prog, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package shell
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Interpreter is the program a plan script is evaluated with, as named by its
+// shebang.
+type Interpreter struct {
+	// Command and Args are the program and arguments in the shebang, such as
+	// /usr/bin/env and [bash].
+	Command string
+	Args    []string
+	// Name is the base name of the program that interprets the script. For
+	// scripts run with env, it is the program env runs.
+	Name string
+}
+
+// DefaultInterpreter evaluates scripts without a shebang.
+var DefaultInterpreter = Interpreter{Command: "sh", Name: "sh"}
+
+// shellLangs are the shells whose scripts polyester can parse, and the
+// dialect they're parsed as. zsh scripts are parsed as bash, its closest
+// dialect.
+var shellLangs = map[string]syntax.LangVariant{
+	"sh":   syntax.LangPOSIX,
+	"dash": syntax.LangPOSIX,
+	"ash":  syntax.LangPOSIX,
+	"bash": syntax.LangBash,
+	"zsh":  syntax.LangBash,
+	"ksh":  syntax.LangMirBSDKorn,
+	"mksh": syntax.LangMirBSDKorn,
+}
+
+// ParseShebang returns the interpreter named by the shebang of script, or
+// DefaultInterpreter if it has none.
+func ParseShebang(script []byte) Interpreter {
+	if !bytes.HasPrefix(script, []byte("#!")) {
+		return DefaultInterpreter
+	}
+	line := script[2:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return DefaultInterpreter
+	}
+
+	interp := Interpreter{Command: fields[0], Args: fields[1:], Name: filepath.Base(fields[0])}
+	if interp.Name == "env" {
+		interp.Name = envProgram(interp.Args)
+	}
+	return interp
+}
+
+// envProgram returns the base name of the program env runs with args, or env
+// if it doesn't run one.
+func envProgram(args []string) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-u" || arg == "-C" || arg == "--unset" || arg == "--chdir":
+			// these options take the next argument as their value.
+			i++
+		case strings.HasPrefix(arg, "-S") && len(arg) > 2:
+			// -S can be joined with the command line it splits, as in -Sbash.
+			return filepath.Base(arg[2:])
+		case strings.HasPrefix(arg, "-") || strings.Contains(arg, "="):
+			// skip env's other options, such as -S, and variable
+			// assignments.
+		default:
+			return filepath.Base(arg)
+		}
+	}
+	return "env"
+}
+
+// Lang returns the dialect scripts for the interpreter are parsed as. It
+// returns false if the interpreter isn't a shell polyester can parse.
+func (interp Interpreter) Lang() (syntax.LangVariant, bool) {
+	lang, ok := shellLangs[interp.Name]
+	return lang, ok
+}
+
+// IsShell returns true if the interpreter is a shell polyester can parse.
+func (interp Interpreter) IsShell() bool {
+	_, ok := interp.Lang()
+	return ok
+}
@@ -0,0 +1,111 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseShebang(t *testing.T) {
+	tcs := []struct {
+		name   string
+		script string
+		expect Interpreter
+	}{
+		{
+			name:   "none",
+			script: "P touch /tmp/a\n",
+			expect: DefaultInterpreter,
+		},
+		{
+			name:   "bare",
+			script: "#!\nP touch /tmp/a\n",
+			expect: DefaultInterpreter,
+		},
+		{
+			name:   "blank",
+			script: "#!   \nP touch /tmp/a\n",
+			expect: DefaultInterpreter,
+		},
+		{
+			name:   "no newline",
+			script: "#!/bin/sh",
+			expect: Interpreter{Command: "/bin/sh", Args: []string{}, Name: "sh"},
+		},
+		{
+			name:   "path",
+			script: "#!/bin/bash\nP touch /tmp/a\n",
+			expect: Interpreter{Command: "/bin/bash", Args: []string{}, Name: "bash"},
+		},
+		{
+			name:   "space after #!",
+			script: "#! /bin/bash\n",
+			expect: Interpreter{Command: "/bin/bash", Args: []string{}, Name: "bash"},
+		},
+		{
+			name:   "crlf",
+			script: "#!/bin/bash -e\r\nP touch /tmp/a\r\n",
+			expect: Interpreter{Command: "/bin/bash", Args: []string{"-e"}, Name: "bash"},
+		},
+		{
+			name:   "interpreter args",
+			script: "#!/bin/bash -eu -o pipefail\n",
+			expect: Interpreter{Command: "/bin/bash", Args: []string{"-eu", "-o", "pipefail"}, Name: "bash"},
+		},
+		{
+			name:   "env",
+			script: "#!/usr/bin/env zsh\n",
+			expect: Interpreter{Command: "/usr/bin/env", Args: []string{"zsh"}, Name: "zsh"},
+		},
+		{
+			name:   "env -S",
+			script: "#!/usr/bin/env -S bash -eu\n",
+			expect: Interpreter{Command: "/usr/bin/env", Args: []string{"-S", "bash", "-eu"}, Name: "bash"},
+		},
+		{
+			name:   "env -S joined",
+			script: "#!/usr/bin/env -Sbash -eu\n",
+			expect: Interpreter{Command: "/usr/bin/env", Args: []string{"-Sbash", "-eu"}, Name: "bash"},
+		},
+		{
+			name:   "env assignment",
+			script: "#!/usr/bin/env VAR=x LANG=C sh\n",
+			expect: Interpreter{Command: "/usr/bin/env", Args: []string{"VAR=x", "LANG=C", "sh"}, Name: "sh"},
+		},
+		{
+			name:   "env options with values",
+			script: "#!/usr/bin/env -u HOME -C /tmp -i /usr/local/bin/mksh\n",
+			expect: Interpreter{Command: "/usr/bin/env", Args: []string{"-u", "HOME", "-C", "/tmp", "-i", "/usr/local/bin/mksh"}, Name: "mksh"},
+		},
+		{
+			name:   "env without a program",
+			script: "#!/usr/bin/env -i\n",
+			expect: Interpreter{Command: "/usr/bin/env", Args: []string{"-i"}, Name: "env"},
+		},
+		{
+			name:   "not a shell",
+			script: "#!/usr/bin/awk -f\n",
+			expect: Interpreter{Command: "/usr/bin/awk", Args: []string{"-f"}, Name: "awk"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ParseShebang([]byte(tc.script)); !reflect.DeepEqual(got, tc.expect) {
+				t.Errorf("expected %+v, got %+v", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestInterpreterLang(t *testing.T) {
+	for _, name := range []string{"sh", "dash", "ash", "bash", "zsh", "ksh", "mksh"} {
+		if !(Interpreter{Name: name}).IsShell() {
+			t.Errorf("expected %s to be a shell", name)
+		}
+	}
+	for _, name := range []string{"awk", "python3", "env", "fish"} {
+		if (Interpreter{Name: name}).IsShell() {
+			t.Errorf("expected %s not to be a shell", name)
+		}
+	}
+}
@@ -4,24 +4,42 @@ package shell
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"sort"
+	"strings"
 
 	"mvdan.cc/sh/v3/syntax"
 )
 
+// SourceEnv is the environment variable that AnnotateSources sets, in
+// file:line form, for each polyester call.
+const SourceEnv = "_POLY_SOURCE"
+
 type Parser struct {
 	raw []byte
 	*syntax.File
 }
 
 func Parse(r io.Reader) (*Parser, error) {
+	return ParseFile(r, "plan")
+}
+
+// ParseFile parses a plan script, in the dialect of the shell named by its
+// shebang. Parse errors, and the positions of the parsed nodes, refer to the
+// script by name.
+func ParseFile(r io.Reader, name string) (*Parser, error) {
 	buf := bytes.NewBuffer(nil)
 	if _, err := io.Copy(buf, io.LimitReader(r, 1024*1024*256)); err != nil {
 		return nil, err
 	}
 	b := buf.Bytes()
 
-	f, err := syntax.NewParser().Parse(bytes.NewReader(b), "plan")
+	var opts []syntax.ParserOption
+	if lang, ok := ParseShebang(b).Lang(); ok {
+		opts = append(opts, syntax.Variant(lang))
+	}
+	f, err := syntax.NewParser(opts...).Parse(bytes.NewReader(b), name)
 	if err != nil {
 		return nil, err
 	}
@@ -79,3 +97,68 @@ func Literals(args []*syntax.Word) []string {
 	}
 	return res
 }
+
+// Calls returns every polyester call in the script, including those nested in
+// functions, conditionals and loops, in the order they appear.
+func (psh *Parser) Calls() []*syntax.CallExpr {
+	var res []*syntax.CallExpr
+	syntax.Walk(psh.File, func(node syntax.Node) bool {
+		if callExpr, ok := node.(*syntax.CallExpr); ok && isPolyesterCall(callExpr) {
+			res = append(res, callExpr)
+		}
+		return true
+	})
+	return res
+}
+
+// AnnotateSources returns the script with SourceEnv set to the position of
+// each polyester call in file, so the operations it declares can be traced
+// back to it.
+func (psh *Parser) AnnotateSources(file string) []byte {
+	calls := psh.Calls()
+	sort.Slice(calls, func(i, j int) bool { return calls[i].Pos().Offset() < calls[j].Pos().Offset() })
+
+	buf := bytes.NewBuffer(nil)
+	var last uint
+	for _, callExpr := range calls {
+		off := callExpr.Args[0].Pos().Offset()
+		buf.Write(psh.raw[last:off])
+		src := fmt.Sprintf("%s:%d", file, callExpr.Args[0].Pos().Line())
+		fmt.Fprintf(buf, "%s='%s' ", SourceEnv, strings.ReplaceAll(src, "'", `'\''`))
+		last = off
+	}
+	buf.Write(psh.raw[last:])
+	return buf.Bytes()
+}
+
+// Static returns the value of word if it is known without evaluating the
+// script, ie it is made only of literals and quoted strings, without
+// parameter expansions, command substitutions or escapes.
+func Static(word *syntax.Word) (string, bool) {
+	var sb strings.Builder
+	for _, part := range word.Parts {
+		switch t := part.(type) {
+		case *syntax.Lit:
+			if strings.ContainsAny(t.Value, "\\*?[") {
+				return "", false
+			}
+			sb.WriteString(t.Value)
+		case *syntax.SglQuoted:
+			if t.Dollar {
+				return "", false
+			}
+			sb.WriteString(t.Value)
+		case *syntax.DblQuoted:
+			for _, dpart := range t.Parts {
+				lit, ok := dpart.(*syntax.Lit)
+				if !ok || strings.Contains(lit.Value, "\\") {
+					return "", false
+				}
+				sb.WriteString(lit.Value)
+			}
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
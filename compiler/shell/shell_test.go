@@ -0,0 +1,80 @@
+package shell
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAnnotateSources(t *testing.T) {
+	tcs := []struct {
+		name   string
+		file   string
+		script string
+		expect string
+	}{
+		{
+			name:   "calls",
+			file:   "polyester.sh",
+			script: "#!/bin/sh\nP touch /tmp/a\npolyester touch /tmp/b\necho P\n",
+			expect: "#!/bin/sh\n_POLY_SOURCE='polyester.sh:2' P touch /tmp/a\n_POLY_SOURCE='polyester.sh:3' polyester touch /tmp/b\necho P\n",
+		},
+		{
+			name:   "env assignments",
+			file:   "polyester.sh",
+			script: "A=1 B=\"two words\" P touch /tmp/a\n",
+			expect: "A=1 B=\"two words\" _POLY_SOURCE='polyester.sh:1' P touch /tmp/a\n",
+		},
+		{
+			name:   "pipeline",
+			file:   "polyester.sh",
+			script: "echo hi | P touch /tmp/a && P touch /tmp/b\n",
+			expect: "echo hi | _POLY_SOURCE='polyester.sh:1' P touch /tmp/a && _POLY_SOURCE='polyester.sh:1' P touch /tmp/b\n",
+		},
+		{
+			name:   "if condition",
+			file:   "polyester.sh",
+			script: "if P touch /tmp/a; then\n\tP touch /tmp/b\nfi\n",
+			expect: "if _POLY_SOURCE='polyester.sh:1' P touch /tmp/a; then\n\t_POLY_SOURCE='polyester.sh:2' P touch /tmp/b\nfi\n",
+		},
+		{
+			name:   "function",
+			file:   "polyester.sh",
+			script: "touchit() {\n\tP touch \"$1\"\n}\ntouchit /tmp/a\n",
+			expect: "touchit() {\n\t_POLY_SOURCE='polyester.sh:2' P touch \"$1\"\n}\ntouchit /tmp/a\n",
+		},
+		{
+			name:   "command substitution",
+			file:   "polyester.sh",
+			script: "x=$(P touch /tmp/a)\n",
+			expect: "x=$(_POLY_SOURCE='polyester.sh:1' P touch /tmp/a)\n",
+		},
+		{
+			name:   "quoted file name",
+			file:   "plans/it's \"here\"/plan.sh",
+			script: "P touch /tmp/a\n",
+			expect: `_POLY_SOURCE='plans/it'\''s "here"/plan.sh:1' P touch /tmp/a` + "\n",
+		},
+		{
+			name:   "no calls",
+			file:   "polyester.sh",
+			script: "echo hi\n",
+			expect: "echo hi\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			psh, err := ParseFile(bytes.NewReader([]byte(tc.script)), tc.file)
+			if err != nil {
+				t.Fatal("parse failed:", err)
+			}
+			got := string(psh.AnnotateSources(tc.file))
+			if got != tc.expect {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expect, got)
+			}
+			if _, err := ParseFile(bytes.NewReader([]byte(got)), tc.file); err != nil {
+				t.Errorf("annotated script doesn't parse: %v", err)
+			}
+		})
+	}
+}
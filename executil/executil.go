@@ -11,6 +11,10 @@ import (
 // overridden in tests.
 var CommandContext = exec.CommandContext
 
+// LookPath is initialized to exec.LookPath. It is intended to be overridden in
+// tests.
+var LookPath = exec.LookPath
+
 func SetCommand(fn func(context.Context, string, ...string) *exec.Cmd) {
 	CommandContext = fn
 }
@@ -15,6 +15,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/ghodss/yaml"
 )
 
 var headerBytes = []byte("+vRE4eUD3Mi53e6J4sE6wKE42UBR5EJrnjeffROm=")
@@ -179,6 +181,23 @@ func Save(m *Manifest, destDir string) (string, error) {
 	return filename, nil
 }
 
+// IsArchive returns true if the file at name is a gzipped archive, such as
+// one written by Save.
+func IsArchive(name string) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	buffer := make([]byte, 512)
+	n, err := f.Read(buffer)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return http.DetectContentType(buffer[:n]) == "application/x-gzip", nil
+}
+
 func checkTar(name string, f *os.File) error {
 	defer f.Seek(0, 0)
 
@@ -206,6 +225,15 @@ func writeTar(out *tar.Writer, m *Manifest, prefix string) error {
 	if err := writeToTar(out, filepath.Join(base, m.Main), m.MainScript); err != nil {
 		return err
 	}
+	if m.Metadata != nil {
+		b, err := yaml.Marshal(m.Metadata)
+		if err != nil {
+			return err
+		}
+		if err := writeToTar(out, filepath.Join(base, metadataFile), b); err != nil {
+			return err
+		}
+	}
 
 	if err := writeFilesToTar(out, filepath.Join(base, "files"), m.Files); err != nil {
 		return err
@@ -55,3 +55,41 @@ func TestLoadSaveArchive(t *testing.T) {
 		})
 	}
 }
+
+func TestSaveMetadata(t *testing.T) {
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "noop"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	man, err := LoadDir(filepath.Join(tmpdir, "manifest"))
+	if err != nil {
+		t.Fatal("LoadDir failed:", err)
+	}
+	if man.Metadata != nil {
+		t.Fatalf("expected no metadata, got %+v", man.Metadata)
+	}
+	man.Metadata = &Metadata{Name: "noop", Version: "0.1.0"}
+
+	p, err := Save(man, filepath.Join(tmpdir, "archive"))
+	if err != nil {
+		t.Fatal("Save failed:", err)
+	}
+	if _, file := filepath.Split(p); file != "noop-0.1.0.tgz" {
+		t.Errorf("expected archive to be named noop-0.1.0.tgz, was %q", file)
+	}
+
+	loaded, err := LoadFile(p)
+	if err != nil {
+		t.Fatal("Load failed:", err)
+	}
+	if loaded.Metadata == nil {
+		t.Fatal("expected loaded metadata not to be nil")
+	}
+	if *loaded.Metadata != *man.Metadata {
+		t.Errorf("expected metadata %+v, got %+v", man.Metadata, loaded.Metadata)
+	}
+
+	man.Metadata = &Metadata{Name: "noop"}
+	if _, err := Save(man, filepath.Join(tmpdir, "archive")); err == nil {
+		t.Error("expected Save to fail without a version")
+	}
+}
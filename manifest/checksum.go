@@ -0,0 +1,58 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"path"
+	"sort"
+)
+
+// Checksum returns a checksum of the manifest's scripts and files. Metadata
+// is not included, so two manifests with the same contents but different
+// versions have the same checksum.
+func Checksum(m *Manifest) string {
+	h := sha256.New()
+	writeChecksum(h, m, "")
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeChecksum(h hash.Hash, m *Manifest, prefix string) {
+	writeChecksumEntry(h, path.Join(prefix, m.Main), m.MainScript)
+	writeChecksumFiles(h, path.Join(prefix, "files"), m.Files)
+	writeChecksumFiles(h, path.Join(prefix, "templates"), m.Templates)
+	writeChecksumFiles(h, path.Join(prefix, "vars"), m.Vars)
+	writeChecksumFiles(h, path.Join(prefix, "secrets"), m.Secrets)
+
+	for _, k := range sortedKeys(m.Plans) {
+		writeChecksum(h, m.Plans[k], path.Join(prefix, "plans", k))
+	}
+}
+
+func writeChecksumFiles(h hash.Hash, base string, files map[string][]byte) {
+	keys := make([]string, 0, len(files))
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeChecksumEntry(h, path.Join(base, k), files[k])
+	}
+}
+
+func writeChecksumEntry(h hash.Hash, name string, b []byte) {
+	// sha256 writes never fail
+	sum := sha256.Sum256(b)
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write(sum[:])
+}
+
+func sortedKeys(plans map[string]*Manifest) []string {
+	keys := make([]string, 0, len(plans))
+	for k := range plans {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -12,6 +12,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/ghodss/yaml"
 )
 
 var allDirs = []string{
@@ -33,11 +35,15 @@ type Manifest struct {
 	Secrets    map[string][]byte    `json:"secrets,omitempty"`
 }
 
+// Metadata describes a manifest. It is read from polyester.yaml in the root
+// of the manifest directory, if it exists.
 type Metadata struct {
 	Name    string `json:"name,omitempty"`
 	Version string `json:"version,omitempty"`
 }
 
+const metadataFile = "polyester.yaml"
+
 func LoadDir(dir string) (*Manifest, error) {
 	if dir == "" {
 		dir = "."
@@ -83,6 +89,15 @@ func SaveDir(dir string, m *Manifest) error {
 	if err := os.WriteFile(filepath.Join(dir, m.Main), m.MainScript, 0644); err != nil {
 		return err
 	}
+	if m.Metadata != nil {
+		b, err := yaml.Marshal(m.Metadata)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, metadataFile), b, 0644); err != nil {
+			return err
+		}
+	}
 
 	if len(m.Files) > 0 {
 		filesDir := filepath.Join(dir, "files")
@@ -150,7 +165,12 @@ func loadFS(mfs fs.FS, mainPath string) (*Manifest, error) {
 	if err != nil {
 		return nil, fmt.Errorf("manifest: gather plans failed: %w", err)
 	}
+	meta, err := loadMetadataFS(mfs)
+	if err != nil {
+		return nil, err
+	}
 	m := &Manifest{
+		Metadata:   meta,
 		Main:       mainPath,
 		MainScript: b,
 		Plans:      plans,
@@ -161,6 +181,21 @@ func loadFS(mfs fs.FS, mainPath string) (*Manifest, error) {
 	return m, nil
 }
 
+func loadMetadataFS(mfs fs.FS) (*Metadata, error) {
+	b, err := fs.ReadFile(mfs, metadataFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	meta := &Metadata{}
+	if err := yaml.Unmarshal(b, meta); err != nil {
+		return nil, fmt.Errorf("manifest: failed to read %s: %w", metadataFile, err)
+	}
+	return meta, nil
+}
+
 func gatherPlansFS(mfs fs.FS) (map[string]*Manifest, error) {
 	if _, err := fs.Stat(mfs, "plans"); err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
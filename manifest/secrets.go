@@ -0,0 +1,168 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+)
+
+const (
+	// SecretExt is the extension of age-encrypted secret files.
+	SecretExt = ".age"
+	// RecipientsFile lists the age recipients secrets in its directory are
+	// encrypted to, one per line. Plan secrets directories without one use
+	// the manifest's.
+	RecipientsFile = ".recipients"
+	// secretsIgnore is written to each secrets directory so plaintext can't
+	// be committed by accident.
+	secretsIgnore = "*\n!.gitignore\n!" + RecipientsFile + "\n!*" + SecretExt + "\n!*/\n"
+)
+
+// Secret is an age-encrypted file in a manifest's secrets directory.
+type Secret struct {
+	// Path is the path to the encrypted file, relative to the manifest.
+	Path string
+	// Dir is the secrets directory containing the file, relative to the
+	// manifest.
+	Dir string
+	// Name is the path of the file relative to Dir, without the .age
+	// extension. It is the key templates use to read the secret.
+	Name string
+}
+
+// SecretDirs returns the secrets directory of the manifest in dir, followed by
+// each plan's, relative to dir. Only directories that exist are returned.
+func SecretDirs(dir string) ([]string, error) {
+	var res []string
+	if isDir(filepath.Join(dir, "secrets")) {
+		res = append(res, "secrets")
+	}
+	plans, err := os.ReadDir(filepath.Join(dir, "plans"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, plan := range plans {
+		p := filepath.Join("plans", plan.Name(), "secrets")
+		if plan.IsDir() && isDir(filepath.Join(dir, p)) {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+func isDir(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
+
+// ListSecrets returns every encrypted secret in the manifest in dir, along
+// with any other files in its secrets directories, which are plaintext that
+// shouldn't be committed. Paths are relative to dir.
+func ListSecrets(dir string) ([]Secret, []string, error) {
+	secretDirs, err := SecretDirs(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var secrets []Secret
+	var plaintext []string
+	for _, sdir := range secretDirs {
+		root := filepath.Join(dir, sdir)
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			switch {
+			case filepath.Ext(p) == SecretExt:
+				secrets = append(secrets, Secret{
+					Path: filepath.Join(sdir, rel),
+					Dir:  sdir,
+					Name: strings.TrimSuffix(rel, SecretExt),
+				})
+			case rel != RecipientsFile && rel != ".gitignore":
+				plaintext = append(plaintext, filepath.Join(sdir, rel))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Path < secrets[j].Path })
+	sort.Strings(plaintext)
+	return secrets, plaintext, nil
+}
+
+// RecipientsPath returns the recipients file used for secretsDir, which is
+// relative to the manifest in dir. Plan secrets directories without their own
+// recipients file use the manifest's.
+func RecipientsPath(dir, secretsDir string) string {
+	p := filepath.Join(secretsDir, RecipientsFile)
+	if _, err := os.Stat(filepath.Join(dir, p)); err != nil && secretsDir != "secrets" {
+		return filepath.Join("secrets", RecipientsFile)
+	}
+	return p
+}
+
+// ReadRecipients returns the recipients, and the lines they were parsed from,
+// of the recipients file at p. A missing file has no recipients.
+func ReadRecipients(p string) ([]age.Recipient, []string, error) {
+	b, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil, nil, nil
+	}
+	recipients, err := age.ParseRecipients(bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, fmt.Errorf("manifest: invalid recipients in %s: %w", p, err)
+	}
+	return recipients, lines, nil
+}
+
+// WriteRecipients writes the recipients file at p.
+func WriteRecipients(p string, lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// ProtectSecretsDir writes a .gitignore to secretsDir that ignores everything
+// but encrypted secrets and recipients, if it doesn't already have one.
+func ProtectSecretsDir(secretsDir string) error {
+	if err := os.MkdirAll(secretsDir, 0755); err != nil {
+		return err
+	}
+	p := filepath.Join(secretsDir, ".gitignore")
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+	return os.WriteFile(p, []byte(secretsIgnore), 0644)
+}
@@ -0,0 +1,77 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestListSecrets(t *testing.T) {
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "template"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+	dir := filepath.Join(tmpdir, "manifest")
+
+	if err := ProtectSecretsDir(filepath.Join(dir, "secrets")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "plans", "nice", "secrets", "oops"), []byte("plaintext"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	secrets, plaintext, err := ListSecrets(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, secret := range secrets {
+		names = append(names, secret.Dir+":"+secret.Name)
+	}
+	expectNames := []string{"plans/nice/secrets:with.ext", "plans/nice/secrets:wow", "secrets:wow"}
+	if !reflect.DeepEqual(names, expectNames) {
+		t.Errorf("expected secrets %v, got %v", expectNames, names)
+	}
+	expectPlaintext := []string{"plans/nice/secrets/oops", "plans/nice/secrets/with.ext", "secrets/wow"}
+	if !reflect.DeepEqual(plaintext, expectPlaintext) {
+		t.Errorf("expected plaintext %v, got %v", expectPlaintext, plaintext)
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	dir := testenv.TempDir(t, "")
+	defer testenv.RemoveOnSuccess(t, dir)
+	root := filepath.Join(dir, "secrets", RecipientsFile)
+	lines := []string{
+		"age14w5fxe7q9838em9rnp674twmh3pg53yjmepc5z70hwq4se65su3sehlu7e",
+		"age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p",
+	}
+	if err := WriteRecipients(root, lines); err != nil {
+		t.Fatal(err)
+	}
+
+	planDir := filepath.Join("plans", "nice", "secrets")
+	if p := RecipientsPath(dir, planDir); p != filepath.Join("secrets", RecipientsFile) {
+		t.Errorf("expected plan to use the manifest recipients, got %s", p)
+	}
+	if err := WriteRecipients(filepath.Join(dir, planDir, RecipientsFile), lines[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if p := RecipientsPath(dir, planDir); p != filepath.Join(planDir, RecipientsFile) {
+		t.Errorf("expected plan to use its own recipients, got %s", p)
+	}
+
+	recipients, readLines, err := ReadRecipients(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipients) != 2 || !reflect.DeepEqual(readLines, lines) {
+		t.Errorf("expected recipients %v, got %v", lines, readLines)
+	}
+
+	recipients, _, err = ReadRecipients(filepath.Join(dir, "missing"))
+	if err != nil || recipients != nil {
+		t.Errorf("expected no recipients for a missing file, got %v, %v", recipients, err)
+	}
+}
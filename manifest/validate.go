@@ -1,5 +1,22 @@
 package manifest
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 func (m *Manifest) Validate() error {
+	if meta := m.Metadata; meta != nil {
+		if meta.Name == "" {
+			return errors.New("metadata name is required")
+		}
+		if meta.Version == "" {
+			return errors.New("metadata version is required")
+		}
+		if strings.ContainsAny(meta.Name+meta.Version, `/\`) {
+			return fmt.Errorf("metadata name and version cannot contain path separators: %s-%s", meta.Name, meta.Version)
+		}
+	}
 	return nil
 }
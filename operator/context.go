@@ -6,11 +6,15 @@ import (
 
 	"github.com/jeffrom/polyester/operator/opfs"
 	"github.com/jeffrom/polyester/operator/templates"
+	"github.com/jeffrom/polyester/state"
 )
 
 type ctxKey string
 
-var gotStateKey = ctxKey("gotState")
+var (
+	gotStateKey  = ctxKey("gotState")
+	prevStateKey = ctxKey("prevState")
+)
 
 type Context struct {
 	context.Context
@@ -70,6 +74,25 @@ func (c Context) GotState() bool {
 	return c.Context.Value(gotStateKey).(bool)
 }
 
+// WithPrevState returns a copy of the context holding the state the operation
+// had after it was last applied, so Run can tell what changed since.
+func (c Context) WithPrevState(st state.State) Context {
+	return Context{
+		Context:   context.WithValue(c.Context, prevStateKey, st),
+		Opts:      c.Opts,
+		FS:        c.FS,
+		PlanDir:   c.PlanDir,
+		Templates: c.Templates,
+	}
+}
+
+// PrevState returns the state set with WithPrevState. It is empty if the
+// operation hasn't been applied before.
+func (c Context) PrevState() state.State {
+	st, _ := c.Context.Value(prevStateKey).(state.State)
+	return st
+}
+
 type FS interface {
 	fs.StatFS
 	fs.GlobFS
@@ -20,6 +20,7 @@ type AtomicCopyOpts struct {
 	Sources      []string `json:"sources"`
 	Dest         string   `json:"dest"`
 	ExcludeGlobs []string `json:"exclude,omitempty"`
+	PermOpts
 }
 
 type AtomicCopy struct {
@@ -29,7 +30,10 @@ type AtomicCopy struct {
 func (op AtomicCopy) String() string {
 	opts := op.Args.(*AtomicCopyOpts)
 
-	return fmt.Sprintf("%s%s%s",
+	perms := opts.PermOpts.String()
+	return fmt.Sprintf("%s%s%s%s%s",
+		perms,
+		padArg(perms != ""),
 		strings.Join(opts.Sources, " "),
 		padArg(true),
 		opts.Dest,
@@ -90,6 +94,7 @@ atomic copy is the same in this case.
 
 	flags := cmd.Flags()
 	flags.StringArrayVar(&opts.ExcludeGlobs, "exclude", nil, "`glob`s to exclude from destination")
+	addPermFlags(cmd, &opts.PermOpts)
 
 	return &operator.InfoData{
 		OpName: "atomic-copy",
@@ -172,6 +177,11 @@ func (op AtomicCopy) Run(octx operator.Context) error {
 	_, srcFile := filepath.Split(srcPath)
 	src := filepath.Join(tmpDir, srcFile)
 
+	// set permissions before the move so dest is never visible without them.
+	if err := opts.PermOpts.applyPaths(src); err != nil {
+		return err
+	}
+
 	destInfo, err := octx.FS.Stat(opts.Dest)
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
@@ -0,0 +1,83 @@
+package fileop
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/opfs"
+)
+
+// WriteFileAtomic writes b to dest with mode, so dest is never partially
+// written. The owner of an existing file is kept.
+func WriteFileAtomic(dest string, b []byte, mode fs.FileMode) error {
+	prev, err := os.Stat(dest)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return writeFileAtomic(dest, b, mode, prev, PermOpts{})
+}
+
+// WriteFileAtomicPerms is WriteFileAtomic for files whose ownership and mode
+// are set by perms. They are set before dest is replaced, so dest never has
+// other permissions.
+func WriteFileAtomicPerms(dest string, b []byte, mode fs.FileMode, perms PermOpts) error {
+	prev, err := os.Stat(dest)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return writeFileAtomic(dest, b, mode, prev, perms)
+}
+
+// WriteIfChanged writes b to p, relative to octx.FS, if its contents are
+// different, and reports whether it did.
+func WriteIfChanged(octx operator.Context, p string, b []byte, mode fs.FileMode) (bool, error) {
+	curr, err := octx.FS.ReadFile(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err == nil && bytes.Equal(curr, b) {
+		return false, nil
+	}
+	dest := octx.FS.Join(p)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return false, err
+	}
+	return true, WriteFileAtomic(dest, b, mode)
+}
+
+// writeFileAtomic writes a temporary file next to dest, then moves it over
+// dest, so dest is never partially written. The mode and owner of prev, the
+// current file, are kept unless perms overrides them.
+func writeFileAtomic(dest string, b []byte, mode fs.FileMode, prev fs.FileInfo, perms PermOpts) error {
+	dir, base := filepath.Split(dest)
+	f, err := os.CreateTemp(dir, "."+base+".polyester-")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		return err
+	}
+	if uid, gid, ok := opfs.Owner(prev); ok {
+		if err := os.Lchown(tmp, int(uid), int(gid)); err != nil {
+			return err
+		}
+	}
+	if err := perms.applyPaths(tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
@@ -1,6 +1,8 @@
 package fileop
 
 import (
+	"path/filepath"
+
 	"github.com/spf13/cobra"
 
 	"github.com/jeffrom/polyester/operator"
@@ -11,6 +13,7 @@ type CopyOpts struct {
 	Sources      []string `json:"sources"`
 	Dest         string   `json:"dest"`
 	ExcludeGlobs []string `json:"exclude,omitempty"`
+	PermOpts
 }
 
 type Copy struct {
@@ -34,6 +37,7 @@ To copy files out of the plan directory, use pcopy.
 	}
 	flags := cmd.Flags()
 	flags.StringArrayVar(&opts.ExcludeGlobs, "exclude", nil, "`glob`s to exclude from destination")
+	addPermFlags(cmd, &opts.PermOpts)
 
 	return &operator.InfoData{
 		OpName: "copy",
@@ -62,11 +66,65 @@ func (op Copy) Run(octx operator.Context) error {
 		return err
 	}
 
+	targets, err := copyTargets(octx.FS, octx.FS, allFiles, opts.Dest)
+	if err != nil {
+		return err
+	}
+
 	joinedFiles := make([]string, len(allFiles))
 	for i, file := range allFiles {
 		joinedFiles[i] = octx.FS.Join(file)
 	}
-	return copyOneOrManyFiles(octx.FS, octx.FS.Join(opts.Dest), joinedFiles)
+	if err := copyOneOrManyFiles(octx.FS, octx.FS.Join(opts.Dest), joinedFiles); err != nil {
+		return err
+	}
+	return opts.PermOpts.Apply(octx.FS, targets...)
+}
+
+// DesiredContents returns the contents of each file that would be copied,
+// keyed by its destination.
+func (op Copy) DesiredContents(octx operator.Context) ([]operator.DesiredContent, error) {
+	opts := op.Args.(*CopyOpts)
+	sources, err := gatherFilesGlobDirOnly(octx.FS, opts.Sources, opts.ExcludeGlobs)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := copyTargets(octx.FS, octx.FS, sources, opts.Dest)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []operator.DesiredContent
+	for i, src := range sources {
+		dest := targets[i]
+		files, err := gatherFilesDir(octx.FS, []string{src}, opts.ExcludeGlobs)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			info, err := octx.FS.Stat(file)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				continue
+			}
+			b, err := octx.FS.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			rel, err := filepath.Rel(src, file)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, operator.DesiredContent{
+				Path:     filepath.Join(dest, rel),
+				Contents: b,
+			})
+		}
+	}
+	return res, nil
 }
 
 func copyArgs(cmd *cobra.Command, args []string, target interface{}) error {
@@ -2,8 +2,10 @@ package fileop
 
 import (
 	"context"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 
 	"github.com/jeffrom/polyester/operator"
@@ -115,3 +117,45 @@ func destSrc(dest string, sources ...string) *CopyOpts {
 }
 
 func strs(s ...string) []string { return s }
+
+func TestCopyPerms(t *testing.T) {
+	tmpdir := testenv.TempDir(t, "")
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+	testenv.Mkdirs(t, 0755, filepath.Join(tmpdir, "adir", "nested"))
+	testenv.WriteFile(t, filepath.Join(tmpdir, "adir", "afile"), "a")
+	testenv.WriteFile(t, filepath.Join(tmpdir, "adir", "nested", "bfile"), "b")
+
+	opts := destSrc("/dest", "/adir")
+	opts.PermOpts = PermOpts{
+		Owner:    strconv.Itoa(os.Getuid()),
+		Group:    strconv.Itoa(os.Getgid()),
+		Mode:     0700,
+		DirMode:  0750,
+		FileMode: 0600,
+	}
+	ofs := opfs.New(tmpdir)
+	octx := operator.NewContext(context.Background(), ofs, nil, nil)
+	if err := (&Copy{Args: opts}).Run(octx); err != nil {
+		t.Fatal("copy failed:", err)
+	}
+
+	expectModes := map[string]fs.FileMode{
+		"/dest":              0700,
+		"/dest/nested":       0750,
+		"/dest/afile":        0600,
+		"/dest/nested/bfile": 0600,
+	}
+	for p, mode := range expectModes {
+		info, err := os.Stat(ofs.Join(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("expected %s to have mode %s, got %s", p, mode, info.Mode().Perm())
+		}
+		uid, gid, ok := opfs.Owner(info)
+		if !ok || int(uid) != os.Getuid() || int(gid) != os.Getgid() {
+			t.Errorf("expected %s to be owned by %d:%d, got %d:%d", p, os.Getuid(), os.Getgid(), uid, gid)
+		}
+	}
+}
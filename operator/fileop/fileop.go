@@ -39,6 +39,32 @@ func ChecksumReader(r io.Reader) ([]byte, error) {
 	return sha.Sum(nil), nil
 }
 
+// ChecksumEntry returns a state entry named p with the checksum of the file at
+// p, relative to octx.FS. The entry has no file if p doesn't exist or is a
+// directory.
+func ChecksumEntry(octx operator.Context, p string) (state.Entry, error) {
+	info, err := octx.FS.Stat(p)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return state.Entry{}, err
+	}
+	entry := state.Entry{Name: p}
+	if info == nil || info.IsDir() {
+		return entry, nil
+	}
+	checksum, err := Checksum(octx.FS.Join(p))
+	if err != nil {
+		return entry, err
+	}
+	entry.File = &opfs.StateFileEntry{
+		SHA256: checksum,
+		Info: opfs.StateFileInfo{
+			RawName: p,
+			SHA256:  checksum,
+		},
+	}
+	return entry, nil
+}
+
 func getStateFileGlobs(ofs operator.FS, st state.State, dest string, globs, excludes []string) (state.State, error) {
 	allFiles, err := gatherFilesGlob(ofs, globs, excludes)
 	if err != nil {
@@ -198,6 +224,32 @@ func copyOneOrManyFiles(ofs operator.FS, destFile string, sources []string) erro
 	return copyManyFiles(ofs, sources, destFile)
 }
 
+// copyTargets returns the path each source will be copied to by
+// copyOneOrManyFiles. It must be called before copying, since it depends on
+// whether dest already exists.
+func copyTargets(srcFS, destFS operator.FS, sources []string, dest string) ([]string, error) {
+	if len(sources) != 1 {
+		targets := make([]string, len(sources))
+		for i, src := range sources {
+			targets[i] = filepath.Join(dest, filepath.Base(src))
+		}
+		return targets, nil
+	}
+
+	srcInfo, err := srcFS.Stat(sources[0])
+	if err != nil {
+		return nil, err
+	}
+	destInfo, err := destFS.Stat(dest)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if destInfo != nil && destInfo.IsDir() && !srcInfo.IsDir() {
+		return []string{filepath.Join(dest, filepath.Base(sources[0]))}, nil
+	}
+	return []string{dest}, nil
+}
+
 func copyOneFile(ofs operator.FS, file, destFile string) error {
 	// fmt.Println("copyOneFile", file, destFile)
 	srcInfo, err := ofs.Stat(file)
@@ -0,0 +1,435 @@
+package fileop
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/opfs"
+	"github.com/jeffrom/polyester/state"
+)
+
+const defaultBlockMarker = "POLYESTER MANAGED BLOCK"
+
+type LineOpts struct {
+	Path         string `json:"path"`
+	Line         string `json:"line,omitempty"`
+	Regexp       string `json:"regexp,omitempty"`
+	InsertAfter  string `json:"insert_after,omitempty"`
+	InsertBefore string `json:"insert_before,omitempty"`
+	Absent       bool   `json:"absent,omitempty"`
+	Block        bool   `json:"block,omitempty"`
+	Marker       string `json:"marker,omitempty"`
+	Comment      string `json:"comment,omitempty"`
+	Create       bool   `json:"create,omitempty"`
+	PermOpts
+}
+
+type Line struct {
+	Args interface{}
+}
+
+func (op Line) String() string {
+	opts := op.Args.(*LineOpts)
+	label := "line"
+	if opts.Block {
+		label = "block " + opts.Marker
+	}
+	if opts.Absent {
+		label = "absent " + label
+	}
+	return fmt.Sprintf("%s: %s", opts.Path, label)
+}
+
+func (op Line) Info() operator.Info {
+	opts := op.Args.(*LineOpts)
+
+	cmd := &cobra.Command{
+		Use:   "line file [line]",
+		Args:  cobra.RangeArgs(1, 2),
+		Short: "ensures a line or block is in a file",
+		Long: `Ensures a line, or a block of lines, is present in or absent from a file,
+leaving the rest of the file alone.
+
+With --regexp, the last line matching the expression is replaced with line.
+Otherwise, if the line isn't already in the file, it is inserted after the last
+line matching --insert-after, before the first line matching --insert-before,
+or at the end of the file.
+
+With --block, line is a block of lines written between marker comments:
+
+  # BEGIN POLYESTER MANAGED BLOCK
+  line
+  # END POLYESTER MANAGED BLOCK
+
+The block is replaced as a whole whenever it changes. Use a different --marker
+for each block in a file.
+
+With --absent, lines matching --regexp, or equal to line, are removed. With
+--absent --block, the block and its markers are removed.
+
+The file is written atomically, keeping its mode and owner unless --mode,
+--owner or --group are set. It must exist unless --create is set.`,
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.Regexp, "regexp", "r", "", "replace the last line matching `regexp`")
+	flags.StringVar(&opts.InsertAfter, "insert-after", "", "insert after the last line matching `regexp`")
+	flags.StringVar(&opts.InsertBefore, "insert-before", "", "insert before the first line matching `regexp`")
+	flags.BoolVar(&opts.Absent, "absent", false, "remove the line or block")
+	flags.BoolVar(&opts.Block, "block", false, "manage a block of lines between marker comments")
+	flags.StringVar(&opts.Marker, "marker", defaultBlockMarker, "the `name` in the block's marker comments")
+	flags.StringVar(&opts.Comment, "comment", "#", "the comment `prefix` for block markers")
+	flags.BoolVar(&opts.Create, "create", false, "create the file if it doesn't exist")
+	AddFilePermFlags(cmd, &opts.PermOpts)
+
+	return &operator.InfoData{
+		OpName: "line",
+		Command: &operator.Command{
+			Command:   cmd,
+			ApplyArgs: lineArgs,
+			Target:    opts,
+		},
+	}
+}
+
+func (op Line) Validate(octx operator.Context, targ interface{}, evaluated bool) error {
+	opts := targ.(*LineOpts)
+	var errs operator.Errors
+	if opts.InsertAfter != "" && opts.InsertBefore != "" {
+		errs.Add(errors.New("line: only one of --insert-after and --insert-before can be used"))
+	}
+	if opts.Block && opts.Regexp != "" {
+		errs.Add(errors.New("line: --regexp can't be used with --block"))
+	}
+	if !opts.Absent && opts.Line == "" && !opts.Block {
+		errs.Add(errors.New("line: line is required"))
+	}
+	if opts.Absent && !opts.Block && opts.Line == "" && opts.Regexp == "" {
+		errs.Add(errors.New("line: --absent requires line or --regexp"))
+	}
+	_, err := opts.compile()
+	errs.Add(err)
+	return errs.Err()
+}
+
+// lineEditor edits file contents for LineOpts.
+type lineEditor struct {
+	opts         *LineOpts
+	re           *regexp.Regexp
+	insertAfter  *regexp.Regexp
+	insertBefore *regexp.Regexp
+}
+
+func (opts *LineOpts) compile() (*lineEditor, error) {
+	ed := &lineEditor{opts: opts}
+	var err error
+	if ed.re, err = compileOptional("--regexp", opts.Regexp); err != nil {
+		return nil, err
+	}
+	if ed.insertAfter, err = compileOptional("--insert-after", opts.InsertAfter); err != nil {
+		return nil, err
+	}
+	if ed.insertBefore, err = compileOptional("--insert-before", opts.InsertBefore); err != nil {
+		return nil, err
+	}
+	return ed, nil
+}
+
+func compileOptional(name, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("line: invalid %s: %w", name, err)
+	}
+	return re, nil
+}
+
+// edit returns b with the line or block present or absent. If nothing needs
+// to change, b is returned as is.
+func (ed *lineEditor) edit(b []byte) []byte {
+	lines := splitLines(b)
+	var next []string
+	var changed bool
+	if ed.opts.Block {
+		next, changed = ed.editBlock(lines)
+	} else {
+		next, changed = ed.editLine(lines)
+	}
+	if !changed {
+		return b
+	}
+	return joinLines(next)
+}
+
+func (ed *lineEditor) editLine(lines []string) ([]string, bool) {
+	opts := ed.opts
+	if opts.Absent {
+		var next []string
+		for _, line := range lines {
+			if (ed.re != nil && ed.re.MatchString(line)) || (ed.re == nil && line == opts.Line) {
+				continue
+			}
+			next = append(next, line)
+		}
+		return next, len(next) != len(lines)
+	}
+
+	if ed.re != nil {
+		for i := len(lines) - 1; i >= 0; i-- {
+			if !ed.re.MatchString(lines[i]) {
+				continue
+			}
+			if lines[i] == opts.Line {
+				return lines, false
+			}
+			next := append([]string{}, lines...)
+			next[i] = opts.Line
+			return next, true
+		}
+	}
+	for _, line := range lines {
+		if line == opts.Line {
+			return lines, false
+		}
+	}
+	return ed.insert(lines, []string{opts.Line}), true
+}
+
+func (ed *lineEditor) editBlock(lines []string) ([]string, bool) {
+	opts := ed.opts
+	begin := fmt.Sprintf("%s BEGIN %s", opts.Comment, opts.Marker)
+	end := fmt.Sprintf("%s END %s", opts.Comment, opts.Marker)
+
+	start, stop := -1, -1
+	for i, line := range lines {
+		if start == -1 && line == begin {
+			start = i
+		} else if start != -1 && line == end {
+			stop = i
+			break
+		}
+	}
+	found := start != -1 && stop != -1
+
+	if opts.Absent {
+		if !found {
+			return lines, false
+		}
+		next := append([]string{}, lines[:start]...)
+		return append(next, lines[stop+1:]...), true
+	}
+
+	block := []string{begin}
+	if opts.Line != "" {
+		block = append(block, strings.Split(strings.TrimSuffix(opts.Line, "\n"), "\n")...)
+	}
+	block = append(block, end)
+	if !found {
+		return ed.insert(lines, block), true
+	}
+	if equalLines(lines[start:stop+1], block) {
+		return lines, false
+	}
+	next := append([]string{}, lines[:start]...)
+	next = append(next, block...)
+	return append(next, lines[stop+1:]...), true
+}
+
+// insert inserts added after the last line matching --insert-after, before
+// the first line matching --insert-before, or at the end.
+func (ed *lineEditor) insert(lines, added []string) []string {
+	at := len(lines)
+	if ed.insertAfter != nil {
+		for i := len(lines) - 1; i >= 0; i-- {
+			if ed.insertAfter.MatchString(lines[i]) {
+				at = i + 1
+				break
+			}
+		}
+	} else if ed.insertBefore != nil {
+		for i, line := range lines {
+			if ed.insertBefore.MatchString(line) {
+				at = i
+				break
+			}
+		}
+	}
+
+	next := make([]string, 0, len(lines)+len(added))
+	next = append(next, lines[:at]...)
+	next = append(next, added...)
+	return append(next, lines[at:]...)
+}
+
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func joinLines(lines []string) []byte {
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetState returns whether the file already contains the desired line or
+// block, and the file's mode and uid/gid when --mode, --owner or --group
+// manage them.
+func (op Line) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*LineOpts)
+	st := state.State{}
+	satisfied, err := op.satisfied(octx)
+	if err != nil {
+		return st, err
+	}
+	kv := map[string]interface{}{"satisfied": satisfied}
+	if err := op.permState(octx, kv); err != nil {
+		return st, err
+	}
+	return st.Append(state.Entry{Name: opts.Path, KV: kv}), nil
+}
+
+// DesiredState is the same as GetState, since after the line is applied the
+// file always contains it and has the requested mode and owner, and so does
+// the previous state. It is implemented so the operation is dirty whenever
+// the file no longer contains the line, or its perms were changed by hand,
+// even though the line arguments haven't changed.
+func (op Line) DesiredState(octx operator.Context) (state.State, error) {
+	return op.GetState(octx)
+}
+
+// permState adds the mode and uid/gid of the file to kv, for those managed by
+// the operation. They are strings so they compare the same after the state is
+// read back from JSON.
+func (op Line) permState(octx operator.Context, kv map[string]interface{}) error {
+	opts := op.Args.(*LineOpts)
+	if opts.Mode == 0 && opts.Owner == "" && opts.Group == "" {
+		return nil
+	}
+	info, err := octx.FS.Stat(opts.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if opts.Mode != 0 {
+		kv["mode"] = fmt.Sprintf("%#o", info.Mode().Perm())
+	}
+	if uid, gid, ok := opfs.Owner(info); ok {
+		if opts.Owner != "" {
+			kv["uid"] = strconv.FormatUint(uint64(uid), 10)
+		}
+		if opts.Group != "" {
+			kv["gid"] = strconv.FormatUint(uint64(gid), 10)
+		}
+	}
+	return nil
+}
+
+func (op Line) satisfied(octx operator.Context) (bool, error) {
+	opts := op.Args.(*LineOpts)
+	ed, err := opts.compile()
+	if err != nil {
+		return false, err
+	}
+	b, err := octx.FS.ReadFile(opts.Path)
+	if errors.Is(err, fs.ErrNotExist) || os.IsNotExist(err) {
+		// nothing needs to be removed from a file that doesn't exist.
+		return opts.Absent, nil
+	} else if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ed.edit(b), b), nil
+}
+
+// DesiredContents returns the file with the line or block applied.
+func (op Line) DesiredContents(octx operator.Context) ([]operator.DesiredContent, error) {
+	opts := op.Args.(*LineOpts)
+	ed, err := opts.compile()
+	if err != nil {
+		return nil, err
+	}
+	b, err := octx.FS.ReadFile(opts.Path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return []operator.DesiredContent{{Path: opts.Path, Contents: ed.edit(b)}}, nil
+}
+
+func (op Line) Run(octx operator.Context) error {
+	opts := op.Args.(*LineOpts)
+	ed, err := opts.compile()
+	if err != nil {
+		return err
+	}
+
+	var mode fs.FileMode = 0644
+	info, err := octx.FS.Stat(opts.Path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if info == nil && opts.Absent {
+		return nil
+	}
+	if info == nil && !opts.Create {
+		return fmt.Errorf("line: %s does not exist", opts.Path)
+	}
+	if info != nil && info.IsDir() {
+		return fmt.Errorf("line: %s is a directory", opts.Path)
+	}
+
+	var curr []byte
+	if info != nil {
+		mode = info.Mode().Perm()
+		curr, err = octx.FS.ReadFile(opts.Path)
+		if err != nil {
+			return err
+		}
+	}
+	next := ed.edit(curr)
+	if info != nil && bytes.Equal(next, curr) {
+		return opts.PermOpts.Apply(octx.FS, opts.Path)
+	}
+
+	dest := octx.FS.Join(opts.Path)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(dest, next, mode, info, opts.PermOpts)
+}
+
+func lineArgs(cmd *cobra.Command, args []string, target interface{}) error {
+	t := target.(*LineOpts)
+	t.Path = args[0]
+	if len(args) > 1 {
+		t.Line = args[1]
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package fileop
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/opfs"
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestLineEdit(t *testing.T) {
+	const conf = "# sysctl\nnet.ipv4.ip_forward = 0\nvm.swappiness = 60\n"
+	const blockConf = "a\n# BEGIN POLYESTER MANAGED BLOCK\nold\n# END POLYESTER MANAGED BLOCK\nb\n"
+	tcs := []struct {
+		name   string
+		opts   *LineOpts
+		input  string
+		expect string
+	}{
+		{
+			name:   "append",
+			opts:   &LineOpts{Line: "kernel.panic = 10"},
+			input:  conf,
+			expect: conf + "kernel.panic = 10\n",
+		},
+		{
+			name:   "present",
+			opts:   &LineOpts{Line: "vm.swappiness = 60"},
+			input:  conf,
+			expect: conf,
+		},
+		{
+			name:   "no-trailing-newline",
+			opts:   &LineOpts{Line: "b"},
+			input:  "a",
+			expect: "a\nb\n",
+		},
+		{
+			name:   "empty",
+			opts:   &LineOpts{Line: "a"},
+			expect: "a\n",
+		},
+		{
+			name:   "replace",
+			opts:   &LineOpts{Line: "net.ipv4.ip_forward = 1", Regexp: `^net\.ipv4\.ip_forward\s*=`},
+			input:  conf,
+			expect: "# sysctl\nnet.ipv4.ip_forward = 1\nvm.swappiness = 60\n",
+		},
+		{
+			name:   "replace-last",
+			opts:   &LineOpts{Line: "x = 3", Regexp: `^x =`},
+			input:  "x = 1\nx = 2\n",
+			expect: "x = 1\nx = 3\n",
+		},
+		{
+			name:   "replace-no-match",
+			opts:   &LineOpts{Line: "kernel.panic = 10", Regexp: `^kernel\.panic`},
+			input:  conf,
+			expect: conf + "kernel.panic = 10\n",
+		},
+		{
+			name:   "insert-after",
+			opts:   &LineOpts{Line: "new", InsertAfter: `^#`},
+			input:  conf,
+			expect: "# sysctl\nnew\nnet.ipv4.ip_forward = 0\nvm.swappiness = 60\n",
+		},
+		{
+			name:   "insert-before",
+			opts:   &LineOpts{Line: "new", InsertBefore: `^vm\.`},
+			input:  conf,
+			expect: "# sysctl\nnet.ipv4.ip_forward = 0\nnew\nvm.swappiness = 60\n",
+		},
+		{
+			name:   "absent",
+			opts:   &LineOpts{Line: "vm.swappiness = 60", Absent: true},
+			input:  conf,
+			expect: "# sysctl\nnet.ipv4.ip_forward = 0\n",
+		},
+		{
+			name:   "absent-regexp",
+			opts:   &LineOpts{Regexp: `^(net|vm)\.`, Absent: true},
+			input:  conf,
+			expect: "# sysctl\n",
+		},
+		{
+			name:   "absent-missing",
+			opts:   &LineOpts{Line: "nope", Absent: true},
+			input:  conf,
+			expect: conf,
+		},
+		{
+			name:   "block-insert",
+			opts:   blockOpts("x\ny"),
+			input:  "a\n",
+			expect: "a\n# BEGIN POLYESTER MANAGED BLOCK\nx\ny\n# END POLYESTER MANAGED BLOCK\n",
+		},
+		{
+			name:   "block-replace",
+			opts:   blockOpts("new"),
+			input:  blockConf,
+			expect: "a\n# BEGIN POLYESTER MANAGED BLOCK\nnew\n# END POLYESTER MANAGED BLOCK\nb\n",
+		},
+		{
+			name:   "block-same",
+			opts:   blockOpts("old"),
+			input:  blockConf,
+			expect: blockConf,
+		},
+		{
+			name: "block-absent",
+			opts: &LineOpts{
+				Block:   true,
+				Absent:  true,
+				Marker:  defaultBlockMarker,
+				Comment: "#",
+			},
+			input:  blockConf,
+			expect: "a\nb\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ed, err := tc.opts.compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(ed.edit([]byte(tc.input)))
+			if got != tc.expect {
+				t.Errorf("expected:\n%q\ngot:\n%q", tc.expect, got)
+			}
+			if again := string(ed.edit([]byte(got))); again != got {
+				t.Errorf("expected edit to be idempotent, got:\n%q", again)
+			}
+		})
+	}
+}
+
+func TestLineRun(t *testing.T) {
+	tmpdir := testenv.TempDir(t, "")
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+	p := filepath.Join(tmpdir, "etc", "sysctl.conf")
+	testenv.Mkdirs(t, 0755, filepath.Dir(p))
+	testenv.WriteFile(t, p, "vm.swappiness = 60\n")
+	if err := os.Chmod(p, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	op := Line{Args: &LineOpts{Path: "/etc/sysctl.conf", Line: "vm.swappiness = 10", Regexp: `^vm\.swappiness`}}
+	octx := operator.NewContext(context.Background(), opfs.New(tmpdir), nil, nil)
+	st, err := op.GetState(octx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Entries[0].KV["satisfied"] != false {
+		t.Errorf("expected line not to be satisfied before running, got %+v", st)
+	}
+
+	if err := op.Run(octx); err != nil {
+		t.Fatal("line failed:", err)
+	}
+	if got := testenv.ReadFile(t, p); got != "vm.swappiness = 10\n" {
+		t.Errorf("unexpected contents: %q", got)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode to be kept, got %s", info.Mode())
+	}
+
+	st, err = op.GetState(octx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Entries[0].KV["satisfied"] != true {
+		t.Errorf("expected line to be satisfied after running, got %+v", st)
+	}
+
+	missing := Line{Args: &LineOpts{Path: "/etc/missing.conf", Line: "a"}}
+	if err := missing.Run(octx); err == nil {
+		t.Error("expected line to fail for a missing file without --create")
+	}
+}
+
+func TestLinePermsDrift(t *testing.T) {
+	tmpdir := testenv.TempDir(t, "")
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+	p := filepath.Join(tmpdir, "motd")
+	testenv.WriteFile(t, p, "hello\n")
+
+	gid := strconv.Itoa(os.Getgid())
+	op := Line{Args: &LineOpts{Path: "/motd", Line: "hello", PermOpts: PermOpts{Mode: 0600, Group: gid}}}
+	octx := operator.NewContext(context.Background(), opfs.New(tmpdir), nil, nil)
+	if err := op.Run(octx); err != nil {
+		t.Fatal("line failed:", err)
+	}
+	prev, err := op.GetState(octx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := prev.Entries[0].KV
+	if kv["mode"] != "0600" || kv["gid"] != gid {
+		t.Errorf("expected mode 0600 and gid %s in state, got %+v", gid, kv)
+	}
+	if _, ok := kv["uid"]; ok {
+		t.Errorf("expected uid not to be tracked without --owner, got %+v", kv)
+	}
+
+	desired, err := op.DesiredState(octx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev.Changed(desired) {
+		t.Errorf("expected no change after running, got %q", prev.Changes(desired))
+	}
+
+	// the line is still there, but the mode was changed by hand.
+	if err := os.Chmod(p, 0644); err != nil {
+		t.Fatal(err)
+	}
+	desired, err = op.DesiredState(octx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{`/motd: key "mode": 0600 -> 0644`}
+	if got := prev.Changes(desired); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected changes %q, got %q", expect, got)
+	}
+
+	if err := op.Run(octx); err != nil {
+		t.Fatal("line failed:", err)
+	}
+	if info, err := os.Stat(p); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode to be restored, got %s", info.Mode())
+	}
+}
+
+func blockOpts(block string) *LineOpts {
+	return &LineOpts{Line: block, Block: true, Marker: defaultBlockMarker, Comment: "#"}
+}
@@ -17,6 +17,8 @@ import (
 type MkdirOpts struct {
 	Dests []string `json:"dests"`
 	Mode  uint32   `json:"mode,omitempty"`
+	Owner string   `json:"owner,omitempty"`
+	Group string   `json:"group,omitempty"`
 }
 
 type Mkdir struct {
@@ -48,6 +50,7 @@ created (like mkdir -p).`,
 	}
 	flags := cmd.Flags()
 	flags.Uint32VarP(&opts.Mode, "mode", "m", 0755, "the mode to set the directory to")
+	addOwnerFlags(cmd, &opts.Owner, &opts.Group)
 
 	return &operator.InfoData{
 		OpName: "mkdir",
@@ -98,7 +101,7 @@ func (op Mkdir) Run(octx operator.Context) error {
 			return err
 		}
 	}
-	return nil
+	return chownPaths(octx.FS, opts.Owner, opts.Group, opts.Dests...)
 }
 
 func mkdirArgs(cmd *cobra.Command, args []string, target interface{}) error {
@@ -15,6 +15,7 @@ type PcopyOpts struct {
 	Sources      []string `json:"sources"`
 	Dest         string   `json:"dest"`
 	ExcludeGlobs []string `json:"exclude,omitempty"`
+	PermOpts
 }
 
 type Pcopy struct {
@@ -35,7 +36,7 @@ Copy files, resolving paths from the plan directory.
 	}
 	flags := cmd.Flags()
 	flags.StringArrayVar(&opts.ExcludeGlobs, "exclude", nil, "`glob`s to exclude from destination")
-	// TODO mode
+	addPermFlags(cmd, &opts.PermOpts)
 
 	return &operator.InfoData{
 		OpName: "pcopy",
@@ -47,6 +48,15 @@ Copy files, resolving paths from the plan directory.
 	}
 }
 
+func (op Pcopy) References(targ interface{}) []operator.Reference {
+	opts := targ.(*PcopyOpts)
+	refs := make([]operator.Reference, len(opts.Sources))
+	for i, src := range opts.Sources {
+		refs[i] = operator.Reference{Kind: "files", Path: src}
+	}
+	return refs
+}
+
 func (op Pcopy) GetState(octx operator.Context) (state.State, error) {
 	std := stdio.FromContext(octx.Context)
 	std.Debug("pcopy: GetState")
@@ -102,8 +112,15 @@ func (op Pcopy) Run(octx operator.Context) error {
 	for i, file := range sources {
 		joinedFiles[i] = octx.PlanDir.Join(file)
 	}
+	targets, err := copyTargets(octx.PlanDir, octx.FS, joinedFiles, opts.Dest)
+	if err != nil {
+		return err
+	}
 	// fmt.Println("copyOneOrManyFiles to:", opts.Dest, octx.FS.Join(opts.Dest))
-	return copyOneOrManyFiles(octx.PlanDir, octx.FS.Join(opts.Dest), joinedFiles)
+	if err := copyOneOrManyFiles(octx.PlanDir, octx.FS.Join(opts.Dest), joinedFiles); err != nil {
+		return err
+	}
+	return opts.PermOpts.Apply(octx.FS, targets...)
 }
 
 func pcopyArgs(cmd *cobra.Command, args []string, target interface{}) error {
@@ -0,0 +1,186 @@
+package fileop
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator"
+)
+
+// PermOpts sets the ownership and mode of the files an operator writes.
+type PermOpts struct {
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
+	// Mode is set on each destination.
+	Mode uint32 `json:"mode,omitempty"`
+	// DirMode and FileMode are set on each directory and file under a
+	// destination directory.
+	DirMode  uint32 `json:"dir_mode,omitempty"`
+	FileMode uint32 `json:"file_mode,omitempty"`
+}
+
+func addPermFlags(cmd *cobra.Command, opts *PermOpts) {
+	AddFilePermFlags(cmd, opts)
+	flags := cmd.Flags()
+	flags.Uint32Var(&opts.DirMode, "dir-mode", 0, "the mode to set directories under destination directories to")
+	flags.Uint32Var(&opts.FileMode, "file-mode", 0, "the mode to set files under destination directories to")
+}
+
+// AddFilePermFlags adds the --owner, --group and --mode flags, for operators
+// that only write files.
+func AddFilePermFlags(cmd *cobra.Command, opts *PermOpts) {
+	addOwnerFlags(cmd, &opts.Owner, &opts.Group)
+	cmd.Flags().Uint32VarP(&opts.Mode, "mode", "m", 0, "the mode to set each destination to")
+}
+
+func addOwnerFlags(cmd *cobra.Command, owner, group *string) {
+	flags := cmd.Flags()
+	flags.StringVar(owner, "owner", "", "the `user` name or id to own the destination(s)")
+	flags.StringVar(group, "group", "", "the `group` name or id to own the destination(s)")
+}
+
+func (p PermOpts) String() string {
+	var parts []string
+	if p.Owner != "" || p.Group != "" {
+		parts = append(parts, fmt.Sprintf("owner: %s:%s", p.Owner, p.Group))
+	}
+	if p.Mode != 0 {
+		parts = append(parts, fmt.Sprintf("mode: %s", fs.FileMode(p.Mode)))
+	}
+	if p.DirMode != 0 {
+		parts = append(parts, fmt.Sprintf("dir mode: %s", fs.FileMode(p.DirMode)))
+	}
+	if p.FileMode != 0 {
+		parts = append(parts, fmt.Sprintf("file mode: %s", fs.FileMode(p.FileMode)))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// Apply sets the ownership and mode of each destination. Ownership is set
+// recursively, as are DirMode and FileMode.
+func (p PermOpts) Apply(ofs operator.FS, dests ...string) error {
+	paths := make([]string, len(dests))
+	for i, dest := range dests {
+		paths[i] = ofs.Join(dest)
+	}
+	return p.applyPaths(paths...)
+}
+
+// applyPaths is Apply for paths that have already been joined to the
+// filesystem root.
+func (p PermOpts) applyPaths(paths ...string) error {
+	uid, gid, err := lookupOwner(p.Owner, p.Group)
+	if err != nil {
+		return err
+	}
+
+	for _, destPath := range paths {
+		info, err := os.Stat(destPath)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() && (p.DirMode != 0 || p.FileMode != 0 || uid != -1 || gid != -1) {
+			err := filepath.WalkDir(destPath, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if path == destPath {
+					return nil
+				}
+				return setPerms(path, d.IsDir(), 0, p.DirMode, p.FileMode, uid, gid)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := setPerms(destPath, info.IsDir(), p.Mode, p.DirMode, p.FileMode, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setPerms(path string, isDir bool, mode, dirMode, fileMode uint32, uid, gid int) error {
+	if mode == 0 && isDir {
+		mode = dirMode
+	} else if mode == 0 {
+		mode = fileMode
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, fs.FileMode(mode)); err != nil {
+			return err
+		}
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Lchown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chownPaths sets the ownership of each destination, if owner or group are
+// set.
+func chownPaths(ofs operator.FS, owner, group string, dests ...string) error {
+	uid, gid, err := lookupOwner(owner, group)
+	if err != nil {
+		return err
+	}
+	if uid == -1 && gid == -1 {
+		return nil
+	}
+	for _, dest := range dests {
+		if err := os.Lchown(ofs.Join(dest), uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupOwner resolves user and group names or ids. -1 is returned for
+// unset values, which os.Chown leaves unchanged.
+func lookupOwner(owner, group string) (int, int, error) {
+	uid, gid := -1, -1
+	if owner != "" {
+		id := owner
+		if _, err := strconv.Atoi(owner); err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return -1, -1, fmt.Errorf("fileop: unknown owner %q: %w", owner, err)
+			}
+			id = u.Uid
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return -1, -1, err
+		}
+		uid = n
+	}
+	if group != "" {
+		id := group
+		if _, err := strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, fmt.Errorf("fileop: unknown group %q: %w", group, err)
+			}
+			id = g.Gid
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return -1, -1, err
+		}
+		gid = n
+	}
+	return uid, gid, nil
+}
@@ -15,8 +15,10 @@ import (
 )
 
 type TouchOpts struct {
-	Mode uint32 `json:"mode,omitempty"`
-	Path string `json:"path"`
+	Mode  uint32 `json:"mode,omitempty"`
+	Path  string `json:"path"`
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
 }
 
 type Touch struct {
@@ -44,6 +46,7 @@ mtime`,
 	}
 	flags := cmd.Flags()
 	flags.Uint32VarP(&opts.Mode, "mode", "m", 0644, "the mode to set the file to")
+	addOwnerFlags(cmd, &opts.Owner, &opts.Group)
 
 	return &operator.InfoData{
 		OpName: "touch",
@@ -80,7 +83,7 @@ func (op Touch) Run(octx operator.Context) error {
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	} else if err == nil {
-		return nil
+		return chownPaths(octx.FS, opts.Owner, opts.Group, opts.Path)
 	}
 
 	dest := octx.FS.Join(opts.Path)
@@ -95,7 +98,7 @@ func (op Touch) Run(octx operator.Context) error {
 	if err := f.Close(); err != nil {
 		return err
 	}
-	return nil
+	return chownPaths(octx.FS, opts.Owner, opts.Group, opts.Path)
 }
 
 func touchArgs(cmd *cobra.Command, args []string, target interface{}) error {
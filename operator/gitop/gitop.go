@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/stdio"
 )
 
 func getCurrentCommit(octx operator.Context, repoDir string) (string, string, error) {
@@ -58,12 +59,13 @@ func getCurrentCommit(octx operator.Context, repoDir string) (string, string, er
 }
 
 func getLatestCommit(octx operator.Context, repoDir, ref string) (string, error) {
+	std := stdio.FromContext(octx.Context)
 	_, refName := filepath.Split(ref)
 	cmd := exec.CommandContext(octx.Context, "git", "rev-parse", "origin/"+refName)
-	fmt.Println("+", cmd.Args)
+	std.Info("+", cmd.Args)
 	cmd.Dir = repoDir
 	outb := &bytes.Buffer{}
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = std.Stderr()
 	cmd.Stdout = outb
 	if err := cmd.Run(); err != nil {
 		return "", err
@@ -76,11 +78,12 @@ func getLatestCommit(octx operator.Context, repoDir, ref string) (string, error)
 var remoteHeadRE = regexp.MustCompile(`HEAD branch: (.*)`)
 
 func getRemoteDefaultBranch(octx operator.Context, repoDir string) (string, error) {
+	std := stdio.FromContext(octx.Context)
 	cmd := exec.CommandContext(octx.Context, "git", "remote", "show", "origin")
-	fmt.Println("+", cmd.Args)
+	std.Info("+", cmd.Args)
 	cmd.Dir = repoDir
 	outb := &bytes.Buffer{}
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = std.Stderr()
 	cmd.Stdout = outb
 	if err := cmd.Run(); err != nil {
 		return "", err
@@ -70,8 +70,8 @@ func (op Repo) GetState(octx operator.Context) (state.State, error) {
 		if isatty.IsTerminal(os.Stdout.Fd()) {
 			cmd.Stdin = os.Stdin
 		}
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		cmd.Stdout = std.Stdout()
+		cmd.Stderr = std.Stderr()
 		std.Debug("+ git", cmd.Args)
 		if err := cmd.Run(); err != nil {
 			return st, err
@@ -117,8 +117,8 @@ func (op Repo) Run(octx operator.Context) error {
 		cmd := exec.CommandContext(ctx, "git", args...)
 		std.Info("+", cmd.Args)
 		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		cmd.Stdout = std.Stdout()
+		cmd.Stderr = std.Stderr()
 		if err := cmd.Run(); err != nil {
 			return err
 		}
@@ -127,8 +127,8 @@ func (op Repo) Run(octx operator.Context) error {
 		std.Info("+", cmd.Args)
 		cmd.Dir = octx.FS.Join(opts.Dest)
 		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		cmd.Stdout = std.Stdout()
+		cmd.Stderr = std.Stderr()
 		if err := cmd.Run(); err != nil {
 			return err
 		}
@@ -142,8 +142,8 @@ func (op Repo) Run(octx operator.Context) error {
 			std.Info("+", cmd.Args)
 			cmd.Dir = octx.FS.Join(opts.Dest)
 			cmd.Stdin = os.Stdin
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
+			cmd.Stdout = std.Stdout()
+			cmd.Stderr = std.Stderr()
 			if err := cmd.Run(); err != nil {
 				return err
 			}
@@ -2,7 +2,10 @@ package operator
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"strconv"
+	"strings"
 
 	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
@@ -17,6 +20,11 @@ type Info interface {
 type InfoData struct {
 	OpName  string   `json:"name"`
 	Command *Command `json:"command"`
+	// Notify are the names of the handlers to run at the end of the plan if
+	// the operation changes its target.
+	Notify []string `json:"notify,omitempty"`
+	// Source is where the operation was declared in the plan script.
+	Source *Source `json:"source,omitempty"`
 }
 
 func (id *InfoData) Copy() *InfoData {
@@ -38,8 +46,10 @@ func (id *InfoData) Encode(w io.Writer) error {
 		return err
 	}
 	pe := &PlanEntry{
-		Name: id.Name(),
-		Args: targetb,
+		Name:   id.Name(),
+		Args:   targetb,
+		Notify: id.Notify,
+		Source: id.Source,
 	}
 	b, err := yaml.Marshal(pe)
 	if err != nil {
@@ -64,6 +74,32 @@ type Command struct {
 }
 
 type PlanEntry struct {
-	Name string          `json:"name"`
-	Args json.RawMessage `json:"args,omitempty"`
+	Name   string          `json:"name"`
+	Args   json.RawMessage `json:"args,omitempty"`
+	Notify []string        `json:"notify,omitempty"`
+	Source *Source         `json:"source,omitempty"`
+}
+
+// Source is the position of the polyester call that declared an operation.
+type Source struct {
+	File string `json:"file"`
+	Line uint   `json:"line"`
+}
+
+// ParseSource parses a source in file:line form. It returns nil if s isn't
+// one.
+func ParseSource(s string) *Source {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return nil
+	}
+	line, err := strconv.ParseUint(s[i+1:], 10, 32)
+	if err != nil {
+		return nil
+	}
+	return &Source{File: s[:i], Line: uint(line)}
+}
+
+func (s Source) String() string {
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
 }
@@ -2,7 +2,13 @@
 // which gather state and make changes to an environment.
 package operator
 
-import "github.com/jeffrom/polyester/state"
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/jeffrom/polyester/state"
+)
 
 type Interface interface {
 	Info() Info
@@ -20,6 +26,33 @@ type Validator interface {
 	Validate(octx Context, targ interface{}, evaluated bool) error
 }
 
+// Errors collects every problem a Validator finds, so they can all be
+// reported at once.
+type Errors []error
+
+// Add adds err, if it isn't nil.
+func (errs *Errors) Add(err error) {
+	if err != nil {
+		*errs = append(*errs, err)
+	}
+}
+
+// Err returns errs, or nil if it is empty.
+func (errs Errors) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (errs Errors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
 // DesiredStater can be implemented by operators to make it possible to skip
 // operator.Run, mark the state unchanged, and still write the resulting state.
 // When this is implemented, the planner will run it before executing the
@@ -35,3 +68,57 @@ type DesiredStater interface {
 type ChangeDetector interface {
 	Changed(a, b state.State) (bool, error)
 }
+
+// DesiredContenter can be implemented by operators that write files, to return
+// the contents each destination file should have. Unlike DesiredState, the
+// contents are never written to state files. They are used to show how the
+// files on disk would change.
+type DesiredContenter interface {
+	DesiredContents(octx Context) ([]DesiredContent, error)
+}
+
+// Referencer can be implemented by operators that read files, templates or
+// vars from the manifest, so missing ones can be reported before the plan is
+// applied.
+type Referencer interface {
+	References(targ interface{}) []Reference
+}
+
+// Reference is a path, or glob, relative to a plan's files/, templates/ or
+// vars/ directory, as named by Kind.
+type Reference struct {
+	Kind string
+	Path string
+}
+
+// DesiredContent is the desired contents of a file. Path is relative to
+// Context.FS. Secrets are values that must be masked wherever the contents,
+// or the current contents of the file, are shown.
+type DesiredContent struct {
+	Path     string
+	Contents []byte
+	Secrets  [][]byte
+}
+
+// SecretMask replaces secret values in masked output.
+const SecretMask = "********"
+
+// Mask returns b with every secret value in dc.Secrets replaced by
+// SecretMask.
+func (dc DesiredContent) Mask(b []byte) []byte {
+	secrets := make([][]byte, 0, len(dc.Secrets))
+	for _, secret := range dc.Secrets {
+		// secret files commonly end with a newline that isn't part of the
+		// value as it's used in templates.
+		if secret = bytes.TrimSpace(secret); len(secret) > 0 {
+			secrets = append(secrets, secret)
+		}
+	}
+	// replace longer secrets first so a secret containing another is
+	// masked entirely.
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	for _, secret := range secrets {
+		b = bytes.ReplaceAll(b, secret, []byte(SecretMask))
+	}
+	return b
+}
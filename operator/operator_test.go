@@ -0,0 +1,18 @@
+package operator
+
+import "testing"
+
+func TestDesiredContentMask(t *testing.T) {
+	dc := DesiredContent{
+		Secrets: [][]byte{
+			[]byte("hunter2\n"),
+			[]byte("hunter22"),
+			[]byte(""),
+		},
+	}
+	got := string(dc.Mask([]byte("password: hunter2\nother: hunter22\n")))
+	expect := "password: ********\nother: ********\n"
+	if got != expect {
+		t.Errorf("expected %q, got %q", expect, got)
+	}
+}
@@ -30,6 +30,7 @@ func (f StateFileEntry) MarshalJSON() ([]byte, error) {
 		SHA256:     f.SHA256,
 		Contents:   f.Contents,
 	}
+	sfi.SetOwner(inf)
 	return json.Marshal(sfi)
 }
 
@@ -57,17 +58,20 @@ func (f *StateFileEntry) WithoutTimestamps() *StateFileEntry {
 		Contents: f.Contents,
 	}
 	if fi != nil {
-		sf.Info = StateFileInfo{
+		sfi := StateFileInfo{
 			RawName:  fi.Name(),
 			RawMode:  fi.Mode(),
 			RawSize:  fi.Size(),
 			SHA256:   f.SHA256,
 			Contents: f.Contents,
 		}
+		sfi.SetOwner(fi)
+		sf.Info = sfi
 	}
 	return sf
 }
 
+// ChecksumOnly returns the entry with only its checksum and owner.
 func (f *StateFileEntry) ChecksumOnly() *StateFileEntry {
 	if f == nil {
 		return nil
@@ -78,9 +82,11 @@ func (f *StateFileEntry) ChecksumOnly() *StateFileEntry {
 		SHA256: f.SHA256,
 	}
 	if fi != nil {
-		sf.Info = StateFileInfo{
+		sfi := StateFileInfo{
 			SHA256: f.SHA256,
 		}
+		sfi.SetOwner(fi)
+		sf.Info = sfi
 	}
 	return sf
 }
@@ -92,6 +98,8 @@ type StateFileInfo struct {
 	RawSize    int64       `json:"size,omitempty"`
 	SHA256     []byte      `json:"checksum,omitempty"`
 	Contents   []byte      `json:"contents,omitempty"`
+	RawUID     *uint32     `json:"uid,omitempty"`
+	RawGID     *uint32     `json:"gid,omitempty"`
 }
 
 func (sfi StateFileInfo) Name() string       { return sfi.RawName }
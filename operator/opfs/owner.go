@@ -0,0 +1,34 @@
+package opfs
+
+import "io/fs"
+
+// Owner returns the uid and gid of a file. ok is false if the owner isn't
+// known, such as for state recorded before ownership was tracked.
+func Owner(info fs.FileInfo) (uid, gid uint32, ok bool) {
+	switch sfi := info.(type) {
+	case nil:
+		return 0, 0, false
+	case StateFileInfo:
+		return sfi.owner()
+	case *StateFileInfo:
+		return sfi.owner()
+	}
+	return sysOwner(info)
+}
+
+func (sfi StateFileInfo) owner() (uint32, uint32, bool) {
+	if sfi.RawUID == nil || sfi.RawGID == nil {
+		return 0, 0, false
+	}
+	return *sfi.RawUID, *sfi.RawGID, true
+}
+
+// SetOwner records the owner of info, if it's known.
+func (sfi *StateFileInfo) SetOwner(info fs.FileInfo) {
+	uid, gid, ok := Owner(info)
+	if !ok {
+		sfi.RawUID, sfi.RawGID = nil, nil
+		return
+	}
+	sfi.RawUID, sfi.RawGID = &uid, &gid
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package opfs
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func sysOwner(info fs.FileInfo) (uint32, uint32, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return st.Uid, st.Gid, true
+}
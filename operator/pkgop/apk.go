@@ -0,0 +1,88 @@
+package pkgop
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"strings"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/state"
+)
+
+// apkInstalledDB is the database of installed packages apk maintains.
+var apkInstalledDB = "/lib/apk/db/installed"
+
+// ApkInstall installs packages with apk. Versions are pinned as name=version.
+type ApkInstall struct {
+	Args interface{}
+}
+
+func (op ApkInstall) Info() operator.Info {
+	return installInfo("apk-install", "installs packages using the apk package manager", op.Args.(*InstallOpts))
+}
+
+func (op ApkInstall) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*InstallOpts)
+	return installState(octx, apk{}, opts.Packages)
+}
+
+func (op ApkInstall) Run(octx operator.Context) error {
+	opts := op.Args.(*InstallOpts)
+	return apk{}.install(octx, parsePackages(opts.Packages))
+}
+
+// apk installs packages with apk. The installed packages are read from its
+// database, as apk's own output doesn't separate package names from their
+// versions. Nothing is installed if the database doesn't exist.
+type apk struct{}
+
+func (apk) installed(octx operator.Context, names []string) (map[string]interface{}, error) {
+	b, err := octx.FS.ReadFile(apkInstalledDB)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	all := parseApkInstalled(b)
+
+	installed := make(map[string]interface{})
+	for _, name := range names {
+		if version, ok := all[name]; ok {
+			installed[name] = version
+		}
+	}
+	return installed, nil
+}
+
+// parseApkInstalled returns the version of each package in an apk installed
+// database. Each package is a block of lines separated by an empty line, where
+// the P: line is its name and the V: line its version.
+func parseApkInstalled(b []byte) map[string]string {
+	res := make(map[string]string)
+	var name, version string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	flush := func() {
+		if name != "" {
+			res[name] = version
+		}
+		name, version = "", ""
+	}
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "P:"):
+			name = line[2:]
+		case strings.HasPrefix(line, "V:"):
+			version = line[2:]
+		}
+	}
+	flush()
+	return res
+}
+
+func (apk) install(octx operator.Context, pkgs []pkgSpec) error {
+	args := append([]string{"add", "--quiet"}, pinned(pkgs, "=")...)
+	return runInstall(octx, "apk", args...)
+}
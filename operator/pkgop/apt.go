@@ -4,14 +4,15 @@ import (
 	"bufio"
 	"bytes"
 	"os"
-	"os/exec"
 	"strings"
 
 	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
 
+	"github.com/jeffrom/polyester/executil"
 	"github.com/jeffrom/polyester/operator"
 	"github.com/jeffrom/polyester/state"
+	"github.com/jeffrom/polyester/stdio"
 )
 
 type AptInstallOpts struct {
@@ -26,12 +27,10 @@ func (op AptInstall) Info() operator.Info {
 	opts := op.Args.(*AptInstallOpts)
 
 	cmd := &cobra.Command{
-		Use:   "apt-install package...",
+		Use:   "apt-install package[@version]...",
 		Args:  cobra.MinimumNArgs(1),
 		Short: "installs packages using the apt package manager",
 	}
-	// flags := cmd.Flags()
-	// flags.Uint32VarP(&opts.Mode, "mode", "m", 0644, "the mode to set the file to")
 
 	return &operator.InfoData{
 		OpName: "apt-install",
@@ -45,69 +44,86 @@ func (op AptInstall) Info() operator.Info {
 
 func (op AptInstall) GetState(octx operator.Context) (state.State, error) {
 	opts := op.Args.(*AptInstallOpts)
-	st := state.State{}
-	args := append([]string{"-f", "${binary:Package}@${Version}\n", "-W"}, opts.Packages...)
-	cmd := exec.CommandContext(octx.Context, "dpkg-query", args...)
+	return installState(octx, apt{}, opts.Packages)
+}
+
+func (op AptInstall) Run(octx operator.Context) error {
+	opts := op.Args.(*AptInstallOpts)
+	return apt{}.install(octx, parsePackages(opts.Packages))
+}
+
+func aptInstallArgs(cmd *cobra.Command, args []string, target interface{}) error {
+	t := target.(*AptInstallOpts)
+	t.Packages = args
+	return nil
+}
+
+// apt installs packages with apt, and queries them with dpkg-query.
+type apt struct{}
+
+func (apt) installed(octx operator.Context, names []string) (map[string]interface{}, error) {
+	pkgs, err := dpkgQuery(octx, names)
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]interface{})
+	for name, pkg := range pkgs {
+		if pkg.status == dpkgInstalled {
+			installed[name] = pkg.version
+		}
+	}
+	return installed, nil
+}
+
+const (
+	dpkgInstalled   = "installed"
+	dpkgConfigFiles = "config-files"
+)
+
+// dpkgPackage is a package known to dpkg.
+type dpkgPackage struct {
+	version string
+	// status is the package's status, such as installed or config-files,
+	// which means it was removed but its configuration files were kept.
+	status string
+}
+
+// dpkgQuery returns each of the named packages dpkg knows of, whether or not
+// they're installed.
+func dpkgQuery(octx operator.Context, names []string) (map[string]dpkgPackage, error) {
+	std := stdio.FromContext(octx.Context)
+	args := append([]string{"-f", "${binary:Package}@${Version}@${db:Status-Status}\n", "-W"}, names...)
+	cmd := executil.CommandContext(octx.Context, "dpkg-query", args...)
 	outb := &bytes.Buffer{}
 	cmd.Stdout = outb
 	if isatty.IsTerminal(os.Stdout.Fd()) {
 		cmd.Stdin = os.Stdin
 	}
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = std.Stderr()
 
+	// dpkg-query exits 1 if any of the packages aren't known.
 	if err := cmd.Run(); err != nil {
-		if cmd.ProcessState.ExitCode() != 1 {
-			return st, err
+		if cmd.ProcessState == nil || cmd.ProcessState.ExitCode() != 1 {
+			return nil, err
 		}
 	}
 
 	sc := bufio.NewScanner(outb)
-	installed := make(map[string]interface{})
+	pkgs := make(map[string]dpkgPackage)
 	for sc.Scan() {
-		line := sc.Text()
-		parts := strings.SplitN(line, "@", 2)
-		name, version := parts[0], parts[1]
-		installed[name] = version
-	}
-	if err := sc.Err(); err != nil {
-		return st, err
-	}
-	st = st.Append(state.Entry{
-		Name: "installed",
-		KV:   installed,
-	})
-
-	requested := make(map[string]interface{})
-	for _, arg := range opts.Packages {
-		parts := strings.SplitN(arg, "@", 2)
-		var version string
-		name := parts[0]
-		if len(parts) > 1 {
-			version = parts[1]
+		parts := strings.SplitN(sc.Text(), "@", 3)
+		if len(parts) < 3 || parts[2] == "not-installed" {
+			continue
 		}
-		requested[name] = version
+		pkgs[parts[0]] = dpkgPackage{version: parts[1], status: parts[2]}
 	}
-	st = st.Append(state.Entry{
-		Name: "requested",
-		KV:   requested,
-	})
-	return st, nil
-}
-
-func (op AptInstall) Run(octx operator.Context) error {
-	opts := op.Args.(*AptInstallOpts)
-	args := append([]string{"install", "--quiet", "--yes"}, opts.Packages...)
-	cmd := exec.CommandContext(octx.Context, "apt", args...)
-	if isatty.IsTerminal(os.Stdout.Fd()) {
-		cmd.Stdin = os.Stdin
+	if err := sc.Err(); err != nil {
+		return nil, err
 	}
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	return cmd.Run()
+	return pkgs, nil
 }
 
-func aptInstallArgs(cmd *cobra.Command, args []string, target interface{}) error {
-	t := target.(*AptInstallOpts)
-	t.Packages = args
-	return nil
+func (apt) install(octx operator.Context, pkgs []pkgSpec) error {
+	args := append([]string{"install", "--quiet", "--yes"}, pinned(pkgs, "=")...)
+	return runInstall(octx, "apt", args...)
 }
@@ -0,0 +1,119 @@
+package pkgop
+
+import (
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/state"
+)
+
+type AptRemoveOpts struct {
+	Packages []string `json:"packages"`
+}
+
+// AptRemove removes packages with apt. If Purge is true, their configuration
+// files are removed as well, including for packages that were already
+// removed without purging.
+type AptRemove struct {
+	Args  interface{}
+	Purge bool
+}
+
+func (op AptRemove) name() string {
+	if op.Purge {
+		return "apt-purge"
+	}
+	return "apt-remove"
+}
+
+func (op AptRemove) Info() operator.Info {
+	opts := op.Args.(*AptRemoveOpts)
+
+	short := "removes packages using the apt package manager"
+	if op.Purge {
+		short = "removes packages and their configuration files using the apt package manager"
+	}
+	cmd := &cobra.Command{
+		Use:   op.name() + " package...",
+		Args:  cobra.MinimumNArgs(1),
+		Short: short,
+	}
+
+	return &operator.InfoData{
+		OpName: op.name(),
+		Command: &operator.Command{
+			Command:   cmd,
+			ApplyArgs: aptRemoveArgs,
+			Target:    opts,
+		},
+	}
+}
+
+// GetState returns the installed versions of the packages. When purging, it
+// also returns the packages whose configuration files are still installed.
+func (op AptRemove) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*AptRemoveOpts)
+	st := state.State{}
+	pkgs, err := dpkgQuery(octx, opts.Packages)
+	if err != nil {
+		return st, err
+	}
+
+	installed := make(map[string]interface{})
+	configFiles := make(map[string]interface{})
+	for name, pkg := range pkgs {
+		switch pkg.status {
+		case dpkgInstalled:
+			installed[name] = pkg.version
+		case dpkgConfigFiles:
+			configFiles[name] = pkg.version
+		}
+	}
+	st = st.Append(state.Entry{
+		Name: "installed",
+		KV:   installed,
+	})
+	if op.Purge {
+		st = st.Append(state.Entry{
+			Name: "config-files",
+			KV:   configFiles,
+		})
+	}
+	return st, nil
+}
+
+func (op AptRemove) Run(octx operator.Context) error {
+	opts := op.Args.(*AptRemoveOpts)
+	pkgs, err := dpkgQuery(octx, opts.Packages)
+	if err != nil {
+		return err
+	}
+
+	// apt fails on packages it doesn't know, so only the packages that are
+	// installed are passed.
+	var names []string
+	for name, pkg := range pkgs {
+		if pkg.status == dpkgInstalled || (op.Purge && pkg.status == dpkgConfigFiles) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	verb := "remove"
+	if op.Purge {
+		verb = "purge"
+	}
+	args := append([]string{verb, "--quiet", "--yes"}, names...)
+	return runInstall(octx, "apt", args...)
+}
+
+func aptRemoveArgs(cmd *cobra.Command, args []string, target interface{}) error {
+	t := target.(*AptRemoveOpts)
+	t.Packages = args
+	return nil
+}
@@ -0,0 +1,326 @@
+package pkgop
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/fileop"
+	"github.com/jeffrom/polyester/operator/opfs"
+	"github.com/jeffrom/polyester/state"
+)
+
+// maxKeySize is the largest key apt-repo will download.
+const maxKeySize = 1 << 20
+
+type AptRepoOpts struct {
+	Name       string   `json:"name"`
+	URI        string   `json:"uri,omitempty"`
+	Suite      string   `json:"suite,omitempty"`
+	Components []string `json:"components,omitempty"`
+	Arch       []string `json:"arch,omitempty"`
+	Source     bool     `json:"source,omitempty"`
+	Key        string   `json:"key,omitempty"`
+	KeyURL     string   `json:"key_url,omitempty"`
+	Absent     bool     `json:"absent,omitempty"`
+	SourcesDir string   `json:"sources_dir"`
+	KeyringDir string   `json:"keyring_dir"`
+}
+
+// AptRepo manages an apt repository in sources.list.d, and the keyring its
+// packages are signed with. The keyring is copied from the plan's files with
+// --key, or downloaded from --key-url when it doesn't exist yet. Only the
+// keyring is trusted for the repository, using signed-by.
+type AptRepo struct {
+	Args interface{}
+}
+
+func (op AptRepo) Info() operator.Info {
+	opts := op.Args.(*AptRepoOpts)
+
+	cmd := &cobra.Command{
+		Use:   "apt-repo name [uri suite [component...]]",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "manages an apt repository and its signing key",
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&opts.Key, "key", "", "the repository's signing key, in the plan's `file`")
+	flags.StringVar(&opts.KeyURL, "key-url", "", "download the repository's signing key from `url`")
+	flags.StringArrayVar(&opts.Arch, "arch", nil, "only use the repository for `architecture`")
+	flags.BoolVar(&opts.Source, "source", false, "also use the repository for source packages")
+	flags.BoolVar(&opts.Absent, "absent", false, "remove the repository and its keyring")
+	flags.StringVar(&opts.SourcesDir, "sources-dir", "/etc/apt/sources.list.d", "the `directory` to write the repository to")
+	flags.StringVar(&opts.KeyringDir, "keyring-dir", "/etc/apt/keyrings", "the `directory` to write the keyring to")
+
+	return &operator.InfoData{
+		OpName: "apt-repo",
+		Command: &operator.Command{
+			Command:   cmd,
+			ApplyArgs: aptRepoArgs,
+			Target:    opts,
+		},
+	}
+}
+
+func (op AptRepo) Validate(octx operator.Context, targ interface{}, evaluated bool) error {
+	opts := targ.(*AptRepoOpts)
+	var errs operator.Errors
+	if strings.ContainsAny(opts.Name, "/ ") {
+		errs.Add(fmt.Errorf("apt-repo: invalid name %q", opts.Name))
+	}
+	if opts.Absent {
+		return errs.Err()
+	}
+	if opts.URI == "" || opts.Suite == "" {
+		errs.Add(errors.New("apt-repo: uri and suite are required"))
+	}
+	if opts.Key != "" && opts.KeyURL != "" {
+		errs.Add(errors.New("apt-repo: only one of --key and --key-url can be used"))
+	}
+	return errs.Err()
+}
+
+func (op AptRepo) References(targ interface{}) []operator.Reference {
+	opts := targ.(*AptRepoOpts)
+	if opts.Absent || opts.Key == "" {
+		return nil
+	}
+	return []operator.Reference{{Kind: "files", Path: opts.Key}}
+}
+
+// GetState returns the checksums of the repository's sources file and
+// keyring.
+func (op AptRepo) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*AptRepoOpts)
+	st := state.State{}
+	keyring, err := op.keyringPath(octx, nil)
+	if err != nil {
+		return st, err
+	}
+	for _, p := range []string{opts.listPath(), keyring} {
+		entry, err := fileop.ChecksumEntry(octx, p)
+		if err != nil {
+			return st, err
+		}
+		st = st.Append(entry)
+	}
+	return st, nil
+}
+
+// DesiredState returns the checksums the sources file and keyring should
+// have. A keyring that hasn't been downloaded yet has no checksum.
+func (op AptRepo) DesiredState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*AptRepoOpts)
+	st := state.State{}
+	if opts.Absent {
+		keyring, err := op.keyringPath(octx, nil)
+		if err != nil {
+			return st, err
+		}
+		return st.Append(state.Entry{Name: opts.listPath()}, state.Entry{Name: keyring}), nil
+	}
+
+	key, err := op.readKey(octx)
+	if err != nil {
+		return st, err
+	}
+	keyring, err := op.keyringPath(octx, key)
+	if err != nil {
+		return st, err
+	}
+	st = st.Append(checksumEntry(opts.listPath(), opts.sourcesList(keyring)))
+	if key == nil {
+		return st.Append(state.Entry{Name: keyring}), nil
+	}
+	return st.Append(checksumEntry(keyring, key)), nil
+}
+
+func (op AptRepo) Run(octx operator.Context) error {
+	opts := op.Args.(*AptRepoOpts)
+	if opts.Absent {
+		for _, p := range append(opts.keyringPaths(), opts.listPath()) {
+			if err := os.Remove(octx.FS.Join(p)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	key, err := op.readKey(octx)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		key, err = downloadKey(octx, opts.KeyURL)
+		if err != nil {
+			return err
+		}
+	}
+	keyring, err := op.keyringPath(octx, key)
+	if err != nil {
+		return err
+	}
+
+	if key != nil {
+		if _, err := fileop.WriteIfChanged(octx, keyring, key, 0644); err != nil {
+			return err
+		}
+		// the key may have changed between armored and binary.
+		for _, p := range opts.keyringPaths() {
+			if p == keyring {
+				continue
+			}
+			if err := os.Remove(octx.FS.Join(p)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	_, err = fileop.WriteIfChanged(octx, opts.listPath(), opts.sourcesList(keyring), 0644)
+	return err
+}
+
+// readKey returns the repository's key. It returns nil if the key is
+// downloaded, and hasn't been yet.
+func (op AptRepo) readKey(octx operator.Context) ([]byte, error) {
+	opts := op.Args.(*AptRepoOpts)
+	if opts.Key != "" {
+		files, err := octx.PlanDir.Resolve("files", []string{opts.Key})
+		if err != nil {
+			return nil, err
+		}
+		if len(files) != 1 {
+			return nil, fmt.Errorf("apt-repo: expected one key file matching %q, found %d", opts.Key, len(files))
+		}
+		return os.ReadFile(octx.PlanDir.Join(files[0]))
+	}
+	if opts.KeyURL != "" {
+		for _, p := range opts.keyringPaths() {
+			b, err := octx.FS.ReadFile(p)
+			if err == nil {
+				return b, nil
+			} else if !errors.Is(err, fs.ErrNotExist) && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// keyringPath returns the path of the keyring. apt reads armored keyrings
+// only if they end in .asc, so the extension depends on key. If key is nil,
+// the existing keyring is used, if any.
+func (op AptRepo) keyringPath(octx operator.Context, key []byte) (string, error) {
+	opts := op.Args.(*AptRepoOpts)
+	paths := opts.keyringPaths()
+	if key != nil {
+		if bytes.HasPrefix(bytes.TrimSpace(key), []byte("-----BEGIN PGP")) {
+			return paths[0], nil
+		}
+		return paths[1], nil
+	}
+	for _, p := range paths {
+		if _, err := octx.FS.Stat(p); err == nil {
+			return p, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	return paths[0], nil
+}
+
+func (opts *AptRepoOpts) keyringPaths() []string {
+	return []string{
+		path.Join(opts.KeyringDir, opts.Name+".asc"),
+		path.Join(opts.KeyringDir, opts.Name+".gpg"),
+	}
+}
+
+func (opts *AptRepoOpts) listPath() string {
+	return path.Join(opts.SourcesDir, opts.Name+".list")
+}
+
+// sourcesList returns the contents of the repository's sources file.
+func (opts *AptRepoOpts) sourcesList(keyring string) []byte {
+	var options []string
+	if len(opts.Arch) > 0 {
+		options = append(options, "arch="+strings.Join(opts.Arch, ","))
+	}
+	if opts.Key != "" || opts.KeyURL != "" {
+		options = append(options, "signed-by="+keyring)
+	}
+	rest := append([]string{opts.URI, opts.Suite}, opts.Components...)
+	if len(options) > 0 {
+		rest = append([]string{"[" + strings.Join(options, " ") + "]"}, rest...)
+	}
+	line := strings.Join(rest, " ")
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("# managed by polyester\n")
+	fmt.Fprintf(buf, "deb %s\n", line)
+	if opts.Source {
+		fmt.Fprintf(buf, "deb-src %s\n", line)
+	}
+	return buf.Bytes()
+}
+
+func downloadKey(octx operator.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(octx.Context, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("apt-repo: download %s: %s", url, res.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxKeySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxKeySize {
+		return nil, fmt.Errorf("apt-repo: download %s: key is larger than %d bytes", url, maxKeySize)
+	}
+	return b, nil
+}
+
+func checksumEntry(p string, b []byte) state.Entry {
+	// sha256 of an in-memory buffer can't fail.
+	checksum, _ := fileop.ChecksumReader(bytes.NewReader(b))
+	return state.Entry{
+		Name: p,
+		File: &opfs.StateFileEntry{
+			SHA256: checksum,
+			Info: opfs.StateFileInfo{
+				RawName: p,
+				SHA256:  checksum,
+			},
+		},
+	}
+}
+
+func aptRepoArgs(cmd *cobra.Command, args []string, target interface{}) error {
+	t := target.(*AptRepoOpts)
+	t.Name = args[0]
+	if len(args) > 1 {
+		t.URI = args[1]
+	}
+	if len(args) > 2 {
+		t.Suite = args[2]
+	}
+	if len(args) > 3 {
+		t.Components = args[3:]
+	}
+	return nil
+}
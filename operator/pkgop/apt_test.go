@@ -0,0 +1,242 @@
+package pkgop
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jeffrom/polyester/executil"
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/state"
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func newFakeApt(t testing.TB) *testenv.Apt {
+	t.Helper()
+	fake := testenv.NewApt()
+	fake.Available("git", "1:2.30.2-1")
+	fake.Available("curl", "7.74.0-1.3", "7.74.0-1.3+deb11u1")
+	executil.SetCommand(fake.Command)
+	t.Cleanup(executil.ResetCommand)
+	return fake
+}
+
+func entryKV(t testing.TB, st state.State, name string) map[string]interface{} {
+	t.Helper()
+	ent, ok := st.Get(name)
+	if !ok {
+		t.Fatalf("expected state entry %q", name)
+	}
+	return ent.KV
+}
+
+func TestAptInstall(t *testing.T) {
+	tcs := []struct {
+		name          string
+		installed     map[string]string
+		packages      []string
+		expectCalls   []string
+		expectVersion map[string]string
+		err           bool
+	}{
+		{
+			name:          "install",
+			packages:      []string{"git", "curl"},
+			expectCalls:   []string{"install git curl"},
+			expectVersion: map[string]string{"git": "1:2.30.2-1", "curl": "7.74.0-1.3+deb11u1"},
+		},
+		{
+			name:          "pin",
+			packages:      []string{"curl@7.74.0-1.3"},
+			expectCalls:   []string{"install curl=7.74.0-1.3"},
+			expectVersion: map[string]string{"curl": "7.74.0-1.3"},
+		},
+		{
+			name:          "upgrade",
+			installed:     map[string]string{"curl": "7.74.0-1.3"},
+			packages:      []string{"curl"},
+			expectCalls:   []string{"install curl"},
+			expectVersion: map[string]string{"curl": "7.74.0-1.3+deb11u1"},
+		},
+		{
+			name:          "downgrade",
+			installed:     map[string]string{"curl": "7.74.0-1.3+deb11u1"},
+			packages:      []string{"curl@7.74.0-1.3"},
+			expectCalls:   []string{"install curl=7.74.0-1.3"},
+			expectVersion: map[string]string{"curl": "7.74.0-1.3"},
+		},
+		{
+			name:        "unknown package",
+			packages:    []string{"git", "nope"},
+			expectCalls: []string{"install git nope"},
+			err:         true,
+		},
+		{
+			name:        "unknown version",
+			packages:    []string{"curl@1.0"},
+			expectCalls: []string{"install curl=1.0"},
+			err:         true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := newFakeApt(t)
+			for name, version := range tc.installed {
+				fake.Install(name, version)
+			}
+			octx := operator.Context{Context: testenv.Context()}
+			op := AptInstall{Args: &AptInstallOpts{Packages: tc.packages}}
+
+			err := op.Run(octx)
+			if tc.err && err == nil {
+				t.Fatal("expected error")
+			} else if !tc.err && err != nil {
+				t.Fatal(err)
+			}
+			if calls := fake.Calls(); !reflect.DeepEqual(calls, tc.expectCalls) {
+				t.Errorf("expected apt calls %q, got %q", tc.expectCalls, calls)
+			}
+
+			st, err := op.GetState(octx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			installed := entryKV(t, st, "installed")
+			expectInstalled := make(map[string]interface{})
+			for name, version := range tc.installed {
+				expectInstalled[name] = version
+			}
+			for name, version := range tc.expectVersion {
+				expectInstalled[name] = version
+			}
+			if !reflect.DeepEqual(installed, expectInstalled) {
+				t.Errorf("expected installed %v, got %v", expectInstalled, installed)
+			}
+		})
+	}
+}
+
+func TestAptInstallState(t *testing.T) {
+	fake := newFakeApt(t)
+	octx := operator.Context{Context: testenv.Context()}
+	op := AptInstall{Args: &AptInstallOpts{Packages: []string{"git", "curl@7.74.0-1.3"}}}
+
+	before, err := op.GetState(octx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if installed := entryKV(t, before, "installed"); len(installed) != 0 {
+		t.Errorf("expected nothing installed, got %v", installed)
+	}
+	expectRequested := map[string]interface{}{"git": "", "curl": "7.74.0-1.3"}
+	if requested := entryKV(t, before, "requested"); !reflect.DeepEqual(requested, expectRequested) {
+		t.Errorf("expected requested %v, got %v", expectRequested, requested)
+	}
+
+	if err := op.Run(octx); err != nil {
+		t.Fatal(err)
+	}
+	after, err := op.GetState(octx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.Changed(before) {
+		t.Error("expected state to change after install")
+	}
+	again, err := op.GetState(octx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Changed(after) {
+		t.Error("expected state not to change without an install")
+	}
+
+	// a package upgraded outside of polyester changes the state.
+	fake.Install("curl", "7.74.0-1.3+deb11u1")
+	upgraded, err := op.GetState(octx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !upgraded.Changed(after) {
+		t.Error("expected state to change after an upgrade")
+	}
+}
+
+func TestAptRemove(t *testing.T) {
+	tcs := []struct {
+		name        string
+		purge       bool
+		installed   map[string]string
+		configFiles []string
+		packages    []string
+		expectCalls []string
+		expect      map[string]*testenv.FakePackage
+	}{
+		{
+			name:        "remove",
+			installed:   map[string]string{"git": "1:2.30.2-1", "curl": "7.74.0-1.3"},
+			packages:    []string{"git", "curl"},
+			expectCalls: []string{"remove curl git"},
+			expect: map[string]*testenv.FakePackage{
+				"git":  {Version: "1:2.30.2-1", Status: "config-files"},
+				"curl": {Version: "7.74.0-1.3", Status: "config-files"},
+			},
+		},
+		{
+			name:      "remove not installed",
+			packages:  []string{"git", "nope"},
+			installed: map[string]string{},
+			expect:    map[string]*testenv.FakePackage{"git": nil},
+		},
+		{
+			name:        "purge",
+			purge:       true,
+			installed:   map[string]string{"git": "1:2.30.2-1", "curl": "7.74.0-1.3"},
+			configFiles: []string{"curl"},
+			packages:    []string{"git", "curl"},
+			expectCalls: []string{"purge curl git"},
+			expect:      map[string]*testenv.FakePackage{"git": nil, "curl": nil},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := newFakeApt(t)
+			for name, version := range tc.installed {
+				fake.Install(name, version)
+			}
+			octx := operator.Context{Context: testenv.Context()}
+			for _, name := range tc.configFiles {
+				rm := AptRemove{Args: &AptRemoveOpts{Packages: []string{name}}}
+				if err := rm.Run(octx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fake.Reset()
+
+			op := AptRemove{Args: &AptRemoveOpts{Packages: tc.packages}, Purge: tc.purge}
+			if err := op.Run(octx); err != nil {
+				t.Fatal(err)
+			}
+			if calls := fake.Calls(); !reflect.DeepEqual(calls, tc.expectCalls) {
+				t.Errorf("expected apt calls %q, got %q", tc.expectCalls, calls)
+			}
+			for name, expect := range tc.expect {
+				if got := fake.Package(name); !reflect.DeepEqual(got, expect) {
+					t.Errorf("%s: expected %+v, got %+v", name, expect, got)
+				}
+			}
+
+			st, err := op.GetState(octx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if installed := entryKV(t, st, "installed"); len(installed) != 0 {
+				t.Errorf("expected nothing installed, got %v", installed)
+			}
+			if _, ok := st.Get("config-files"); ok != tc.purge {
+				t.Errorf("expected config-files entry: %v, got %v", tc.purge, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package pkgop
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/fileop"
+	"github.com/jeffrom/polyester/state"
+)
+
+// aptSources are the files that configure apt repositories and the keys
+// they're signed with. The cache is refreshed when any of them change.
+var aptSources = []string{
+	"/etc/apt/sources.list",
+	"/etc/apt/sources.list.d/*",
+	"/etc/apt/keyrings/*",
+	"/etc/apt/trusted.gpg.d/*",
+}
+
+// aptListsDir is where apt keeps the package lists it downloads. Its
+// modification time is when the cache was last refreshed.
+const aptListsDir = "/var/lib/apt/lists"
+
+type AptUpdateOpts struct {
+	TTL time.Duration `json:"ttl"`
+}
+
+// AptUpdate refreshes the apt package cache when the configured repositories
+// or their keys change, or the cache is older than --ttl.
+type AptUpdate struct {
+	Args interface{}
+}
+
+func (op AptUpdate) Info() operator.Info {
+	opts := op.Args.(*AptUpdateOpts)
+
+	cmd := &cobra.Command{
+		Use:   "apt-update",
+		Args:  cobra.NoArgs,
+		Short: "refreshes the apt package cache",
+	}
+	flags := cmd.Flags()
+	flags.DurationVar(&opts.TTL, "ttl", 24*time.Hour, "refresh the cache if it is older than `duration`, or 0 to only refresh when repositories change")
+
+	return &operator.InfoData{
+		OpName: "apt-update",
+		Command: &operator.Command{
+			Command: cmd,
+			Target:  opts,
+		},
+	}
+}
+
+// GetState returns the checksums of the repository configuration, and
+// whether the cache was refreshed within the TTL.
+func (op AptUpdate) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*AptUpdateOpts)
+	st := state.State{}
+	for _, pat := range aptSources {
+		files, err := octx.FS.Glob(pat)
+		if err != nil {
+			return st, err
+		}
+		for _, p := range files {
+			entry, err := fileop.ChecksumEntry(octx, p)
+			if err != nil {
+				return st, err
+			}
+			if entry.File != nil {
+				st = st.Append(entry)
+			}
+		}
+	}
+
+	fresh := true
+	if opts.TTL > 0 {
+		info, err := octx.FS.Stat(aptListsDir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return st, err
+		}
+		fresh = info != nil && time.Since(info.ModTime()) < opts.TTL
+	}
+	return st.Append(state.Entry{
+		Name: "cache",
+		KV:   map[string]interface{}{"fresh": fresh},
+	}), nil
+}
+
+func (op AptUpdate) Run(octx operator.Context) error {
+	if err := runInstall(octx, "apt", "update", "--quiet"); err != nil {
+		return err
+	}
+
+	// apt only touches the lists that changed, so the cache is marked as
+	// refreshed even if none did.
+	now := time.Now()
+	if err := os.Chtimes(octx.FS.Join(aptListsDir), now, now); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
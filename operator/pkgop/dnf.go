@@ -0,0 +1,75 @@
+package pkgop
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"github.com/jeffrom/polyester/executil"
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/state"
+)
+
+// DnfInstall installs packages with dnf, or yum on systems without dnf.
+// Versions are pinned as name-version, where the version can include the
+// release, such as 1.2.3-1.fc34.
+type DnfInstall struct {
+	Args interface{}
+}
+
+func (op DnfInstall) Info() operator.Info {
+	return installInfo("dnf-install", "installs packages using the dnf package manager", op.Args.(*InstallOpts))
+}
+
+func (op DnfInstall) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*InstallOpts)
+	return installState(octx, dnf{}, opts.Packages)
+}
+
+func (op DnfInstall) Run(octx operator.Context) error {
+	opts := op.Args.(*InstallOpts)
+	return dnf{}.install(octx, parsePackages(opts.Packages))
+}
+
+// dnf installs packages with dnf or yum, and queries them with rpm.
+type dnf struct{}
+
+func (dnf) installed(octx operator.Context, names []string) (map[string]interface{}, error) {
+	args := append([]string{"--query", "--queryformat", "%{NAME}@%{VERSION}-%{RELEASE}\n"}, names...)
+	cmd := executil.CommandContext(octx.Context, "rpm", args...)
+	outb := &bytes.Buffer{}
+	cmd.Stdout = outb
+	// rpm exits with the number of packages that aren't installed.
+	if err := cmd.Run(); err != nil && !isExitError(err) {
+		return nil, err
+	}
+
+	sc := bufio.NewScanner(outb)
+	installed := make(map[string]interface{})
+	for sc.Scan() {
+		line := sc.Text()
+		// packages that aren't installed are reported as "package foo is
+		// not installed".
+		if strings.Contains(line, " ") {
+			continue
+		}
+		parts := strings.SplitN(line, "@", 2)
+		if len(parts) < 2 {
+			continue
+		}
+		installed[parts[0]] = parts[1]
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return installed, nil
+}
+
+func (dnf) install(octx operator.Context, pkgs []pkgSpec) error {
+	bin := "dnf"
+	if _, err := executil.LookPath(bin); err != nil {
+		bin = "yum"
+	}
+	args := append([]string{"install", "--quiet", "--assumeyes"}, pinned(pkgs, "-")...)
+	return runInstall(octx, bin, args...)
+}
@@ -0,0 +1,134 @@
+package pkgop
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/executil"
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/state"
+	"github.com/jeffrom/polyester/stdio"
+)
+
+// manager is a package manager backend.
+type manager interface {
+	// installed returns the installed version of each of the named packages
+	// that is installed.
+	installed(octx operator.Context, names []string) (map[string]interface{}, error)
+	// install installs pkgs, pinning the packages that have a version.
+	install(octx operator.Context, pkgs []pkgSpec) error
+}
+
+// pkgSpec is a package argument, in the form name or name@version.
+type pkgSpec struct {
+	name    string
+	version string
+}
+
+func parsePackages(args []string) []pkgSpec {
+	pkgs := make([]pkgSpec, len(args))
+	for i, arg := range args {
+		parts := strings.SplitN(arg, "@", 2)
+		pkgs[i].name = parts[0]
+		if len(parts) > 1 {
+			pkgs[i].version = parts[1]
+		}
+	}
+	return pkgs
+}
+
+// pinned returns the packages as arguments to a package manager, with the
+// version joined to the name by sep.
+func pinned(pkgs []pkgSpec, sep string) []string {
+	args := make([]string, len(pkgs))
+	for i, pkg := range pkgs {
+		args[i] = pkg.name
+		if pkg.version != "" {
+			args[i] += sep + pkg.version
+		}
+	}
+	return args
+}
+
+// installState returns the installed versions of the requested packages, and
+// the requested versions, which are empty for packages that aren't pinned.
+func installState(octx operator.Context, m manager, args []string) (state.State, error) {
+	st := state.State{}
+	pkgs := parsePackages(args)
+	names := make([]string, len(pkgs))
+	requested := make(map[string]interface{})
+	for i, pkg := range pkgs {
+		names[i] = pkg.name
+		requested[pkg.name] = pkg.version
+	}
+
+	installed, err := m.installed(octx, names)
+	if err != nil {
+		return st, err
+	}
+	st = st.Append(state.Entry{
+		Name: "installed",
+		KV:   installed,
+	})
+	st = st.Append(state.Entry{
+		Name: "requested",
+		KV:   requested,
+	})
+	return st, nil
+}
+
+// runInstall runs a package manager command, passing through stdin when it's
+// a terminal.
+func runInstall(octx operator.Context, name string, args ...string) error {
+	std := stdio.FromContext(octx.Context)
+	cmd := executil.CommandContext(octx.Context, name, args...)
+	if isatty.IsTerminal(os.Stdout.Fd()) {
+		cmd.Stdin = os.Stdin
+	}
+	cmd.Stderr = std.Stderr()
+	cmd.Stdout = std.Stdout()
+	return cmd.Run()
+}
+
+// isExitError returns true if err is a non-zero exit status. Package queries
+// exit non-zero when some of the packages aren't installed.
+func isExitError(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() > 0
+}
+
+// InstallOpts are the options for the operators that install packages with a
+// particular package manager.
+type InstallOpts struct {
+	Packages []string `json:"packages"`
+}
+
+// installInfo returns the info for an operator that installs packages with a
+// particular package manager.
+func installInfo(name, short string, opts *InstallOpts) operator.Info {
+	cmd := &cobra.Command{
+		Use:   name + " package[@version]...",
+		Args:  cobra.MinimumNArgs(1),
+		Short: short,
+	}
+
+	return &operator.InfoData{
+		OpName: name,
+		Command: &operator.Command{
+			Command:   cmd,
+			ApplyArgs: installArgs,
+			Target:    opts,
+		},
+	}
+}
+
+func installArgs(cmd *cobra.Command, args []string, target interface{}) error {
+	t := target.(*InstallOpts)
+	t.Packages = args
+	return nil
+}
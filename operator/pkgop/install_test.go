@@ -0,0 +1,116 @@
+package pkgop
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/opfs"
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestPinned(t *testing.T) {
+	pkgs := parsePackages([]string{"git", "curl@7.74.0-1.3", "vim@"})
+	if got, expect := pinned(pkgs, "="), []string{"git", "curl=7.74.0-1.3", "vim"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %q, got %q", expect, got)
+	}
+	if got, expect := pinned(pkgs, "-"), []string{"git", "curl-7.74.0-1.3", "vim"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %q, got %q", expect, got)
+	}
+}
+
+func TestParseApkInstalled(t *testing.T) {
+	db := `C:Q1abc=
+P:musl
+V:1.2.2-r3
+A:x86_64
+
+C:Q1def=
+P:busybox
+V:1.33.1-r3
+A:x86_64
+`
+	expect := map[string]string{"musl": "1.2.2-r3", "busybox": "1.33.1-r3"}
+	if got := parseApkInstalled([]byte(db)); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestApkInstalledDirRoot(t *testing.T) {
+	root := testenv.TempDir(t, "")
+	defer testenv.RemoveOnSuccess(t, root)
+	octx := operator.NewContext(testenv.Context(), opfs.New(root), nil, nil)
+	installed, err := apk{}.installed(octx, []string{"musl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installed) != 0 {
+		t.Errorf("expected nothing installed without a database, got %v", installed)
+	}
+
+	db := filepath.Join(root, apkInstalledDB)
+	if err := os.MkdirAll(filepath.Dir(db), 0755); err != nil {
+		t.Fatal(err)
+	}
+	testenv.WriteFile(t, db, "P:musl\nV:1.2.2-r3\n")
+	installed, err = apk{}.installed(octx, []string{"musl", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := map[string]interface{}{"musl": "1.2.2-r3"}; !reflect.DeepEqual(installed, expect) {
+		t.Errorf("expected %v, got %v", expect, installed)
+	}
+}
+
+func TestPacmanPinned(t *testing.T) {
+	octx := operator.NewContext(testenv.Context(), nil, nil, nil)
+	op := PacmanInstall{Args: &InstallOpts{}}
+	if err := op.Validate(octx, &InstallOpts{Packages: []string{"git", "vim"}}, true); err != nil {
+		t.Fatal("expected unpinned packages to be valid, got:", err)
+	}
+	err := op.Validate(octx, &InstallOpts{Packages: []string{"git", "vim@9.0"}}, true)
+	if err == nil || !strings.Contains(err.Error(), "vim@9.0") {
+		t.Errorf("expected an error for vim@9.0, got %v", err)
+	}
+
+	pop := PkgInstall{Args: &PkgInstallOpts{}}
+	if err := pop.Validate(octx, &PkgInstallOpts{Manager: "pacman", Packages: []string{"vim@9.0"}}, true); err == nil {
+		t.Error("expected pkg-install --manager pacman to reject a pinned version")
+	}
+	if err := pop.Validate(octx, &PkgInstallOpts{Manager: "apt", Packages: []string{"vim@9.0"}}, true); err != nil {
+		t.Error("expected pkg-install --manager apt to accept a pinned version, got:", err)
+	}
+}
+
+func TestManagerForOS(t *testing.T) {
+	tcs := []struct {
+		id     string
+		expect string
+		err    bool
+	}{
+		{id: "debian", expect: "apt"},
+		{id: "fedora", expect: "dnf"},
+		{id: "alpine", expect: "apk"},
+		{id: "arch", expect: "pacman"},
+		{id: "plan9", err: true},
+		{id: "", err: true},
+	}
+	for _, tc := range tcs {
+		got, err := managerForOS(tc.id)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected error", tc.id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", tc.id, err)
+		}
+		if got != tc.expect {
+			t.Errorf("%q: expected %q, got %q", tc.id, tc.expect, got)
+		}
+	}
+}
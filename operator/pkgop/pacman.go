@@ -0,0 +1,94 @@
+package pkgop
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/jeffrom/polyester/executil"
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/state"
+)
+
+// PacmanInstall installs packages with pacman. Versions can't be pinned, since
+// pacman only installs the version in its sync database.
+type PacmanInstall struct {
+	Args interface{}
+}
+
+func (op PacmanInstall) Info() operator.Info {
+	return installInfo("pacman-install", "installs packages using the pacman package manager", op.Args.(*InstallOpts))
+}
+
+func (op PacmanInstall) Validate(octx operator.Context, targ interface{}, evaluated bool) error {
+	opts := targ.(*InstallOpts)
+	if err := (pacman{}).unpinned(parsePackages(opts.Packages)); err != nil {
+		return fmt.Errorf("pacman-install: %w", err)
+	}
+	return nil
+}
+
+func (op PacmanInstall) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*InstallOpts)
+	return installState(octx, pacman{}, opts.Packages)
+}
+
+func (op PacmanInstall) Run(octx operator.Context) error {
+	opts := op.Args.(*InstallOpts)
+	return pacman{}.install(octx, parsePackages(opts.Packages))
+}
+
+// pacman installs and queries packages with pacman.
+type pacman struct{}
+
+func (pacman) installed(octx operator.Context, names []string) (map[string]interface{}, error) {
+	args := append([]string{"--query"}, names...)
+	cmd := executil.CommandContext(octx.Context, "pacman", args...)
+	outb := &bytes.Buffer{}
+	cmd.Stdout = outb
+	// pacman exits 1, and prints an error for each package that isn't
+	// installed.
+	if err := cmd.Run(); err != nil && !isExitError(err) {
+		return nil, err
+	}
+
+	sc := bufio.NewScanner(outb)
+	installed := make(map[string]interface{})
+	for sc.Scan() {
+		parts := strings.Fields(sc.Text())
+		if len(parts) != 2 {
+			continue
+		}
+		installed[parts[0]] = parts[1]
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return installed, nil
+}
+
+func (p pacman) install(octx operator.Context, pkgs []pkgSpec) error {
+	if err := p.unpinned(pkgs); err != nil {
+		return err
+	}
+	args := []string{"--sync", "--noconfirm", "--needed"}
+	for _, pkg := range pkgs {
+		args = append(args, pkg.name)
+	}
+	return runInstall(octx, "pacman", args...)
+}
+
+// unpinned returns an error if any of the packages have a version.
+func (pacman) unpinned(pkgs []pkgSpec) error {
+	var versions []string
+	for _, pkg := range pkgs {
+		if pkg.version != "" {
+			versions = append(versions, pkg.name+"@"+pkg.version)
+		}
+	}
+	if len(versions) > 0 {
+		return fmt.Errorf("pacman can only install the version in its sync database, not %s", strings.Join(versions, ", "))
+	}
+	return nil
+}
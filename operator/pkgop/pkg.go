@@ -0,0 +1,142 @@
+package pkgop
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/facts"
+	"github.com/jeffrom/polyester/state"
+)
+
+var managers = map[string]manager{
+	"apt":    apt{},
+	"dnf":    dnf{},
+	"apk":    apk{},
+	"pacman": pacman{},
+}
+
+// osManagers are the package managers of each os, keyed by the ID in
+// /etc/os-release.
+var osManagers = map[string]string{
+	"debian":    "apt",
+	"ubuntu":    "apt",
+	"raspbian":  "apt",
+	"linuxmint": "apt",
+	"pop":       "apt",
+	"fedora":    "dnf",
+	"rhel":      "dnf",
+	"centos":    "dnf",
+	"rocky":     "dnf",
+	"almalinux": "dnf",
+	"ol":        "dnf",
+	"amzn":      "dnf",
+	"alpine":    "apk",
+	"arch":      "pacman",
+	"manjaro":   "pacman",
+}
+
+type PkgInstallOpts struct {
+	Manager  string   `json:"manager,omitempty"`
+	Packages []string `json:"packages"`
+}
+
+// PkgInstall installs packages with the package manager of the local system,
+// as determined by its facts, or the one passed with --manager.
+type PkgInstall struct {
+	Args interface{}
+}
+
+func (op PkgInstall) Info() operator.Info {
+	opts := op.Args.(*PkgInstallOpts)
+
+	cmd := &cobra.Command{
+		Use:   "pkg-install package[@version]...",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "installs packages using the system package manager",
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&opts.Manager, "manager", "", "the package manager to use: apt, dnf, apk or pacman")
+
+	return &operator.InfoData{
+		OpName: "pkg-install",
+		Command: &operator.Command{
+			Command:   cmd,
+			ApplyArgs: pkgInstallArgs,
+			Target:    opts,
+		},
+	}
+}
+
+func (op PkgInstall) Validate(octx operator.Context, targ interface{}, evaluated bool) error {
+	opts := targ.(*PkgInstallOpts)
+	if opts.Manager == "" {
+		return nil
+	}
+	m, ok := managers[opts.Manager]
+	if !ok {
+		return fmt.Errorf("pkg-install: unknown package manager %q", opts.Manager)
+	}
+	if p, ok := m.(pacman); ok {
+		if err := p.unpinned(parsePackages(opts.Packages)); err != nil {
+			return fmt.Errorf("pkg-install: %w", err)
+		}
+	}
+	return nil
+}
+
+func (op PkgInstall) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*PkgInstallOpts)
+	m, err := systemManager(opts.Manager)
+	if err != nil {
+		return state.State{}, err
+	}
+	return installState(octx, m, opts.Packages)
+}
+
+func (op PkgInstall) Run(octx operator.Context) error {
+	opts := op.Args.(*PkgInstallOpts)
+	m, err := systemManager(opts.Manager)
+	if err != nil {
+		return err
+	}
+	return m.install(octx, parsePackages(opts.Packages))
+}
+
+// systemManager returns the package manager named name, or if name is empty,
+// the package manager of the local system.
+func systemManager(name string) (manager, error) {
+	if name == "" {
+		f, err := facts.Gather()
+		if err != nil {
+			return nil, err
+		}
+		name, err = managerForOS(f.System.OS.Vendor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	m, ok := managers[name]
+	if !ok {
+		return nil, fmt.Errorf("pkg-install: unknown package manager %q", name)
+	}
+	return m, nil
+}
+
+func managerForOS(id string) (string, error) {
+	if id == "" {
+		return "", fmt.Errorf("pkg-install: couldn't detect the os, use --manager")
+	}
+	name, ok := osManagers[id]
+	if !ok {
+		return "", fmt.Errorf("pkg-install: no package manager known for os %q, use --manager", id)
+	}
+	return name, nil
+}
+
+func pkgInstallArgs(cmd *cobra.Command, args []string, target interface{}) error {
+	t := target.(*PkgInstallOpts)
+	t.Packages = args
+	return nil
+}
@@ -0,0 +1,55 @@
+package planop
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/state"
+)
+
+type HandlerOpts struct {
+	Name string `json:"name"`
+	// Args are the operator name and arguments of the handler's operation.
+	Args []string `json:"args"`
+}
+
+// Handler declares an operation that runs once at the end of the plan, and
+// only if an operation declared with --notify and the handler's name changed
+// its target.
+type Handler struct {
+	Args interface{}
+}
+
+func (op Handler) Info() operator.Info {
+	opts := op.Args.(*HandlerOpts)
+
+	cmd := &cobra.Command{
+		Use:   "handler name operator [args...]",
+		Args:  cobra.MinimumNArgs(2),
+		Short: "declares an operation to run when notified",
+		// the operation's flags are parsed by the compiler
+		DisableFlagParsing: true,
+	}
+
+	return &operator.InfoData{
+		OpName: "handler",
+		Command: &operator.Command{
+			Command:   cmd,
+			ApplyArgs: handlerArgs,
+			Target:    opts,
+		},
+	}
+}
+
+func (op Handler) GetState(octx operator.Context) (state.State, error) {
+	return state.New(), nil
+}
+
+func (op Handler) Run(octx operator.Context) error { return nil }
+
+func handlerArgs(cmd *cobra.Command, args []string, target interface{}) error {
+	t := target.(*HandlerOpts)
+	t.Name = args[0]
+	t.Args = args[1:]
+	return nil
+}
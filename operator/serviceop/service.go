@@ -0,0 +1,353 @@
+package serviceop
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/fileop"
+	"github.com/jeffrom/polyester/operator/opfs"
+	"github.com/jeffrom/polyester/operator/templateop"
+	"github.com/jeffrom/polyester/state"
+)
+
+type ServiceOpts struct {
+	Name          string   `json:"name"`
+	UnitTemplate  string   `json:"unit_template,omitempty"`
+	Exec          string   `json:"exec,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	User          string   `json:"user,omitempty"`
+	EnvSecrets    []string `json:"env_secrets,omitempty"`
+	DropIn        bool     `json:"drop_in,omitempty"`
+	UnitDir       string   `json:"unit_dir"`
+	EnvDir        string   `json:"env_dir"`
+	Enabled       bool     `json:"enabled"`
+	State         string   `json:"state"`
+	DataPaths     []string `json:"data,omitempty"`
+	IdentityPaths []string `json:"identities,omitempty"`
+}
+
+// Service installs a systemd unit, or a drop-in for an existing unit, that
+// runs an application, and keeps it enabled and running. Secrets passed with
+// --env-secret are written to an environment file only root can read. The
+// service is restarted whenever the operation runs, which includes when an
+// earlier operation in the plan, such as a template for its config, changed.
+type Service struct {
+	Args interface{}
+}
+
+func (op Service) Info() operator.Info {
+	opts := op.Args.(*ServiceOpts)
+
+	cmd := &cobra.Command{
+		Use:   "service name",
+		Args:  cobra.ExactArgs(1),
+		Short: "installs and runs a systemd service",
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.UnitTemplate, "unit-template", "t", "", "render the unit, or drop-in, from template `file`")
+	flags.StringVar(&opts.Exec, "exec", "", "generate a unit that runs `command`")
+	flags.StringVar(&opts.Description, "description", "", "description of the generated unit")
+	flags.StringVarP(&opts.User, "user", "u", "", "run the generated unit as `user`")
+	flags.StringArrayVarP(&opts.EnvSecrets, "env-secret", "e", nil, "set environment variable `NAME=secret` to the decrypted secret")
+	flags.BoolVar(&opts.DropIn, "drop-in", false, "write a drop-in for an existing unit instead of the unit")
+	flags.StringVar(&opts.UnitDir, "unit-dir", "/etc/systemd/system", "`directory` to install units in")
+	flags.StringVar(&opts.EnvDir, "env-dir", "/etc/polyester/env", "`directory` to write environment files with secrets to")
+	flags.BoolVar(&opts.Enabled, "enabled", true, "enable the unit")
+	flags.StringVar(&opts.State, "state", stateRunning, "run state of the unit: running or stopped")
+	flags.StringArrayVarP(&opts.DataPaths, "data", "d", nil, "template data `file`(s)")
+	flags.StringArrayVarP(&opts.IdentityPaths, "age-identity", "i", nil, "path(s) to age identity `file`(s)")
+
+	return &operator.InfoData{
+		OpName: "service",
+		Command: &operator.Command{
+			Command:   cmd,
+			ApplyArgs: serviceArgs,
+			Target:    opts,
+		},
+	}
+}
+
+func (op Service) Validate(octx operator.Context, targ interface{}, evaluated bool) error {
+	opts := targ.(*ServiceOpts)
+	var errs operator.Errors
+	if opts.UnitTemplate != "" && opts.Exec != "" {
+		errs.Add(errors.New("service: only one of --unit-template and --exec can be used"))
+	}
+	if !opts.DropIn && opts.UnitTemplate == "" && opts.Exec == "" {
+		errs.Add(errors.New("service: --unit-template or --exec is required unless --drop-in is used"))
+	}
+	if opts.DropIn && opts.UnitTemplate == "" && opts.Exec == "" && len(opts.EnvSecrets) == 0 {
+		errs.Add(errors.New("service: --drop-in requires --unit-template, --exec or --env-secret"))
+	}
+	if err := validState(opts.State); err != nil {
+		errs.Add(fmt.Errorf("service: %w", err))
+	}
+	for _, envSecret := range opts.EnvSecrets {
+		_, _, err := parseEnvSecret(envSecret)
+		errs.Add(err)
+	}
+	return errs.Err()
+}
+
+func (op Service) References(targ interface{}) []operator.Reference {
+	opts := targ.(*ServiceOpts)
+	if opts.UnitTemplate == "" {
+		return nil
+	}
+	return templateop.References(opts.UnitTemplate, opts.DataPaths)
+}
+
+func (op Service) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*ServiceOpts)
+	st := state.State{}
+
+	for _, p := range opts.paths() {
+		entry, err := fileop.ChecksumEntry(octx, p)
+		if err != nil {
+			return st, err
+		}
+		st = st.Append(entry)
+	}
+
+	status, err := showUnit(octx, unitName(opts.Name))
+	if err != nil {
+		return st, err
+	}
+	return st.Append(state.Entry{
+		Name: unitName(opts.Name),
+		KV:   status.toMap(),
+	}), nil
+}
+
+// DesiredState returns the checksums of the rendered unit and environment
+// file. The unit's status is its current status, which is the same as the
+// previous state after the service was applied, so the operation is dirty
+// whenever the unit was stopped or disabled since.
+func (op Service) DesiredState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*ServiceOpts)
+	st := state.State{}
+
+	files, _, err := op.render(octx)
+	if err != nil {
+		return st, err
+	}
+	for _, p := range opts.paths() {
+		checksum, err := fileop.ChecksumReader(bytes.NewReader(files[p]))
+		if err != nil {
+			return st, err
+		}
+		st = st.Append(state.Entry{
+			Name: p,
+			File: &opfs.StateFileEntry{
+				SHA256: checksum,
+				Info: opfs.StateFileInfo{
+					RawName: p,
+					SHA256:  checksum,
+				},
+			},
+		})
+	}
+
+	status, err := showUnit(octx, unitName(opts.Name))
+	if err != nil {
+		return st, err
+	}
+	return st.Append(state.Entry{
+		Name: unitName(opts.Name),
+		KV:   status.toMap(),
+	}), nil
+}
+
+// DesiredContents returns the unit and environment file, with secret values
+// masked.
+func (op Service) DesiredContents(octx operator.Context) ([]operator.DesiredContent, error) {
+	opts := op.Args.(*ServiceOpts)
+	files, secrets, err := op.render(octx)
+	if err != nil {
+		return nil, err
+	}
+	var res []operator.DesiredContent
+	for _, p := range opts.paths() {
+		res = append(res, operator.DesiredContent{Path: p, Contents: files[p], Secrets: secrets})
+	}
+	return res, nil
+}
+
+func (op Service) Run(octx operator.Context) error {
+	opts := op.Args.(*ServiceOpts)
+	files, _, err := op.render(octx)
+	if err != nil {
+		return err
+	}
+
+	unitChanged := false
+	for _, p := range opts.paths() {
+		var mode fs.FileMode = 0644
+		if p == opts.envPath() {
+			mode = 0600
+		}
+		changed, err := fileop.WriteIfChanged(octx, p, files[p], mode)
+		if err != nil {
+			return err
+		}
+		unitChanged = unitChanged || (changed && p == opts.unitPath())
+	}
+	if unitChanged {
+		if err := systemctl(octx, "daemon-reload"); err != nil {
+			return err
+		}
+	}
+	return reconcile(octx, unitName(opts.Name), unitWant{
+		manageEnabled: true,
+		enabled:       opts.Enabled,
+		state:         opts.State,
+		restart:       true,
+	})
+}
+
+// paths returns the unit or drop-in path, followed by the environment file
+// path if there are secrets.
+func (opts *ServiceOpts) paths() []string {
+	paths := []string{opts.unitPath()}
+	if p := opts.envPath(); p != "" {
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+func (opts *ServiceOpts) unitPath() string {
+	unit := unitName(opts.Name)
+	if opts.DropIn {
+		return filepath.Join(opts.UnitDir, unit+".d", "polyester.conf")
+	}
+	return filepath.Join(opts.UnitDir, unit)
+}
+
+func (opts *ServiceOpts) envPath() string {
+	if len(opts.EnvSecrets) == 0 {
+		return ""
+	}
+	return filepath.Join(opts.EnvDir, unitName(opts.Name)+".env")
+}
+
+// render returns the contents of each of the service's files, keyed by path,
+// and the secret values they contain.
+func (op Service) render(octx operator.Context) (map[string][]byte, [][]byte, error) {
+	opts := op.Args.(*ServiceOpts)
+	files := make(map[string][]byte)
+	var secrets [][]byte
+
+	envPath := opts.envPath()
+	if envPath != "" {
+		secretData, err := templateop.ReadSecrets(octx, opts.IdentityPaths)
+		if err != nil {
+			return nil, nil, err
+		}
+		env, envSecrets, err := renderEnv(opts.EnvSecrets, secretData)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[envPath] = env
+		secrets = append(secrets, envSecrets...)
+	}
+
+	unitPath := opts.unitPath()
+	if opts.UnitTemplate != "" {
+		b, secretData, err := templateop.Render(octx, opts.UnitTemplate, unitPath, opts.DataPaths, opts.IdentityPaths)
+		if err != nil {
+			return nil, nil, err
+		}
+		if envPath != "" {
+			b = append(b, fmt.Sprintf("\n[Service]\nEnvironmentFile=%s\n", envPath)...)
+		}
+		files[unitPath] = b
+		for _, v := range secretData {
+			secrets = append(secrets, v)
+		}
+	} else {
+		files[unitPath] = opts.generateUnit()
+	}
+	return files, secrets, nil
+}
+
+// generateUnit returns a unit, or a drop-in, that runs opts.Exec.
+func (opts *ServiceOpts) generateUnit() []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("# managed by polyester\n")
+	if !opts.DropIn {
+		desc := opts.Description
+		if desc == "" {
+			desc = opts.Name
+		}
+		fmt.Fprintf(buf, "[Unit]\nDescription=%s\n\n", desc)
+	}
+
+	buf.WriteString("[Service]\n")
+	if opts.Exec != "" {
+		if opts.DropIn {
+			// clear the ExecStart of the original unit
+			buf.WriteString("ExecStart=\n")
+		}
+		fmt.Fprintf(buf, "ExecStart=%s\n", opts.Exec)
+	}
+	if opts.User != "" {
+		fmt.Fprintf(buf, "User=%s\n", opts.User)
+	}
+	if p := opts.envPath(); p != "" {
+		fmt.Fprintf(buf, "EnvironmentFile=%s\n", p)
+	}
+	if !opts.DropIn {
+		buf.WriteString("Restart=on-failure\n\n[Install]\nWantedBy=multi-user.target\n")
+	}
+	return buf.Bytes()
+}
+
+// renderEnv returns a systemd environment file that sets each NAME=secret in
+// envSecrets, and the secret values.
+func renderEnv(envSecrets []string, secretData map[string][]byte) ([]byte, [][]byte, error) {
+	var lines []string
+	var secrets [][]byte
+	for _, envSecret := range envSecrets {
+		name, secret, err := parseEnvSecret(envSecret)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, ok := secretData[secret]
+		if !ok {
+			return nil, nil, fmt.Errorf("service: secret %q not found", secret)
+		}
+		v = bytes.TrimSuffix(v, []byte("\n"))
+		secrets = append(secrets, v)
+		lines = append(lines, fmt.Sprintf("%s=%s", name, quoteEnv(string(v))))
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "\n") + "\n"), secrets, nil
+}
+
+func parseEnvSecret(s string) (string, string, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(parts[0], " \t\"'$\\") {
+		return "", "", fmt.Errorf("service: invalid --env-secret %q, expected NAME=secret", s)
+	}
+	return parts[0], parts[1], nil
+}
+
+// quoteEnv double-quotes s for a systemd environment file.
+func quoteEnv(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func serviceArgs(cmd *cobra.Command, args []string, target interface{}) error {
+	t := target.(*ServiceOpts)
+	t.Name = args[0]
+	return nil
+}
@@ -0,0 +1,83 @@
+package serviceop
+
+import (
+	"testing"
+
+	"github.com/jeffrom/polyester/operator"
+)
+
+func TestGenerateUnit(t *testing.T) {
+	tcs := []struct {
+		name   string
+		opts   *ServiceOpts
+		expect string
+	}{
+		{
+			name: "unit",
+			opts: &ServiceOpts{Name: "app", Exec: "/usr/bin/app --port 80", User: "app", UnitDir: "/etc/systemd/system"},
+			expect: "# managed by polyester\n[Unit]\nDescription=app\n\n[Service]\nExecStart=/usr/bin/app --port 80\nUser=app\n" +
+				"Restart=on-failure\n\n[Install]\nWantedBy=multi-user.target\n",
+		},
+		{
+			name: "drop-in",
+			opts: &ServiceOpts{Name: "nginx", Exec: "/usr/sbin/nginx -g 'daemon off;'", DropIn: true, EnvSecrets: []string{"A=a"}, EnvDir: "/etc/polyester/env"},
+			expect: "# managed by polyester\n[Service]\nExecStart=\nExecStart=/usr/sbin/nginx -g 'daemon off;'\n" +
+				"EnvironmentFile=/etc/polyester/env/nginx.service.env\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := string(tc.opts.generateUnit()); got != tc.expect {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestRenderEnv(t *testing.T) {
+	secrets := map[string][]byte{
+		"db/password": []byte("hunter2\n"),
+		"quoted":      []byte(`a "b" \c`),
+	}
+	b, masked, err := renderEnv([]string{"QUOTED=quoted", "DB_PASSWORD=db/password"}, secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "DB_PASSWORD=\"hunter2\"\nQUOTED=\"a \\\"b\\\" \\\\c\"\n"
+	if string(b) != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, b)
+	}
+	if len(masked) != 2 {
+		t.Errorf("expected 2 secrets to mask, got %d", len(masked))
+	}
+
+	if _, _, err := renderEnv([]string{"MISSING=missing"}, secrets); err == nil {
+		t.Error("expected a missing secret to fail")
+	}
+}
+
+func TestServiceValidate(t *testing.T) {
+	tcs := []struct {
+		name string
+		opts *ServiceOpts
+		ok   bool
+	}{
+		{name: "exec", opts: &ServiceOpts{Name: "a", Exec: "a", State: stateRunning}, ok: true},
+		{name: "drop-in secrets", opts: &ServiceOpts{Name: "a", DropIn: true, EnvSecrets: []string{"A=a"}, State: stateRunning}, ok: true},
+		{name: "no unit", opts: &ServiceOpts{Name: "a", State: stateRunning}},
+		{name: "both", opts: &ServiceOpts{Name: "a", Exec: "a", UnitTemplate: "a", State: stateRunning}},
+		{name: "bad state", opts: &ServiceOpts{Name: "a", Exec: "a", State: "asleep"}},
+		{name: "bad env secret", opts: &ServiceOpts{Name: "a", Exec: "a", EnvSecrets: []string{"A"}, State: stateRunning}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Service{}.Validate(operator.Context{}, tc.opts, true)
+			if tc.ok && err != nil {
+				t.Error("expected valid, got", err)
+			} else if !tc.ok && err == nil {
+				t.Error("expected validation to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,2 @@
+// Package serviceop contains operators for managing systemd services.
+package serviceop
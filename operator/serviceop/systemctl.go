@@ -0,0 +1,145 @@
+package serviceop
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/jeffrom/polyester/executil"
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/stdio"
+)
+
+const (
+	stateRunning = "running"
+	stateStopped = "stopped"
+)
+
+// unitStatus is the status of a unit, as reported by systemctl show.
+type unitStatus struct {
+	LoadState     string
+	ActiveState   string
+	UnitFileState string
+}
+
+func (s unitStatus) active() bool {
+	return s.ActiveState == "active" || s.ActiveState == "reloading" || s.ActiveState == "activating"
+}
+
+func (s unitStatus) enabled() bool {
+	return s.UnitFileState == "enabled" || s.UnitFileState == "enabled-runtime"
+}
+
+func (s unitStatus) toMap() map[string]interface{} {
+	return map[string]interface{}{
+		"active":  s.active(),
+		"enabled": s.enabled(),
+	}
+}
+
+// unitName returns name with the .service suffix if it doesn't have a unit
+// type suffix.
+func unitName(name string) string {
+	if filepath.Ext(name) == "" {
+		return name + ".service"
+	}
+	return name
+}
+
+func validState(s string) error {
+	if s != stateRunning && s != stateStopped {
+		return fmt.Errorf("invalid state %q, expected %s or %s", s, stateRunning, stateStopped)
+	}
+	return nil
+}
+
+// showUnit returns the status of unit.
+func showUnit(octx operator.Context, unit string) (unitStatus, error) {
+	std := stdio.FromContext(octx.Context)
+	cmd := executil.CommandContext(octx.Context, "systemctl", "show", "--property=LoadState,ActiveState,UnitFileState", unit)
+	outb := &bytes.Buffer{}
+	cmd.Stdout = outb
+	cmd.Stderr = std.Stderr()
+	if err := cmd.Run(); err != nil {
+		return unitStatus{}, fmt.Errorf("systemctl show %s: %w", unit, err)
+	}
+
+	st := unitStatus{}
+	sc := bufio.NewScanner(outb)
+	for sc.Scan() {
+		parts := strings.SplitN(sc.Text(), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "LoadState":
+			st.LoadState = parts[1]
+		case "ActiveState":
+			st.ActiveState = parts[1]
+		case "UnitFileState":
+			st.UnitFileState = parts[1]
+		}
+	}
+	return st, sc.Err()
+}
+
+func systemctl(octx operator.Context, args ...string) error {
+	std := stdio.FromContext(octx.Context)
+	std.Debugf("systemctl %s", strings.Join(args, " "))
+	cmd := executil.CommandContext(octx.Context, "systemctl", args...)
+	cmd.Stdout = std.Stdout()
+	cmd.Stderr = std.Stderr()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// unitWant describes how reconcile should change a unit.
+type unitWant struct {
+	manageEnabled bool
+	enabled       bool
+	// state is running or stopped, or empty to leave the unit as it is.
+	state string
+	// restart and reload only apply to active units that should stay
+	// active. restart takes precedence.
+	restart bool
+	reload  bool
+}
+
+// reconcile enables or disables unit, and starts, stops, restarts or reloads
+// it, as described by want.
+func reconcile(octx operator.Context, unit string, want unitWant) error {
+	st, err := showUnit(octx, unit)
+	if err != nil {
+		return err
+	}
+	if want.manageEnabled && want.enabled && !st.enabled() {
+		if err := systemctl(octx, "enable", unit); err != nil {
+			return err
+		}
+	} else if want.manageEnabled && !want.enabled && st.enabled() {
+		if err := systemctl(octx, "disable", unit); err != nil {
+			return err
+		}
+	}
+
+	active := st.active()
+	switch {
+	case want.state == stateStopped:
+		if active {
+			return systemctl(octx, "stop", unit)
+		}
+	case want.state == stateRunning && !active:
+		return systemctl(octx, "start", unit)
+	case !active:
+		// nothing to restart or reload
+	case want.restart:
+		return systemctl(octx, "restart", unit)
+	case want.reload:
+		return systemctl(octx, "reload", unit)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package serviceop
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/fileop"
+	"github.com/jeffrom/polyester/operator/opfs"
+	"github.com/jeffrom/polyester/state"
+)
+
+const (
+	triggerRestart = "restart"
+	triggerReload  = "reload"
+)
+
+type SystemdOpts struct {
+	Unit          string   `json:"unit"`
+	ManageEnabled bool     `json:"manage_enabled,omitempty"`
+	Enabled       bool     `json:"enabled,omitempty"`
+	State         string   `json:"state,omitempty"`
+	RestartOn     []string `json:"restart_on,omitempty"`
+	ReloadOn      []string `json:"reload_on,omitempty"`
+}
+
+// Systemd enables, disables, starts and stops an existing systemd unit, and
+// restarts or reloads it when files matching --restart-on or --reload-on
+// change. Only the properties that are passed are managed.
+type Systemd struct {
+	Args interface{}
+}
+
+func (op Systemd) Info() operator.Info {
+	opts := op.Args.(*SystemdOpts)
+
+	cmd := &cobra.Command{
+		Use:   "systemd unit",
+		Args:  cobra.ExactArgs(1),
+		Short: "manages a systemd unit",
+	}
+	flags := cmd.Flags()
+	flags.BoolVar(&opts.Enabled, "enabled", false, "enable, or with --enabled=false disable, the unit")
+	flags.StringVar(&opts.State, "state", "", "run state of the unit: running or stopped")
+	flags.StringArrayVar(&opts.RestartOn, "restart-on", nil, "restart the unit when files matching `glob` change")
+	flags.StringArrayVar(&opts.ReloadOn, "reload-on", nil, "reload the unit when files matching `glob` change")
+
+	return &operator.InfoData{
+		OpName: "systemd",
+		Command: &operator.Command{
+			Command:   cmd,
+			ApplyArgs: systemdArgs,
+			Target:    opts,
+		},
+	}
+}
+
+func (op Systemd) Validate(octx operator.Context, targ interface{}, evaluated bool) error {
+	opts := targ.(*SystemdOpts)
+	var errs operator.Errors
+	if opts.State != "" {
+		if err := validState(opts.State); err != nil {
+			errs.Add(fmt.Errorf("systemd: %w", err))
+		}
+	}
+	if !opts.ManageEnabled && opts.State == "" && len(opts.RestartOn) == 0 && len(opts.ReloadOn) == 0 {
+		errs.Add(errors.New("systemd: at least one of --enabled, --state, --restart-on or --reload-on is required"))
+	}
+	return errs.Err()
+}
+
+// GetState returns the checksum of each file matching --restart-on and
+// --reload-on, and whether the unit is active and enabled, as reported by
+// systemctl show.
+func (op Systemd) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*SystemdOpts)
+	st := state.State{}
+
+	seen := make(map[string]bool)
+	for _, trigger := range []struct {
+		name  string
+		globs []string
+	}{
+		{triggerRestart, opts.RestartOn},
+		{triggerReload, opts.ReloadOn},
+	} {
+		for _, glob := range trigger.globs {
+			files, err := octx.FS.Glob(glob)
+			if err != nil {
+				return st, err
+			}
+			for _, fp := range files {
+				// restarting covers reloading
+				if seen[fp] {
+					continue
+				}
+				seen[fp] = true
+
+				entry, err := triggerEntry(octx, fp, trigger.name)
+				if err != nil {
+					return st, err
+				}
+				if entry.File != nil {
+					st = st.Append(entry)
+				}
+			}
+		}
+	}
+
+	status, err := showUnit(octx, unitName(opts.Unit))
+	if err != nil {
+		return st, err
+	}
+	return st.Append(state.Entry{
+		Name: unitName(opts.Unit),
+		KV:   status.toMap(),
+	}), nil
+}
+
+func (op Systemd) Run(octx operator.Context) error {
+	opts := op.Args.(*SystemdOpts)
+	curr, err := op.GetState(octx)
+	if err != nil {
+		return err
+	}
+	prev := octx.PrevState()
+
+	return reconcile(octx, unitName(opts.Unit), unitWant{
+		manageEnabled: opts.ManageEnabled,
+		enabled:       opts.Enabled,
+		state:         opts.State,
+		restart:       triggered(prev, curr, triggerRestart),
+		reload:        triggered(prev, curr, triggerReload),
+	})
+}
+
+// triggered returns true if the files for trigger changed between prev and
+// curr, including when a file was added or removed.
+func triggered(prev, curr state.State, trigger string) bool {
+	sums := func(st state.State) map[string][]byte {
+		res := make(map[string][]byte)
+		for _, ent := range st.Entries {
+			if ent.File != nil && ent.KV["on"] == trigger {
+				res[ent.Name] = ent.File.SHA256
+			}
+		}
+		return res
+	}
+	prevSums, currSums := sums(prev), sums(curr)
+	if len(prevSums) != len(currSums) {
+		return true
+	}
+	for name, sum := range currSums {
+		prevSum, ok := prevSums[name]
+		if !ok || !bytes.Equal(prevSum, sum) {
+			return true
+		}
+	}
+	return false
+}
+
+// triggerEntry returns the checksum of fp. Only the checksum is kept, so
+// rewriting a file with the same contents doesn't trigger a restart.
+func triggerEntry(octx operator.Context, fp, trigger string) (state.Entry, error) {
+	entry := state.Entry{
+		Name: fp,
+		KV:   map[string]interface{}{"on": trigger},
+	}
+	info, err := octx.FS.Stat(fp)
+	if errors.Is(err, os.ErrNotExist) {
+		return entry, nil
+	} else if err != nil {
+		return entry, err
+	}
+	if info.IsDir() {
+		return entry, nil
+	}
+	checksum, err := fileop.Checksum(octx.FS.Join(fp))
+	if err != nil {
+		return entry, err
+	}
+	entry.File = &opfs.StateFileEntry{
+		SHA256: checksum,
+		Info: opfs.StateFileInfo{
+			RawName: fp,
+			SHA256:  checksum,
+		},
+	}
+	return entry, nil
+}
+
+func systemdArgs(cmd *cobra.Command, args []string, target interface{}) error {
+	t := target.(*SystemdOpts)
+	t.Unit = args[0]
+	t.ManageEnabled = cmd.Flags().Changed("enabled")
+	return nil
+}
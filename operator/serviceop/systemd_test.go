@@ -0,0 +1,63 @@
+package serviceop
+
+import (
+	"testing"
+
+	"github.com/jeffrom/polyester/operator/opfs"
+	"github.com/jeffrom/polyester/state"
+)
+
+func TestTriggered(t *testing.T) {
+	entry := func(name, trigger, sum string) state.Entry {
+		return state.Entry{
+			Name: name,
+			File: &opfs.StateFileEntry{SHA256: []byte(sum)},
+			KV:   map[string]interface{}{"on": trigger},
+		}
+	}
+	status := state.Entry{Name: "a.service", KV: map[string]interface{}{"active": true, "enabled": true}}
+	prev := state.State{Entries: []state.Entry{
+		entry("/etc/a.conf", triggerRestart, "a"),
+		entry("/etc/site", triggerReload, "b"),
+		status,
+	}}
+
+	tcs := []struct {
+		name    string
+		curr    state.State
+		restart bool
+		reload  bool
+	}{
+		{name: "unchanged", curr: prev},
+		{
+			name:    "restart",
+			curr:    state.State{Entries: []state.Entry{entry("/etc/a.conf", triggerRestart, "c"), entry("/etc/site", triggerReload, "b"), status}},
+			restart: true,
+		},
+		{
+			name:   "reload",
+			curr:   state.State{Entries: []state.Entry{entry("/etc/a.conf", triggerRestart, "a"), entry("/etc/site", triggerReload, "c"), status}},
+			reload: true,
+		},
+		{
+			name:    "added",
+			curr:    state.State{Entries: []state.Entry{entry("/etc/a.conf", triggerRestart, "a"), entry("/etc/b.conf", triggerRestart, "a"), entry("/etc/site", triggerReload, "b"), status}},
+			restart: true,
+		},
+		{
+			name:   "removed",
+			curr:   state.State{Entries: []state.Entry{entry("/etc/a.conf", triggerRestart, "a"), status}},
+			reload: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := triggered(prev, tc.curr, triggerRestart); got != tc.restart {
+				t.Errorf("expected restart %v, got %v", tc.restart, got)
+			}
+			if got := triggered(prev, tc.curr, triggerReload); got != tc.reload {
+				t.Errorf("expected reload %v, got %v", tc.reload, got)
+			}
+		})
+	}
+}
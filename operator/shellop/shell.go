@@ -13,6 +13,7 @@ import (
 	"github.com/jeffrom/polyester/operator/fileop"
 	"github.com/jeffrom/polyester/operator/opfs"
 	"github.com/jeffrom/polyester/state"
+	"github.com/jeffrom/polyester/stdio"
 )
 
 type ShellOpts struct {
@@ -148,12 +149,13 @@ func (op Shell) GetState(octx operator.Context) (state.State, error) {
 }
 
 func (op Shell) Run(octx operator.Context) error {
+	std := stdio.FromContext(octx.Context)
 	opts := op.Args.(*ShellOpts)
 	cmd := exec.CommandContext(octx.Context, "sh", "-c", opts.Script)
 	cmd.Dir = octx.FS.Join(opts.Dir)
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = std.Stdout()
+	cmd.Stderr = std.Stderr()
 	return cmd.Run()
 }
 
@@ -1,18 +1,14 @@
 package templateop
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
-	"os/user"
 	"path/filepath"
-	"strings"
 
 	"filippo.io/age"
-	"filippo.io/age/armor"
 	"github.com/spf13/cobra"
 
 	"github.com/jeffrom/polyester/operator"
@@ -27,6 +23,7 @@ type TemplateOpts struct {
 	Dests         []string `json:"dests"`
 	DataPaths     []string `json:"data,omitempty"`
 	IdentityPaths []string `json:"identities,omitempty"`
+	fileop.PermOpts
 }
 
 type Template struct {
@@ -44,7 +41,7 @@ func (op Template) Info() operator.Info {
 	flags := cmd.Flags()
 	flags.StringArrayVarP(&opts.DataPaths, "data", "d", nil, "template data `file`(s)")
 	flags.StringArrayVarP(&opts.IdentityPaths, "age-identity", "i", nil, "path(s) to age identity `file`(s)")
-	// flags.Uint32VarP(&opts.Mode, "mode", "m", 0644, "the mode to set the file to")
+	fileop.AddFilePermFlags(cmd, &opts.PermOpts)
 
 	return &operator.InfoData{
 		OpName: "template",
@@ -56,6 +53,11 @@ func (op Template) Info() operator.Info {
 	}
 }
 
+func (op Template) References(targ interface{}) []operator.Reference {
+	opts := targ.(*TemplateOpts)
+	return References(opts.Path, opts.DataPaths)
+}
+
 func (op Template) GetState(octx operator.Context) (state.State, error) {
 	opts := op.Args.(*TemplateOpts)
 	st := state.State{}
@@ -78,12 +80,17 @@ func (op Template) GetState(octx operator.Context) (state.State, error) {
 
 		var fi *opfs.StateFileEntry
 		if len(checksum) > 0 {
+			sfi := opfs.StateFileInfo{
+				RawName: dest,
+				SHA256:  checksum,
+			}
+			if opts.Mode != 0 {
+				sfi.RawMode = info.Mode()
+			}
+			sfi.SetOwner(info)
 			fi = &opfs.StateFileEntry{
 				SHA256: checksum,
-				Info: opfs.StateFileInfo{
-					RawName: dest,
-					SHA256:  checksum,
-				},
+				Info:   sfi,
 			}
 		}
 		st = st.Append(state.Entry{
@@ -96,81 +103,165 @@ func (op Template) GetState(octx operator.Context) (state.State, error) {
 	return st, nil
 }
 
+// DesiredState returns the checksums of the rendered destinations. When
+// --mode, --owner or --group are set, the mode and owner are those of the
+// current destination, which are the same as the previous state after the
+// template was applied, so the operation is dirty whenever they were changed
+// since.
 func (op Template) DesiredState(octx operator.Context) (state.State, error) {
-	// return state.New(), nil
 	opts := op.Args.(*TemplateOpts)
 	st := state.State{}
 
-	identities, err := readIdentities(octx, opts)
-	if err != nil {
-		return st, err
-	}
-	userData, err := readUserData(octx, opts)
-	if err != nil {
-		return st, err
-	}
-	secretData, err := readSecretData(octx, identities, opts)
+	rendered, _, err := renderDests(octx, opts)
 	if err != nil {
 		return st, err
 	}
-	// fmt.Printf("template: DesiredState opts: %+v\ndata:%+v\nsecrets: %+v\n", opts, userData, secretData)
-
 	for i, dest := range opts.Dests {
-		b, err := executeTemplate(octx, opts.Path, dest, i, userData, secretData)
+		checksum, err := fileop.ChecksumReader(bytes.NewReader(rendered[i]))
 		if err != nil {
 			return st, err
 		}
+		// fmt.Printf("checksum %x, rendered:\n%s\n", checksum, string(rendered[i]))
 
-		checksum, err := fileop.ChecksumReader(bytes.NewReader(b))
-		if err != nil {
+		sfi := opfs.StateFileInfo{
+			RawName: dest,
+			RawMode: fs.FileMode(opts.Mode),
+			SHA256:  checksum,
+		}
+		info, err := octx.FS.Stat(dest)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return st, err
 		}
-		// fmt.Printf("checksum %x, rendered:\n%s\n", checksum, string(b))
-
+		if info != nil && !info.IsDir() {
+			if opts.Mode != 0 {
+				sfi.RawMode = info.Mode()
+			}
+			if opts.Owner != "" || opts.Group != "" {
+				sfi.SetOwner(info)
+			}
+		}
 		st = st.Append(state.Entry{
 			Name: dest,
 			File: &opfs.StateFileEntry{
 				SHA256: checksum,
-				Info: opfs.StateFileInfo{
-					RawName: dest,
-					SHA256:  checksum,
-				},
+				Info:   sfi,
 			},
 		})
 	}
 	return st, nil
 }
 
-func (op Template) Run(octx operator.Context) error {
+// DesiredContents renders the template for each destination. Decrypted secret
+// values are returned as Secrets so they can be masked before the contents
+// are shown.
+func (op Template) DesiredContents(octx operator.Context) ([]operator.DesiredContent, error) {
 	opts := op.Args.(*TemplateOpts)
-	identities, err := readIdentities(octx, opts)
+	rendered, secretData, err := renderDests(octx, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	userData, err := readUserData(octx, opts)
-	if err != nil {
-		return err
+
+	var secrets [][]byte
+	for _, v := range secretData {
+		secrets = append(secrets, v)
+	}
+	res := make([]operator.DesiredContent, len(opts.Dests))
+	for i, dest := range opts.Dests {
+		res[i] = operator.DesiredContent{
+			Path:     dest,
+			Contents: rendered[i],
+			Secrets:  secrets,
+		}
 	}
-	secretData, err := readSecretData(octx, identities, opts)
+	return res, nil
+}
+
+func (op Template) Run(octx operator.Context) error {
+	opts := op.Args.(*TemplateOpts)
+	rendered, _, err := renderDests(octx, opts)
 	if err != nil {
 		return err
 	}
 	for i, dest := range opts.Dests {
-		b, err := executeTemplate(octx, opts.Path, dest, i, userData, secretData)
-		if err != nil {
+		var mode fs.FileMode = 0644
+		fi, err := os.Stat(octx.FS.Join(dest))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
 			return err
 		}
-
-		if fi, err := os.Stat(octx.FS.Join(dest)); err == nil && fi.IsDir() {
+		if fi != nil && fi.IsDir() {
 			return fmt.Errorf("template: dir destination not supported: %q", dest)
 		}
-		if err := os.WriteFile(octx.FS.Join(dest), b, 0644); err != nil {
+		if fi != nil {
+			mode = fi.Mode().Perm()
+		}
+		if err := fileop.WriteFileAtomicPerms(octx.FS.Join(dest), rendered[i], mode, opts.PermOpts); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// renderDests renders the template for each destination, in the same order
+// as opts.Dests. The decrypted secrets used to render them are also returned.
+func renderDests(octx operator.Context, opts *TemplateOpts) ([][]byte, map[string][]byte, error) {
+	userData, err := readUserData(octx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	secretData, err := readSecretData(octx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	// fmt.Printf("template: renderDests opts: %+v\ndata:%+v\nsecrets: %+v\n", opts, userData, secretData)
+
+	rendered := make([][]byte, len(opts.Dests))
+	for i, dest := range opts.Dests {
+		b, err := executeTemplate(octx, opts.Path, dest, i, userData, secretData)
+		if err != nil {
+			return nil, nil, err
+		}
+		rendered[i] = b
+	}
+	return rendered, secretData, nil
+}
+
+// Render renders the template at p for dest, using the same data and secrets
+// as a template operation with dataPaths and identityPaths. The decrypted
+// secrets are also returned, so they can be masked.
+func Render(octx operator.Context, p, dest string, dataPaths, identityPaths []string) ([]byte, map[string][]byte, error) {
+	opts := &TemplateOpts{Path: p, DataPaths: dataPaths, IdentityPaths: identityPaths}
+	userData, err := readUserData(octx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	secretData, err := readSecretData(octx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := executeTemplate(octx, p, dest, 0, userData, secretData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, secretData, nil
+}
+
+// ReadSecrets returns the secrets available to templates in the current
+// plan, decrypted with the identities configured for the apply plus
+// identityPaths.
+func ReadSecrets(octx operator.Context, identityPaths []string) (map[string][]byte, error) {
+	return readSecretData(octx, &TemplateOpts{IdentityPaths: identityPaths})
+}
+
+// References returns the manifest paths a template at p, rendered with
+// dataPaths, reads.
+func References(p string, dataPaths []string) []operator.Reference {
+	refs := []operator.Reference{{Kind: "templates", Path: p}}
+	for _, dataPath := range dataPaths {
+		refs = append(refs, operator.Reference{Kind: "vars", Path: dataPath})
+	}
+	return refs
+}
+
 func templateArgs(cmd *cobra.Command, args []string, target interface{}) error {
 	t := target.(*TemplateOpts)
 	t.Path = args[0]
@@ -200,78 +291,34 @@ func readUserData(octx operator.Context, opts *TemplateOpts) (map[string]interfa
 	return userData, nil
 }
 
-func readSecretData(octx operator.Context, ids []age.Identity, opts *TemplateOpts) (map[string][]byte, error) {
-	secretPaths, err := octx.PlanDir.Resolve("secrets", []string{"**/*.age"})
-	if err != nil && !errors.Is(err, opfs.ErrNotFound) {
-		return nil, err
+// readSecretData returns the manifest's secrets merged with the current
+// plan's. Secrets are decrypted with the identities configured for the apply,
+// plus any passed to the operator with --age-identity.
+func readSecretData(octx operator.Context, opts *TemplateOpts) (map[string][]byte, error) {
+	dirs := []string{octx.PlanDir.Join("secrets")}
+	if sp := octx.PlanDir.Subplan(); sp != "" {
+		dirs = append(dirs, octx.PlanDir.Join("plans", sp, "secrets"))
 	}
-
-	res := make(map[string][]byte)
-	for _, secretPath := range secretPaths {
-		// fmt.Println("planDir opening", secretPath, convertSecretPath(secretPath, octx.PlanDir.Subplan()))
-		f, err := octx.PlanDir.Open(secretPath)
-		if err != nil {
-			return nil, err
-		}
-		defer f.Close()
-
-		decrypted, err := ageDecrypt(f, ids...)
-		if err != nil {
-			return nil, err
-		}
-		f.Close()
-		res[convertSecretPath(secretPath, octx.PlanDir.Subplan())] = decrypted
+	if len(opts.IdentityPaths) == 0 {
+		return octx.Templates.MergeSecrets(dirs)
 	}
-	return res, nil
-}
 
-func readIdentities(octx operator.Context, opts *TemplateOpts) ([]age.Identity, error) {
-	var res []age.Identity
-	// TODO proper XDG config
-	homeDir := os.Getenv("HOME")
-	if homeDir == "" {
-		currUser, err := user.Current()
-		if err != nil {
-			return nil, err
-		}
-		homeDir = filepath.Join("home", currUser.Name)
-	}
-	ageCfgDir := filepath.Join(homeDir, ".config", "polyester", "age")
-	if _, err := os.Stat(ageCfgDir); err == nil {
-		files, err := os.ReadDir(ageCfgDir)
-		if err != nil {
-			return nil, err
-		}
-		for _, fi := range files {
-			if fi.IsDir() {
-				continue
-			}
-			// fmt.Println("zorp", filepath.Join(ageCfgDir, fi.Name()))
-			b, err := os.ReadFile(filepath.Join(ageCfgDir, fi.Name()))
-			if err != nil {
-				return nil, err
-			}
-			ids, err := age.ParseIdentities(bytes.NewReader(b))
-			if err != nil {
-				return nil, err
-			}
-			res = append(res, ids...)
-		}
+	ids, err := octx.Templates.Identities()
+	if err != nil {
+		return nil, err
 	}
-
 	for _, p := range opts.IdentityPaths {
 		b, err := octx.FS.ReadFile(p)
 		if err != nil {
 			return nil, err
 		}
-		ids, err := age.ParseIdentities(bytes.NewReader(b))
+		next, err := age.ParseIdentities(bytes.NewReader(b))
 		if err != nil {
 			return nil, err
 		}
-
-		res = append(res, ids...)
+		ids = append(ids, next...)
 	}
-	return res, nil
+	return templates.DecryptSecrets(dirs, ids...)
 }
 
 func executeTemplate(octx operator.Context, p string, dest string, destIdx int, userData map[string]interface{}, secretData map[string][]byte) ([]byte, error) {
@@ -294,42 +341,6 @@ func executeTemplate(octx operator.Context, p string, dest string, destIdx int,
 	return b, nil
 }
 
-func ageDecrypt(src io.Reader, identities ...age.Identity) ([]byte, error) {
-	rr := bufio.NewReader(src)
-	if start, _ := rr.Peek(len(armor.Header)); string(start) == armor.Header {
-		src = armor.NewReader(rr)
-	} else {
-		src = rr
-	}
-	decrypted, err := age.Decrypt(src, identities...)
-	if err != nil {
-		return nil, err
-	}
-
-	return io.ReadAll(decrypted)
-}
-
-const sep = string(filepath.Separator)
-
-func convertSecretPath(p, spdir string) string {
-	if strings.HasPrefix(p, "secrets"+sep) {
-		p = strings.TrimPrefix(p, "secrets"+sep)
-	}
-	dir, file := filepath.Split(p)
-	var convertedFile string
-	switch filepath.Ext(file) {
-	case ".age":
-		convertedFile = strings.TrimSuffix(file, ".age")
-	default:
-		panic("template: secret file extension not supported: " + p)
-	}
-	if strings.HasPrefix(p, filepath.Join("plans", spdir)) {
-		return convertedFile
-	}
-	// fmt.Println("convertSecretPath", convertedFile, filepath.Join(dir, convertedFile))
-	return filepath.Join(dir, convertedFile)
-}
-
 func resolveTemplatePath(octx operator.Context, p string) (string, error) {
 	if sp := octx.PlanDir.Subplan(); sp != "" {
 		return filepath.Join(sp, p), nil
@@ -50,7 +50,3 @@ func (t *Templates) MergeData(dataPaths []string) (map[string]interface{}, error
 	}
 	return res, nil
 }
-
-func (t *Templates) MergeSecrets(secretDirs []string) (map[string][]byte, error) {
-	return nil, nil
-}
@@ -0,0 +1,245 @@
+package templates
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// SetIdentities sets the age identities used to decrypt secrets, instead of
+// loading them. It should be called once, before any templates are rendered.
+func (t *Templates) SetIdentities(ids []age.Identity) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.loadOnce.Do(func() {})
+	t.identities = ids
+	t.secrets = nil
+}
+
+// SetIdentityPaths sets the identity files used to decrypt secrets, in
+// addition to those in ~/.config/polyester/age. They are only read the first
+// time a secret is decrypted, so manifests without secrets never read them.
+func (t *Templates) SetIdentityPaths(paths []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.identityPaths = paths
+}
+
+// Identities returns a copy of the age identities used to decrypt secrets,
+// which callers can append to without affecting other plans.
+func (t *Templates) Identities() ([]age.Identity, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.loadIdentities(); err != nil {
+		return nil, err
+	}
+	return append([]age.Identity{}, t.identities...), nil
+}
+
+// loadIdentities reads the identities the first time it is called. t.mu must
+// be held.
+func (t *Templates) loadIdentities() error {
+	t.loadOnce.Do(func() {
+		t.identities, t.loadErr = LoadIdentities(t.identityPaths)
+	})
+	return t.loadErr
+}
+
+// MergeSecrets decrypts every age-encrypted file under each of secretDirs,
+// using the identities set with SetIdentities or SetIdentityPaths. Secrets are keyed by their
+// path relative to the secrets directory, without the .age extension. When
+// the same key is in more than one directory, the last one wins, so plan
+// secrets should follow manifest secrets. Directories that don't exist are
+// skipped. Results are cached, so each directory is only decrypted once.
+func (t *Templates) MergeSecrets(secretDirs []string) (map[string][]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := strings.Join(secretDirs, "\x00")
+	if res, ok := t.secrets[key]; ok {
+		return res, nil
+	}
+	res, err := decryptSecrets(secretDirs, func() ([]age.Identity, error) {
+		if err := t.loadIdentities(); err != nil {
+			return nil, err
+		}
+		return t.identities, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t.secrets == nil {
+		t.secrets = make(map[string]map[string][]byte)
+	}
+	t.secrets[key] = res
+	return res, nil
+}
+
+// DecryptSecrets is MergeSecrets for a specific set of identities, without
+// caching.
+func DecryptSecrets(secretDirs []string, ids ...age.Identity) (map[string][]byte, error) {
+	return decryptSecrets(secretDirs, func() ([]age.Identity, error) { return ids, nil })
+}
+
+// decryptSecrets is DecryptSecrets for identities that are only needed once a
+// secret is found.
+func decryptSecrets(secretDirs []string, identities func() ([]age.Identity, error)) (map[string][]byte, error) {
+	res := make(map[string][]byte)
+	for _, dir := range secretDirs {
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || filepath.Ext(p) != ".age" {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			ids, err := identities()
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			decrypted, err := Decrypt(f, ids...)
+			if err != nil {
+				return fmt.Errorf("templates: failed to decrypt %s: %w", p, err)
+			}
+			res[strings.TrimSuffix(rel, ".age")] = decrypted
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// DecryptSecret decrypts the secret called name from the last of secretDirs
+// that has it, so plan secrets override manifest secrets as in MergeSecrets.
+func DecryptSecret(secretDirs []string, name string, ids ...age.Identity) ([]byte, error) {
+	for i := len(secretDirs) - 1; i >= 0; i-- {
+		p := filepath.Join(secretDirs[i], filepath.FromSlash(name)+".age")
+		f, err := os.Open(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		b, err := Decrypt(f, ids...)
+		if err != nil {
+			return nil, fmt.Errorf("templates: failed to decrypt %s: %w", p, err)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("templates: secret %q not found", name)
+}
+
+// Decrypt decrypts binary or armored age-encrypted data.
+func Decrypt(src io.Reader, identities ...age.Identity) ([]byte, error) {
+	rr := bufio.NewReader(src)
+	if start, _ := rr.Peek(len(armor.Header)); string(start) == armor.Header {
+		src = armor.NewReader(rr)
+	} else {
+		src = rr
+	}
+	decrypted, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(decrypted)
+}
+
+// Encrypt encrypts plaintext to each of recipients. If armored is true, the
+// output is PEM-encoded.
+func Encrypt(w io.Writer, plaintext []byte, armored bool, recipients ...age.Recipient) error {
+	if len(recipients) == 0 {
+		return errors.New("templates: no recipients to encrypt to")
+	}
+	out := w
+	var aw io.WriteCloser
+	if armored {
+		aw = armor.NewWriter(w)
+		out = aw
+	}
+	ew, err := age.Encrypt(out, recipients...)
+	if err != nil {
+		return err
+	}
+	if _, err := ew.Write(plaintext); err != nil {
+		return err
+	}
+	if err := ew.Close(); err != nil {
+		return err
+	}
+	if aw != nil {
+		return aw.Close()
+	}
+	return nil
+}
+
+// LoadIdentities reads age identities from every file in
+// ~/.config/polyester/age, followed by each of paths.
+func LoadIdentities(paths []string) ([]age.Identity, error) {
+	// TODO proper XDG config
+	homeDir := os.Getenv("HOME")
+	if homeDir == "" {
+		currUser, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		homeDir = currUser.HomeDir
+	}
+
+	var allPaths []string
+	ageCfgDir := filepath.Join(homeDir, ".config", "polyester", "age")
+	if _, err := os.Stat(ageCfgDir); err == nil {
+		files, err := os.ReadDir(ageCfgDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range files {
+			if fi.IsDir() {
+				continue
+			}
+			allPaths = append(allPaths, filepath.Join(ageCfgDir, fi.Name()))
+		}
+	}
+	allPaths = append(allPaths, paths...)
+
+	var res []age.Identity
+	for _, p := range allPaths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		ids, err := age.ParseIdentities(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("templates: failed to read identities from %s: %w", p, err)
+		}
+		res = append(res, ids...)
+	}
+	return res, nil
+}
@@ -0,0 +1,165 @@
+package templates
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestMergeSecrets(t *testing.T) {
+	ids, err := LoadIdentities([]string{testenv.Path("testdata", "age.agent.key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) == 0 {
+		t.Fatal("expected identities")
+	}
+
+	root := testenv.Path("testdata", "template")
+	tmpl := New(root)
+	tmpl.SetIdentities(ids)
+	secrets, err := tmpl.MergeSecrets([]string{
+		filepath.Join(root, "secrets"),
+		filepath.Join(root, "plans", "nice", "secrets"),
+		filepath.Join(root, "plans", "missing", "secrets"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"wow", "with.ext"} {
+		if len(secrets[key]) == 0 {
+			t.Errorf("expected secret %q, got keys %v", key, keys(secrets))
+		}
+	}
+	if len(secrets) != 2 {
+		t.Errorf("expected 2 secrets, got %v", keys(secrets))
+	}
+
+	secret, err := DecryptSecret([]string{
+		filepath.Join(root, "secrets"),
+		filepath.Join(root, "plans", "nice", "secrets"),
+	}, "wow", ids...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != string(secrets["wow"]) {
+		t.Errorf("expected plan secret %q, got %q", secrets["wow"], secret)
+	}
+	if _, err := DecryptSecret([]string{filepath.Join(root, "secrets")}, "missing", ids...); err == nil {
+		t.Error("expected missing secret to fail")
+	}
+
+	tmpl.SetIdentities(nil)
+	if _, err := tmpl.MergeSecrets([]string{filepath.Join(root, "secrets")}); err == nil {
+		t.Error("expected decrypting without identities to fail")
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	id1, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, armored := range []bool{true, false} {
+		buf := &bytes.Buffer{}
+		if err := Encrypt(buf, []byte("cool"), armored, id1.Recipient(), id2.Recipient()); err != nil {
+			t.Fatal(err)
+		}
+		ciphertext := buf.Bytes()
+		for _, id := range []age.Identity{id1, id2} {
+			b, err := Decrypt(bytes.NewReader(ciphertext), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "cool" {
+				t.Errorf("expected %q, got %q", "cool", b)
+			}
+		}
+	}
+
+	if err := Encrypt(&bytes.Buffer{}, []byte("cool"), true); err == nil {
+		t.Error("expected encrypting without recipients to fail")
+	}
+}
+
+func keys(m map[string][]byte) []string {
+	var res []string
+	for k := range m {
+		res = append(res, k)
+	}
+	return res
+}
+
+func TestIdentitiesCopy(t *testing.T) {
+	id1, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// spare capacity in the configured identities must not be shared between
+	// callers that append their own.
+	ids := make([]age.Identity, 1, 4)
+	ids[0] = id1
+	tmpl := New("")
+	tmpl.SetIdentities(ids)
+	a, err := tmpl.Identities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = append(a, id2)
+	b, err := tmpl.Identities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 1 || b[0] != age.Identity(id1) {
+		t.Errorf("expected identities to be unchanged, got %v", b)
+	}
+	if ids[:2][1] != nil {
+		t.Error("expected appending to the identities not to write to the shared array")
+	}
+	if len(a) != 2 {
+		t.Errorf("expected 2 identities, got %d", len(a))
+	}
+}
+
+func TestIdentitiesLazy(t *testing.T) {
+	tmpdir := testenv.TempDir(t, "")
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+	notKey := filepath.Join(tmpdir, "not-a-key")
+	testenv.WriteFile(t, notKey, "not an identity\n")
+
+	// identities aren't read until a secret is decrypted.
+	root := testenv.Path("testdata", "template")
+	tmpl := New(root)
+	tmpl.SetIdentityPaths([]string{notKey})
+	if _, err := tmpl.MergeSecrets([]string{filepath.Join(root, "plans", "missing", "secrets")}); err != nil {
+		t.Fatal("expected no identities to be read without secrets:", err)
+	}
+	if _, err := tmpl.MergeSecrets([]string{filepath.Join(root, "secrets")}); err == nil {
+		t.Error("expected decrypting with a bad identity file to fail")
+	}
+
+	tmpl = New(root)
+	tmpl.SetIdentityPaths([]string{testenv.Path("testdata", "age.agent.key")})
+	secrets, err := tmpl.MergeSecrets([]string{filepath.Join(root, "secrets")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets["wow"]) == 0 {
+		t.Errorf("expected secret %q, got keys %v", "wow", keys(secrets))
+	}
+}
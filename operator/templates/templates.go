@@ -8,8 +8,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"text/template"
 
+	"filippo.io/age"
+
 	"github.com/jeffrom/polyester/operator/facts"
 )
 
@@ -18,6 +21,16 @@ import (
 type Templates struct {
 	tmpl *template.Template
 	path string
+
+	mu         sync.Mutex
+	identities []age.Identity
+	// identityPaths are read, along with ~/.config/polyester/age, by
+	// loadIdentities the first time secrets are decrypted.
+	identityPaths []string
+	loadOnce      sync.Once
+	loadErr       error
+	// secrets caches decrypted secrets by their directories.
+	secrets map[string]map[string][]byte
 }
 
 func New(p string) *Templates {
@@ -0,0 +1,419 @@
+package userop
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/operator/fileop"
+	"github.com/jeffrom/polyester/operator/opfs"
+	"github.com/jeffrom/polyester/state"
+)
+
+type AuthorizedKeyOpts struct {
+	User      string   `json:"user"`
+	Keys      []string `json:"keys,omitempty"`
+	KeyFiles  []string `json:"key_files,omitempty"`
+	Options   []string `json:"options,omitempty"`
+	Exclusive bool     `json:"exclusive,omitempty"`
+	Absent    bool     `json:"absent,omitempty"`
+	Path      string   `json:"path,omitempty"`
+}
+
+// AuthorizedKey adds keys to, or with --absent removes them from, a user's
+// authorized_keys file. Keys that aren't managed by the operation are kept,
+// unless --exclusive is passed. Keys are matched by their type and data, so a
+// managed key's options and comment are updated in place.
+type AuthorizedKey struct {
+	Args interface{}
+}
+
+func (op AuthorizedKey) Info() operator.Info {
+	opts := op.Args.(*AuthorizedKeyOpts)
+
+	cmd := &cobra.Command{
+		Use:   "authorized-key user [key...]",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "manages keys in a user's ssh authorized_keys file",
+	}
+	flags := cmd.Flags()
+	flags.StringArrayVar(&opts.KeyFiles, "key-file", nil, "read keys from the plan's `file`, one per line")
+	flags.StringArrayVarP(&opts.Options, "option", "o", nil, "key `option`, such as from=\"10.0.0.0/8\" or command=\"uptime\"")
+	flags.BoolVar(&opts.Exclusive, "exclusive", false, "remove any keys that aren't managed by this operation")
+	flags.BoolVar(&opts.Absent, "absent", false, "remove the keys")
+	flags.StringVar(&opts.Path, "path", "", "the authorized keys `file` (default ~user/.ssh/authorized_keys)")
+
+	return &operator.InfoData{
+		OpName: "authorized-key",
+		Command: &operator.Command{
+			Command:   cmd,
+			ApplyArgs: authorizedKeyArgs,
+			Target:    opts,
+		},
+	}
+}
+
+func (op AuthorizedKey) Validate(octx operator.Context, targ interface{}, evaluated bool) error {
+	opts := targ.(*AuthorizedKeyOpts)
+	var errs operator.Errors
+	if len(opts.Keys) == 0 && len(opts.KeyFiles) == 0 && !opts.Exclusive {
+		errs.Add(errors.New("authorized-key: at least one key or --key-file is required"))
+	}
+	if opts.Exclusive && opts.Absent {
+		errs.Add(errors.New("authorized-key: --exclusive and --absent can't be used together"))
+	}
+	for _, k := range opts.Keys {
+		key, err := parseAuthorizedKey(k)
+		if err != nil {
+			errs.Add(fmt.Errorf("authorized-key: %w", err))
+			continue
+		}
+		if key.options != "" {
+			errs.Add(fmt.Errorf("authorized-key: key %s has options, use --option instead", key.fingerprint()))
+		}
+	}
+	return errs.Err()
+}
+
+func (op AuthorizedKey) References(targ interface{}) []operator.Reference {
+	opts := targ.(*AuthorizedKeyOpts)
+	refs := make([]operator.Reference, len(opts.KeyFiles))
+	for i, p := range opts.KeyFiles {
+		refs[i] = operator.Reference{Kind: "files", Path: p}
+	}
+	return refs
+}
+
+// GetState returns an entry for each managed key, with whether it's present
+// and its options, and the modes and owners of the authorized keys file and
+// its directory. In exclusive mode, unmanaged keys are also included. A user
+// that doesn't exist yet, such as one added earlier in the plan, has no keys.
+func (op AuthorizedKey) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*AuthorizedKeyOpts)
+	st := state.State{}
+	keys, err := op.keys(octx)
+	if err != nil {
+		return st, err
+	}
+	p, err := opts.keysPath()
+	if errors.Is(err, user.UnknownUserError(opts.User)) {
+		p = ""
+	} else if err != nil {
+		return st, err
+	}
+
+	var b []byte
+	if p != "" {
+		b, err = octx.FS.ReadFile(p)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) && !os.IsNotExist(err) {
+			return st, err
+		}
+	}
+	curr := parseAuthorizedKeys(b)
+
+	managed := make(map[string]bool)
+	for _, key := range keys {
+		fp := key.fingerprint()
+		managed[fp] = true
+		kv := map[string]interface{}{"present": false}
+		if found, ok := curr[fp]; ok {
+			kv["present"] = true
+			kv["options"] = found.options
+		}
+		st = st.Append(state.Entry{Name: fp, KV: kv})
+	}
+	if opts.Exclusive {
+		for fp := range curr {
+			if !managed[fp] {
+				st = st.Append(state.Entry{Name: fp, KV: map[string]interface{}{"present": true}})
+			}
+		}
+	}
+
+	if p == "" {
+		return st, nil
+	}
+	for _, fp := range []string{path.Dir(p), p} {
+		entry, err := ownerEntry(octx, fp)
+		if err != nil {
+			return st, err
+		}
+		st = st.Append(entry)
+	}
+	return st, nil
+}
+
+func (op AuthorizedKey) Run(octx operator.Context) error {
+	opts := op.Args.(*AuthorizedKeyOpts)
+	u, err := Lookup(opts.User)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return err
+	}
+	p, err := opts.keysPath()
+	if err != nil {
+		return err
+	}
+	keys, err := op.keys(octx)
+	if err != nil {
+		return err
+	}
+
+	dir := octx.FS.Join(path.Dir(p))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Lchown(dir, uid, gid); err != nil {
+		return err
+	}
+
+	b, err := octx.FS.ReadFile(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) && !os.IsNotExist(err) {
+		return err
+	}
+	next := opts.edit(b, keys)
+	if _, err := fileop.WriteIfChanged(octx, p, next, 0600); err != nil {
+		return err
+	}
+	dest := octx.FS.Join(p)
+	if err := os.Chmod(dest, 0600); err != nil {
+		return err
+	}
+	return os.Lchown(dest, uid, gid)
+}
+
+// edit returns the contents of the authorized keys file b with keys added or
+// removed. Comments and blank lines are kept.
+func (opts *AuthorizedKeyOpts) edit(b []byte, keys []authorizedKey) []byte {
+	byFP := make(map[string]authorizedKey)
+	for _, key := range keys {
+		// keys from --key-file can have their own options.
+		if len(opts.Options) > 0 {
+			key.options = strings.Join(opts.Options, ",")
+		}
+		byFP[key.fingerprint()] = key
+	}
+
+	buf := &bytes.Buffer{}
+	written := make(map[string]bool)
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := sc.Text()
+		key, err := parseAuthorizedKey(line)
+		if err != nil {
+			buf.WriteString(line + "\n")
+			continue
+		}
+		fp := key.fingerprint()
+		want, managed := byFP[fp]
+		switch {
+		case !managed && opts.Exclusive:
+		case !managed:
+			buf.WriteString(line + "\n")
+		case opts.Absent || written[fp]:
+		default:
+			if want.comment == "" {
+				want.comment = key.comment
+			}
+			buf.WriteString(want.String() + "\n")
+			written[fp] = true
+		}
+	}
+
+	if opts.Absent {
+		return buf.Bytes()
+	}
+	for _, key := range keys {
+		fp := key.fingerprint()
+		if written[fp] {
+			continue
+		}
+		buf.WriteString(byFP[fp].String() + "\n")
+		written[fp] = true
+	}
+	return buf.Bytes()
+}
+
+// keys returns the keys passed as arguments and read from --key-file.
+func (op AuthorizedKey) keys(octx operator.Context) ([]authorizedKey, error) {
+	opts := op.Args.(*AuthorizedKeyOpts)
+	lines := append([]string{}, opts.Keys...)
+	if len(opts.KeyFiles) > 0 {
+		files, err := octx.PlanDir.Resolve("files", opts.KeyFiles)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("authorized-key: no key files matched %q", opts.KeyFiles)
+		}
+		for _, f := range files {
+			b, err := os.ReadFile(octx.PlanDir.Join(f))
+			if err != nil {
+				return nil, err
+			}
+			for _, line := range strings.Split(string(b), "\n") {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+					lines = append(lines, line)
+				}
+			}
+		}
+	}
+
+	keys := make([]authorizedKey, len(lines))
+	for i, line := range lines {
+		key, err := parseAuthorizedKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("authorized-key: %w", err)
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+func (opts *AuthorizedKeyOpts) keysPath() (string, error) {
+	if opts.Path != "" {
+		return opts.Path, nil
+	}
+	u, err := Lookup(opts.User)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(u.HomeDir, ".ssh", "authorized_keys"), nil
+}
+
+// ownerEntry returns the mode and owner of the file at p.
+func ownerEntry(octx operator.Context, p string) (state.Entry, error) {
+	entry := state.Entry{Name: p}
+	info, err := octx.FS.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return entry, nil
+	} else if err != nil {
+		return entry, err
+	}
+	entry.KV = map[string]interface{}{
+		"mode": fmt.Sprintf("%#o", info.Mode().Perm()),
+	}
+	if uid, gid, ok := opfs.Owner(info); ok {
+		entry.KV["uid"] = strconv.Itoa(int(uid))
+		entry.KV["gid"] = strconv.Itoa(int(gid))
+	}
+	return entry, nil
+}
+
+// authorizedKey is a line of an authorized keys file, in the form
+// [options] type data [comment].
+type authorizedKey struct {
+	options string
+	typ     string
+	data    string
+	comment string
+}
+
+func (k authorizedKey) String() string {
+	parts := []string{k.typ, k.data}
+	if k.options != "" {
+		parts = append([]string{k.options}, parts...)
+	}
+	if k.comment != "" {
+		parts = append(parts, k.comment)
+	}
+	return strings.Join(parts, " ")
+}
+
+// fingerprint returns the key's type and SHA256 fingerprint, as printed by
+// ssh-keygen -l.
+func (k authorizedKey) fingerprint() string {
+	blob, _ := base64.StdEncoding.DecodeString(k.data)
+	sum := sha256.Sum256(blob)
+	return k.typ + " SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+func isKeyType(s string) bool {
+	return strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-") || strings.HasPrefix(s, "sk-")
+}
+
+func parseAuthorizedKey(line string) (authorizedKey, error) {
+	var key authorizedKey
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return key, errors.New("not a key")
+	}
+
+	rest := line
+	if first := strings.Fields(line)[0]; !isKeyType(first) {
+		key.options, rest = splitOptions(line)
+	}
+	fields := strings.Fields(rest)
+	if len(fields) < 2 || !isKeyType(fields[0]) {
+		return key, fmt.Errorf("invalid key %q", line)
+	}
+	if _, err := base64.StdEncoding.DecodeString(fields[1]); err != nil {
+		return key, fmt.Errorf("invalid key data in %q: %w", line, err)
+	}
+	key.typ, key.data = fields[0], fields[1]
+	key.comment = strings.Join(fields[2:], " ")
+	return key, nil
+}
+
+// splitOptions splits the options at the start of line from the rest of it.
+// Options end at the first whitespace outside of double quotes.
+func splitOptions(line string) (string, string) {
+	inQuote := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && inQuote:
+			i++
+		case c == '"':
+			inQuote = !inQuote
+		case (c == ' ' || c == '\t') && !inQuote:
+			return line[:i], line[i+1:]
+		}
+	}
+	return line, ""
+}
+
+// parseAuthorizedKeys returns the keys in an authorized keys file by their
+// fingerprint. Lines that aren't keys are skipped.
+func parseAuthorizedKeys(b []byte) map[string]authorizedKey {
+	res := make(map[string]authorizedKey)
+	for _, line := range strings.Split(string(b), "\n") {
+		key, err := parseAuthorizedKey(line)
+		if err != nil {
+			continue
+		}
+		fp := key.fingerprint()
+		if _, ok := res[fp]; !ok {
+			res[fp] = key
+		}
+	}
+	return res
+}
+
+func authorizedKeyArgs(cmd *cobra.Command, args []string, target interface{}) error {
+	t := target.(*AuthorizedKeyOpts)
+	t.User = args[0]
+	t.Keys = args[1:]
+	return nil
+}
@@ -0,0 +1,142 @@
+package userop
+
+import (
+	"testing"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/testenv"
+)
+
+const (
+	keyA = "ssh-ed25519 a2V5LWE= alice@laptop"
+	keyB = "ssh-ed25519 a2V5LWI= bob@laptop"
+	keyC = "ssh-rsa a2V5LWM= carol@laptop"
+)
+
+func TestParseAuthorizedKey(t *testing.T) {
+	tcs := []struct {
+		line    string
+		options string
+		typ     string
+		comment string
+		err     bool
+	}{
+		{line: keyA, typ: "ssh-ed25519", comment: "alice@laptop"},
+		{line: "ssh-ed25519 a2V5LWE=", typ: "ssh-ed25519"},
+		{
+			line:    `from="10.0.0.1",command="echo \"hi there\"" ssh-ed25519 a2V5LWE= alice laptop`,
+			options: `from="10.0.0.1",command="echo \"hi there\""`,
+			typ:     "ssh-ed25519",
+			comment: "alice laptop",
+		},
+		{line: "no-pty ecdsa-sha2-nistp256 a2V5LWE=", options: "no-pty", typ: "ecdsa-sha2-nistp256"},
+		{line: "# a comment", err: true},
+		{line: "ssh-ed25519", err: true},
+		{line: "ssh-ed25519 not-base64!", err: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.line, func(t *testing.T) {
+			key, err := parseAuthorizedKey(tc.line)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.options != tc.options || key.typ != tc.typ || key.comment != tc.comment {
+				t.Errorf("expected options %q, type %q, comment %q, got %+v", tc.options, tc.typ, tc.comment, key)
+			}
+		})
+	}
+}
+
+func TestAuthorizedKeysEdit(t *testing.T) {
+	tcs := []struct {
+		name   string
+		opts   *AuthorizedKeyOpts
+		curr   string
+		expect string
+	}{
+		{
+			name:   "add",
+			opts:   &AuthorizedKeyOpts{Keys: []string{keyA}},
+			expect: keyA + "\n",
+		},
+		{
+			name:   "keep unmanaged",
+			opts:   &AuthorizedKeyOpts{Keys: []string{keyA}},
+			curr:   "# added by hand\n" + keyB + "\n",
+			expect: "# added by hand\n" + keyB + "\n" + keyA + "\n",
+		},
+		{
+			name:   "update options in place",
+			opts:   &AuthorizedKeyOpts{Keys: []string{"ssh-ed25519 a2V5LWE="}, Options: []string{`from="10.0.0.0/8"`, "no-pty"}},
+			curr:   keyB + "\ncommand=\"uptime\" " + keyA + "\n" + keyC + "\n",
+			expect: keyB + "\nfrom=\"10.0.0.0/8\",no-pty " + keyA + "\n" + keyC + "\n",
+		},
+		{
+			name:   "absent",
+			opts:   &AuthorizedKeyOpts{Keys: []string{keyA, keyC}, Absent: true},
+			curr:   keyA + "\n" + keyB + "\n" + keyC + "\n",
+			expect: keyB + "\n",
+		},
+		{
+			name:   "exclusive",
+			opts:   &AuthorizedKeyOpts{Keys: []string{keyC}, Exclusive: true},
+			curr:   "# keys\n" + keyA + "\n" + keyB + "\n",
+			expect: "# keys\n" + keyC + "\n",
+		},
+		{
+			name:   "duplicates",
+			opts:   &AuthorizedKeyOpts{Keys: []string{keyA}},
+			curr:   keyA + "\n" + keyA + "\n",
+			expect: keyA + "\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var keys []authorizedKey
+			for _, k := range tc.opts.Keys {
+				key, err := parseAuthorizedKey(k)
+				if err != nil {
+					t.Fatal(err)
+				}
+				keys = append(keys, key)
+			}
+			if got := string(tc.opts.edit([]byte(tc.curr), keys)); got != tc.expect {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestAuthorizedKeyMissingUser(t *testing.T) {
+	octx := operator.NewContext(testenv.Context(), nil, nil, nil)
+	op := AuthorizedKey{Args: &AuthorizedKeyOpts{User: "polyester-nonexistent-user", Keys: []string{keyA}}}
+
+	// the user may be added by an earlier operation in the plan, so its
+	// keys are read as not present yet.
+	st, err := op.GetState(octx)
+	if err != nil {
+		t.Fatal("GetState failed:", err)
+	}
+	key, _ := parseAuthorizedKey(keyA)
+	ent, ok := st.Get(key.fingerprint())
+	if !ok {
+		t.Fatalf("expected a state entry for %s", key.fingerprint())
+	}
+	if present := ent.KV["present"]; present != false {
+		t.Errorf("expected the key not to be present, got %v", present)
+	}
+	if len(st.Entries) != 1 {
+		t.Errorf("expected only the key's entry, got %d entries", len(st.Entries))
+	}
+
+	if err := op.Run(octx); err == nil {
+		t.Error("expected Run to fail for a user that doesn't exist")
+	}
+}
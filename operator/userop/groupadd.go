@@ -0,0 +1,110 @@
+package userop
+
+import (
+	"errors"
+	"os/user"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/state"
+)
+
+type GroupaddOpts struct {
+	Group  string `json:"group"`
+	GID    string `json:"gid,omitempty"`
+	System bool   `json:"system,omitempty"`
+	Absent bool   `json:"absent,omitempty"`
+}
+
+// Groupadd adds a group, or changes the gid of an existing group if --gid
+// was passed. With --absent, the group is deleted instead.
+type Groupadd struct {
+	Args interface{}
+}
+
+func (op Groupadd) Info() operator.Info {
+	opts := op.Args.(*GroupaddOpts)
+
+	cmd := &cobra.Command{
+		Use:   "groupadd group",
+		Args:  cobra.ExactArgs(1),
+		Short: "adds a group",
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.GID, "gid", "g", "", "group `id`")
+	flags.BoolVarP(&opts.System, "system", "r", false, "create a system group")
+	flags.BoolVar(&opts.Absent, "absent", false, "delete the group")
+
+	return &operator.InfoData{
+		OpName: "groupadd",
+		Command: &operator.Command{
+			Command:   cmd,
+			ApplyArgs: groupaddArgs,
+			Target:    opts,
+		},
+	}
+}
+
+func (op Groupadd) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*GroupaddOpts)
+	st := state.State{}
+	g, err := lookupGroup(opts.Group)
+	if err != nil {
+		return st, err
+	}
+	st = st.Append(state.Entry{
+		Name: "%" + opts.Group,
+		KV:   map[string]interface{}{"exists": g != nil},
+	})
+	if g == nil || opts.Absent || opts.GID == "" {
+		return st, nil
+	}
+	return st.Append(state.Entry{
+		Name: "%" + opts.Group + "/gid",
+		KV:   map[string]interface{}{"gid": g.Gid},
+	}), nil
+}
+
+func (op Groupadd) Run(octx operator.Context) error {
+	opts := op.Args.(*GroupaddOpts)
+	g, err := lookupGroup(opts.Group)
+	if err != nil {
+		return err
+	}
+	if opts.Absent {
+		if g == nil {
+			return nil
+		}
+		return run(octx, "groupdel", opts.Group)
+	}
+	if g == nil {
+		args := []string{}
+		if opts.GID != "" {
+			args = append(args, "--gid", opts.GID)
+		}
+		if opts.System {
+			args = append(args, "--system")
+		}
+		return run(octx, "groupadd", append(args, opts.Group)...)
+	}
+	if opts.GID != "" && g.Gid != opts.GID {
+		return run(octx, "groupmod", "--gid", opts.GID, opts.Group)
+	}
+	return nil
+}
+
+// lookupGroup returns the group named name, or nil if it doesn't exist.
+func lookupGroup(name string) (*user.Group, error) {
+	g, err := user.LookupGroup(name)
+	if errors.Is(err, user.UnknownGroupError(name)) {
+		return nil, nil
+	}
+	return g, err
+}
+
+func groupaddArgs(cmd *cobra.Command, args []string, target interface{}) error {
+	t := target.(*GroupaddOpts)
+	t.Group = args[0]
+	return nil
+}
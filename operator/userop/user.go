@@ -72,3 +72,24 @@ func lookupShell(username string) (string, error) {
 	}
 	return parts[6], nil
 }
+
+// Groups returns the names of the user's supplementary groups, which don't
+// include its primary group.
+func (u *User) Groups() ([]string, error) {
+	gids, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, gid := range gids {
+		if gid == u.Gid {
+			continue
+		}
+		g, err := user.LookupGroupId(gid)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, g.Name)
+	}
+	return names, nil
+}
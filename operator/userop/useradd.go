@@ -3,18 +3,22 @@ package userop
 import (
 	"errors"
 	"os"
-	"os/exec"
 	"os/user"
+	"sort"
+	"strings"
 
 	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
 
+	"github.com/jeffrom/polyester/executil"
 	"github.com/jeffrom/polyester/operator"
 	"github.com/jeffrom/polyester/state"
+	"github.com/jeffrom/polyester/stdio"
 )
 
 type UseraddOpts struct {
 	User            string   `json:"user"`
+	UID             string   `json:"uid,omitempty"`
 	Shell           string   `json:"shell,omitempty"`
 	CreateHomeDir   string   `json:"home_dir,omitempty"`
 	Comment         string   `json:"comment,omitempty"`
@@ -26,6 +30,8 @@ type UseraddOpts struct {
 	RemoveGroups    []string `json:"remove_groups,omitempty"`
 }
 
+// Useradd adds a user, or updates an existing user's properties to match the
+// ones that were passed. Properties that weren't passed are left alone.
 type Useradd struct {
 	Args interface{}
 }
@@ -39,6 +45,7 @@ func (op Useradd) Info() operator.Info {
 		Short: "adds a user",
 	}
 	flags := cmd.Flags()
+	flags.StringVarP(&opts.UID, "uid", "u", "", "user `id`")
 	flags.StringVarP(&opts.Shell, "shell", "s", "", "user login `shell`")
 	flags.StringVarP(&opts.CreateHomeDir, "home-dir", "d", "", "create and use `dir` for home directory")
 	flags.StringVarP(&opts.Comment, "comment", "c", "", "description of user")
@@ -59,21 +66,53 @@ func (op Useradd) Info() operator.Info {
 	}
 }
 
+// GetState returns whether the user exists, and an entry for each property
+// the operation manages, so a property changed outside of polyester makes the
+// operation dirty.
 func (op Useradd) GetState(octx operator.Context) (state.State, error) {
 	opts := op.Args.(*UseraddOpts)
 	st := state.State{}
-	// TODO would be nice be able to refer to state in Run
 	u, err := Lookup(opts.User)
 	if err != nil && !errors.Is(err, user.UnknownUserError(opts.User)) {
 		return st, err
 	}
 	st = st.Append(state.Entry{
 		Name: "~" + opts.User,
-		KV:   u.ToMap(),
+		KV:   map[string]interface{}{"exists": u != nil},
 	})
-	// fmt.Printf("da user: %+v\n", u.ToMap())
-	// st.WriteTo(os.Stdout)
-	return st, nil
+	if u == nil {
+		return st, nil
+	}
+
+	props := []struct {
+		name, want, curr string
+	}{
+		{"uid", opts.UID, u.Uid},
+		{"shell", opts.Shell, u.Shell},
+		{"home", opts.CreateHomeDir, u.HomeDir},
+		{"comment", opts.Comment, u.Name},
+	}
+	for _, prop := range props {
+		if prop.want == "" {
+			continue
+		}
+		st = st.Append(state.Entry{
+			Name: "~" + opts.User + "/" + prop.name,
+			KV:   map[string]interface{}{prop.name: prop.curr},
+		})
+	}
+
+	if !opts.managesGroups() {
+		return st, nil
+	}
+	groups, err := u.Groups()
+	if err != nil {
+		return st, err
+	}
+	return st.Append(state.Entry{
+		Name: "~" + opts.User + "/groups",
+		KV:   opts.groupMembership(groups),
+	}), nil
 }
 
 func (op Useradd) Run(octx operator.Context) error {
@@ -83,19 +122,72 @@ func (op Useradd) Run(octx operator.Context) error {
 		return err
 	}
 	if u == nil {
-		return callUseradd(octx, opts)
+		return run(octx, "useradd", useraddCmdArgs(opts)...)
 	}
 
-	if err := callUsermod(octx, u, opts); err != nil {
-		return err
+	var groups []string
+	if opts.managesGroups() {
+		groups, err = u.Groups()
+		if err != nil {
+			return err
+		}
+	}
+	if args := usermodArgs(u, groups, opts); len(args) > 0 {
+		if err := run(octx, "usermod", append(args, opts.User)...); err != nil {
+			return err
+		}
+	}
+	if len(opts.Groups) > 0 {
+		// the exclusive list already removed the user from other groups.
+		return nil
+	}
+	for _, g := range opts.RemoveGroups {
+		if !contains(groups, g) {
+			continue
+		}
+		if err := run(octx, "gpasswd", "--delete", opts.User, g); err != nil {
+			return err
+		}
 	}
-
-	// NOTE can use chsh to change the user login shell
 	return nil
 }
 
-func callUseradd(octx operator.Context, opts *UseraddOpts) error {
+func (opts *UseraddOpts) managesGroups() bool {
+	return len(opts.Groups) > 0 || len(opts.AddGroups) > 0 || len(opts.RemoveGroups) > 0
+}
+
+// wantGroups returns the supplementary groups the user must be a member of.
+func (opts *UseraddOpts) wantGroups() []string {
+	var res []string
+	for _, g := range append(append([]string{}, opts.Groups...), opts.AddGroups...) {
+		if !contains(res, g) {
+			res = append(res, g)
+		}
+	}
+	return res
+}
+
+// groupMembership returns whether the user is a member of each group the
+// operation manages. With an exclusive list of groups, every group the user
+// is a member of is managed.
+func (opts *UseraddOpts) groupMembership(groups []string) map[string]interface{} {
+	res := make(map[string]interface{})
+	for _, g := range append(opts.wantGroups(), opts.RemoveGroups...) {
+		res[g] = contains(groups, g)
+	}
+	if len(opts.Groups) > 0 {
+		for _, g := range groups {
+			res[g] = true
+		}
+	}
+	return res
+}
+
+func useraddCmdArgs(opts *UseraddOpts) []string {
 	args := []string{}
+	if opts.UID != "" {
+		args = append(args, "--uid", opts.UID)
+	}
 	if opts.Shell != "" {
 		args = append(args, "--shell", opts.Shell)
 	}
@@ -114,37 +206,84 @@ func callUseradd(octx operator.Context, opts *UseraddOpts) error {
 	if opts.CreateUserGroup {
 		args = append(args, "--user-group")
 	}
-	args = append(args, opts.User)
-
-	cmd := exec.CommandContext(octx.Context, "useradd", args...)
-	if isatty.IsTerminal(os.Stdout.Fd()) {
-		cmd.Stdin = os.Stdin
+	if groups := opts.wantGroups(); len(groups) > 0 {
+		args = append(args, "--groups", strings.Join(groups, ","))
 	}
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return append(args, opts.User)
 }
 
-func callUsermod(octx operator.Context, curr *User, opts *UseraddOpts) error {
+// usermodArgs returns the usermod flags that change the properties of curr
+// that differ from opts. groups are the user's current supplementary groups.
+func usermodArgs(curr *User, groups []string, opts *UseraddOpts) []string {
 	args := []string{}
-	if curr.Shell != opts.Shell {
+	if opts.UID != "" && curr.Uid != opts.UID {
+		args = append(args, "--uid", opts.UID)
+	}
+	if opts.Shell != "" && curr.Shell != opts.Shell {
 		args = append(args, "--shell", opts.Shell)
 	}
-	if curr.Name != opts.Comment {
+	if opts.Comment != "" && curr.Name != opts.Comment {
 		args = append(args, "--comment", opts.Comment)
 	}
-	if curr.HomeDir != opts.CreateHomeDir {
+	if opts.CreateHomeDir != "" && curr.HomeDir != opts.CreateHomeDir {
 		args = append(args, "--home", opts.CreateHomeDir)
+		if opts.CreateHome {
+			args = append(args, "--move-home")
+		}
+	}
+
+	want := opts.wantGroups()
+	if len(opts.Groups) > 0 {
+		if !sameGroups(groups, want) {
+			args = append(args, "--groups", strings.Join(want, ","))
+		}
+		return args
+	}
+	var missing []string
+	for _, g := range want {
+		if !contains(groups, g) {
+			missing = append(missing, g)
+		}
+	}
+	if len(missing) > 0 {
+		args = append(args, "--append", "--groups", strings.Join(missing, ","))
+	}
+	return args
+}
+
+func sameGroups(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	as := append([]string{}, a...)
+	bs := append([]string{}, b...)
+	sort.Strings(as)
+	sort.Strings(bs)
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
 	}
+	return true
+}
 
-	args = append(args, opts.User)
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
 
-	cmd := exec.CommandContext(octx.Context, "usermod", args...)
+func run(octx operator.Context, name string, args ...string) error {
+	std := stdio.FromContext(octx.Context)
+	cmd := executil.CommandContext(octx.Context, name, args...)
 	if isatty.IsTerminal(os.Stdout.Fd()) {
 		cmd.Stdin = os.Stdin
 	}
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = std.Stdout()
+	cmd.Stderr = std.Stderr()
 	return cmd.Run()
 }
 
@@ -0,0 +1,99 @@
+package userop
+
+import (
+	"os/user"
+	"reflect"
+	"testing"
+)
+
+func TestUsermodArgs(t *testing.T) {
+	curr := &User{
+		User: &user.User{
+			Uid:      "1001",
+			Gid:      "1001",
+			Username: "app",
+			Name:     "app user",
+			HomeDir:  "/home/app",
+		},
+		Shell: "/bin/sh",
+	}
+	tcs := []struct {
+		name   string
+		groups []string
+		opts   *UseraddOpts
+		expect []string
+	}{
+		{
+			name:   "unmanaged",
+			opts:   &UseraddOpts{User: "app"},
+			expect: []string{},
+		},
+		{
+			name:   "unchanged",
+			groups: []string{"docker"},
+			opts:   &UseraddOpts{User: "app", UID: "1001", Shell: "/bin/sh", Comment: "app user", CreateHomeDir: "/home/app", AddGroups: []string{"docker"}},
+			expect: []string{},
+		},
+		{
+			name:   "properties",
+			opts:   &UseraddOpts{User: "app", UID: "2001", Shell: "/bin/bash", Comment: "the app", CreateHomeDir: "/srv/app", CreateHome: true},
+			expect: []string{"--uid", "2001", "--shell", "/bin/bash", "--comment", "the app", "--home", "/srv/app", "--move-home"},
+		},
+		{
+			name:   "add groups",
+			groups: []string{"docker"},
+			opts:   &UseraddOpts{User: "app", AddGroups: []string{"docker", "adm"}},
+			expect: []string{"--append", "--groups", "adm"},
+		},
+		{
+			name:   "exclusive groups",
+			groups: []string{"docker", "sudo"},
+			opts:   &UseraddOpts{User: "app", Groups: []string{"docker"}, AddGroups: []string{"adm"}},
+			expect: []string{"--groups", "docker,adm"},
+		},
+		{
+			name:   "exclusive groups unchanged",
+			groups: []string{"adm", "docker"},
+			opts:   &UseraddOpts{User: "app", Groups: []string{"docker", "adm"}},
+			expect: []string{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := usermodArgs(curr, tc.groups, tc.opts); !reflect.DeepEqual(got, tc.expect) {
+				t.Errorf("expected %q, got %q", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestUseraddCmdArgs(t *testing.T) {
+	opts := &UseraddOpts{
+		User:       "app",
+		UID:        "2001",
+		Shell:      "/bin/sh",
+		CreateHome: true,
+		Groups:     []string{"docker"},
+		AddGroups:  []string{"adm", "docker"},
+	}
+	expect := []string{"--uid", "2001", "--shell", "/bin/sh", "--create-home", "--groups", "docker,adm", "app"}
+	if got := useraddCmdArgs(opts); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %q, got %q", expect, got)
+	}
+}
+
+func TestGroupMembership(t *testing.T) {
+	opts := &UseraddOpts{User: "app", AddGroups: []string{"docker"}, RemoveGroups: []string{"sudo"}}
+	expect := map[string]interface{}{"docker": true, "sudo": false}
+	if got := opts.groupMembership([]string{"docker", "adm"}); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	// with an exclusive list, membership of any other group is drift.
+	opts = &UseraddOpts{User: "app", Groups: []string{"docker"}}
+	expect = map[string]interface{}{"docker": true, "adm": true}
+	if got := opts.groupMembership([]string{"docker", "adm"}); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
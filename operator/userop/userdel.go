@@ -0,0 +1,79 @@
+package userop
+
+import (
+	"errors"
+	"os/user"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/state"
+)
+
+type UserdelOpts struct {
+	User       string `json:"user"`
+	RemoveHome bool   `json:"remove_home,omitempty"`
+}
+
+// Userdel deletes a user, if it exists.
+type Userdel struct {
+	Args interface{}
+}
+
+func (op Userdel) Info() operator.Info {
+	opts := op.Args.(*UserdelOpts)
+
+	cmd := &cobra.Command{
+		Use:   "userdel user",
+		Args:  cobra.ExactArgs(1),
+		Short: "deletes a user",
+	}
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.RemoveHome, "remove", "r", false, "remove the user's home directory and mail spool")
+
+	return &operator.InfoData{
+		OpName: "userdel",
+		Command: &operator.Command{
+			Command:   cmd,
+			ApplyArgs: userdelArgs,
+			Target:    opts,
+		},
+	}
+}
+
+// GetState returns whether the user exists, so a user that was added again
+// since it was deleted makes the operation dirty.
+func (op Userdel) GetState(octx operator.Context) (state.State, error) {
+	opts := op.Args.(*UserdelOpts)
+	st := state.State{}
+	u, err := Lookup(opts.User)
+	if err != nil && !errors.Is(err, user.UnknownUserError(opts.User)) {
+		return st, err
+	}
+	return st.Append(state.Entry{
+		Name: "~" + opts.User,
+		KV:   map[string]interface{}{"exists": u != nil},
+	}), nil
+}
+
+func (op Userdel) Run(octx operator.Context) error {
+	opts := op.Args.(*UserdelOpts)
+	u, err := Lookup(opts.User)
+	if err != nil && !errors.Is(err, user.UnknownUserError(opts.User)) {
+		return err
+	}
+	if u == nil {
+		return nil
+	}
+	args := []string{}
+	if opts.RemoveHome {
+		args = append(args, "--remove")
+	}
+	return run(octx, "userdel", append(args, opts.User)...)
+}
+
+func userdelArgs(cmd *cobra.Command, args []string, target interface{}) error {
+	t := target.(*UserdelOpts)
+	t.User = args[0]
+	return nil
+}
@@ -0,0 +1,31 @@
+package userop
+
+import (
+	"testing"
+
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestUserdelMissingUser(t *testing.T) {
+	octx := operator.NewContext(testenv.Context(), nil, nil, nil)
+	op := Userdel{Args: &UserdelOpts{User: "polyester-nonexistent-user"}}
+
+	st, err := op.GetState(octx)
+	if err != nil {
+		t.Fatal("GetState failed:", err)
+	}
+	ent, ok := st.Get("~polyester-nonexistent-user")
+	if !ok {
+		t.Fatal("expected a state entry for the user")
+	}
+	if exists := ent.KV["exists"]; exists != false {
+		t.Errorf("expected the user not to exist, got %v", exists)
+	}
+
+	// deleting a user that doesn't exist does nothing, so userdel is never
+	// run.
+	if err := op.Run(octx); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+}
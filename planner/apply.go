@@ -12,6 +12,7 @@ import (
 	"github.com/jeffrom/polyester/operator/opfs"
 	"github.com/jeffrom/polyester/operator/templates"
 	"github.com/jeffrom/polyester/planner/execute"
+	"github.com/jeffrom/polyester/planner/format"
 	"github.com/jeffrom/polyester/stdio"
 )
 
@@ -20,6 +21,18 @@ type ApplyOpts struct {
 	CompiledPlan string
 	DirRoot      string
 	StateDir     string
+	Concurrency  int
+	KeepGoing    bool
+	// Formatter renders progress. It defaults to the plain formatter.
+	Formatter format.Formatter
+	// IdentityPaths are age identity files used to decrypt secrets, in
+	// addition to those in ~/.config/polyester/age.
+	IdentityPaths []string
+	// Diff explains why each dirty operation would run, without running it.
+	Diff bool
+	// Drift reports files that changed since they were last applied, without
+	// making changes.
+	Drift bool
 }
 
 func (o ApplyOpts) withDefaults() ApplyOpts {
@@ -34,10 +47,16 @@ func (o ApplyOpts) withDefaults() ApplyOpts {
 	}
 
 	return ApplyOpts{
-		Dryrun:       o.Dryrun,
-		CompiledPlan: o.CompiledPlan,
-		DirRoot:      dirRoot,
-		StateDir:     stateDir,
+		Dryrun:        o.Dryrun,
+		CompiledPlan:  o.CompiledPlan,
+		DirRoot:       dirRoot,
+		StateDir:      stateDir,
+		Concurrency:   o.Concurrency,
+		KeepGoing:     o.KeepGoing,
+		Formatter:     o.Formatter,
+		IdentityPaths: o.IdentityPaths,
+		Diff:          o.Diff,
+		Drift:         o.Drift,
 	}
 }
 
@@ -56,21 +75,26 @@ func (r *Planner) Apply(ctx context.Context, opts ApplyOpts) (*execute.Result, e
 		return nil, err
 	}
 	std := stdio.FromContext(ctx)
-	std.Infof("current directory: %s\nplan directory: %s\ncompiling plan: %s",
+	label, planPath := "compiling plan", filepath.Join(r.rootDir, pfPath)
+	if r.compiledPlan != "" {
+		label, planPath = "reading compiled plan", r.compiledPlan
+	}
+	std.Infof("current directory: %s\nplan directory: %s\n%s: %s",
 		wd,
 		strings.TrimPrefix(planDir, wd+"/"),
-		strings.TrimPrefix(filepath.Join(r.rootDir, pfPath), wd+"/"))
+		label,
+		strings.TrimPrefix(planPath, wd+"/"))
 
 	mani, err := manifest.LoadDir(planDir)
 	if err != nil {
 		return nil, err
 	}
-	plan, err := compiler.New().Compile(ctx, mani)
+	plan, err := r.loadPlan(ctx, planDir, mani)
 	if err != nil {
 		return nil, err
 	}
 
-	tmpl, err := r.setupTemplates(ctx)
+	tmpl, err := r.setupTemplates(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -79,14 +103,19 @@ func (r *Planner) Apply(ctx context.Context, opts ApplyOpts) (*execute.Result, e
 		return nil, err
 	}
 
-	stateDir, err := r.setupState(plan, opts)
+	stateDir, err := r.setupState(std, plan, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	// when plans fail, the result is returned along with the error so every
+	// failure can be reported.
 	res, err := r.executePlans(ctx, plan, stateDir, tmpl, opts)
 	if err != nil {
-		return nil, err
+		return res, err
+	}
+	if opts.Diff || opts.Drift {
+		return res, nil
 	}
 	if err := r.pruneState(stdio.FromContext(ctx), plan, stateDir); err != nil {
 		return nil, err
@@ -112,15 +141,15 @@ func (r *Planner) resolvePlanDir(ctx context.Context) (string, error) {
 
 func (r *Planner) executePlans(ctx context.Context, plan *compiler.Plan, stateDir string, tmpl *templates.Templates, opts ApplyOpts) (*execute.Result, error) {
 	dirRoot := opts.DirRoot
-	_, err := plan.All()
-	if err != nil {
-		return nil, err
-	}
-
 	octx := operator.NewContext(ctx, opfs.New(dirRoot), opfs.NewPlanDirFS(r.planDir), tmpl)
 	return execute.Execute(octx, plan, execute.Opts{
-		Dryrun:   opts.Dryrun,
-		DirRoot:  opts.DirRoot,
-		StateDir: stateDir,
+		Dryrun:      opts.Dryrun,
+		DirRoot:     opts.DirRoot,
+		StateDir:    stateDir,
+		Concurrency: opts.Concurrency,
+		KeepGoing:   opts.KeepGoing,
+		Formatter:   opts.Formatter,
+		Diff:        opts.Diff,
+		Drift:       opts.Drift,
 	})
 }
@@ -0,0 +1,70 @@
+package planner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jeffrom/polyester/manifest"
+)
+
+// NewFromArchive returns a planner for a manifest archive, as written by
+// manifest.Save. The archive is loaded and validated with manifest.LoadFile,
+// then extracted into a private temporary directory, which is removed by
+// Close.
+//
+// The extraction is needed because operators read manifest files by their
+// path in the plan directory, through operator.Context's PlanDir: templates,
+// vars and secrets are read with os.ReadFile, and copy and pcopy stat and
+// open their sources. Reading them from the archive's tar filesystem instead
+// would mean moving every operator onto fs.FS first.
+func NewFromArchive(p string) (*Planner, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+	m, err := manifest.LoadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "polyester-archive")
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(tmpDir, "manifest")
+	if err := manifest.SaveDir(dir, m); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	return &Planner{
+		rootDir:  dir,
+		tmpDir:   tmpDir,
+		stateKey: archiveStateKey(abs, m.Metadata),
+	}, nil
+}
+
+// Close removes any temporary files created by the planner.
+func (r *Planner) Close() error {
+	if r.tmpDir == "" {
+		return nil
+	}
+	return os.RemoveAll(r.tmpDir)
+}
+
+// archiveStateKey returns the state key of a manifest archive. Archives are
+// extracted to a different directory each run, so the manifest name is used
+// instead of its path. The version is left out so state carries over between
+// releases.
+func archiveStateKey(p string, meta *manifest.Metadata) string {
+	name := ""
+	if meta != nil {
+		name = meta.Name
+	}
+	if name == "" {
+		_, file := filepath.Split(p)
+		name = strings.TrimSuffix(strings.TrimSuffix(file, ".tgz"), ".tar.gz")
+	}
+	return "archive-" + name
+}
@@ -18,6 +18,19 @@ import (
 
 func (r *Planner) Check(ctx context.Context) error {
 	std := stdio.FromContext(ctx)
+	if r.compiledPlan != "" {
+		planDir, err := r.resolvePlanDir(ctx)
+		if err != nil {
+			return err
+		}
+		mani, err := manifest.LoadDir(planDir)
+		if err != nil {
+			return err
+		}
+		_, err = r.loadPlan(ctx, planDir, mani)
+		return err
+	}
+
 	pf := r.getPlanFile()
 	pb, err := fs.ReadFile(os.DirFS(r.rootDir), pf)
 	std.Debugf("planner check: rootDir %s", r.rootDir)
@@ -26,12 +39,14 @@ func (r *Planner) Check(ctx context.Context) error {
 		return err
 	}
 
-	psh, err := shell.Parse(bytes.NewReader(pb))
-	if err != nil {
-		return err
-	}
-	if err := psh.Compile(ctx); err != nil {
-		return err
+	if shell.ParseShebang(pb).IsShell() {
+		psh, err := shell.ParseFile(bytes.NewReader(pb), pf)
+		if err != nil {
+			return err
+		}
+		if err := psh.Compile(ctx); err != nil {
+			return err
+		}
 	}
 
 	std.Debugf("Reading manifest dir: %s", r.rootDir)
@@ -39,10 +54,7 @@ func (r *Planner) Check(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	if _, err := compiler.New().Compile(ctx, mani); err != nil {
-		return err
-	}
-	return nil
+	return r.newCompiler().Check(ctx, mani)
 }
 
 func (r *Planner) getPlanFile() string {
@@ -53,6 +65,8 @@ func (r *Planner) getPlanFile() string {
 	return pf
 }
 
+// checkPlan validates every operation in plan with its arguments evaluated,
+// and returns compiler.ValidationErrors for all the errors found.
 func (r *Planner) checkPlan(ctx context.Context, plan *compiler.Plan, tmpl *templates.Templates, opts ApplyOpts) error {
 	allPlans, err := plan.All()
 	if err != nil {
@@ -60,16 +74,24 @@ func (r *Planner) checkPlan(ctx context.Context, plan *compiler.Plan, tmpl *temp
 	}
 
 	octx := operator.NewContext(ctx, opfs.New(opts.DirRoot), opfs.NewPlanDirFS(r.planDir), nil)
+	var errs compiler.ValidationErrors
 	for _, plan := range allPlans {
-		for _, op := range plan.Operations {
+		ops := plan.Operations
+		handlers, err := plan.Handlers()
+		if err != nil {
+			return err
+		}
+		for _, h := range handlers {
+			ops = append(ops, h.Operation)
+		}
+		for _, op := range ops {
 			validater, ok := op.(operator.Validator)
 			if !ok {
 				continue
 			}
-			if err := validater.Validate(octx, op.Info().Data().Command.Target, true); err != nil {
-				return err
-			}
+			data := op.Info().Data()
+			errs.Add(compiler.OperationError(plan.Name, data), validater.Validate(octx, data.Command.Target, true))
 		}
 	}
-	return nil
+	return errs.Err()
 }
@@ -0,0 +1,89 @@
+package planner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/jeffrom/polyester/compiler"
+	"github.com/jeffrom/polyester/manifest"
+)
+
+// NewFromPlanFile returns a planner for a manifest archive or a compiled plan,
+// as written by Compile. Compiled plans are applied against the manifest in
+// dir, which must match the manifest the plan was compiled from. dir must be
+// empty for manifest archives.
+func NewFromPlanFile(p, dir string) (*Planner, error) {
+	isArchive, err := manifest.IsArchive(p)
+	if err != nil {
+		return nil, err
+	}
+	if isArchive {
+		if dir != "" {
+			return nil, errors.New("planner: a manifest directory cannot be used with a manifest archive")
+		}
+		return NewFromArchive(p)
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+	pl, err := New(dir)
+	if err != nil {
+		return nil, err
+	}
+	pl.compiledPlan = abs
+	return pl, nil
+}
+
+// Compile compiles the manifest and writes the resolved plan to w. The
+// written plan can be applied later without evaluating plan scripts.
+func (r *Planner) Compile(ctx context.Context, w io.Writer) error {
+	planDir, err := r.resolvePlanDir(ctx)
+	if err != nil {
+		return err
+	}
+	mani, err := manifest.LoadDir(planDir)
+	if err != nil {
+		return err
+	}
+	plan, err := r.newCompiler().Compile(ctx, mani)
+	if err != nil {
+		return err
+	}
+	return compiler.WriteCompiled(w, plan, manifest.Checksum(mani))
+}
+
+// loadPlan returns the plan for the manifest in planDir, either by compiling
+// it, or by reading the planner's compiled plan, which skips evaluating plan
+// scripts.
+func (r *Planner) loadPlan(ctx context.Context, planDir string, mani *manifest.Manifest) (*compiler.Plan, error) {
+	if r.compiledPlan == "" {
+		return r.newCompiler().Compile(ctx, mani)
+	}
+
+	f, err := os.Open(r.compiledPlan)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	plan, checksum, err := compiler.ReadCompiled(f)
+	if err != nil {
+		return nil, err
+	}
+	if actual := manifest.Checksum(mani); checksum != actual {
+		return nil, fmt.Errorf("planner: compiled plan %s does not match the manifest in %s (checksum %s, expected %s)", r.compiledPlan, planDir, actual, checksum)
+	}
+	return plan, nil
+}
+
+func (r *Planner) newCompiler() *compiler.Compiler {
+	cc := compiler.New()
+	cc.Concurrency = r.Concurrency
+	return cc
+}
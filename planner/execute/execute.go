@@ -4,8 +4,8 @@ package execute
 
 import (
 	"fmt"
-	"os"
 	"runtime"
+	"time"
 
 	"github.com/jeffrom/polyester/compiler"
 	"github.com/jeffrom/polyester/operator"
@@ -15,32 +15,50 @@ import (
 )
 
 type Opts struct {
-	Dryrun      bool
-	DirRoot     string
-	StateDir    string
+	Dryrun   bool
+	DirRoot  string
+	StateDir string
+	// KeepGoing continues running plans after a plan fails. Only the plans
+	// that depend on the failed plan are skipped.
+	KeepGoing bool
+	// Concurrency is the maximum number of plans to run at once. It defaults
+	// to the number of CPUs.
 	Concurrency int
+	// Formatter renders progress. It defaults to the plain formatter,
+	// writing to stdout.
+	Formatter format.Formatter
+	// Diff explains why each dirty operation would run instead of running
+	// it. It implies Dryrun, and every dry run explains dirty operations.
+	Diff bool
+	// Drift detects files that changed since they were last written, such
+	// as templates edited by hand. It implies Dryrun.
+	Drift bool
 }
 
-// Execute runs a manifest concurrently. Each "plan" or "dependency" operation
-// runs in a concurrent pool, taking dependencies into account. Operations run
-// serially per-plan.
+// Execute runs a manifest concurrently. The dependency graph of every plan is
+// built once, and each plan runs as soon as all of its dependencies have
+// completed, up to opts.Concurrency plans at a time. Operations run serially
+// per-plan. Results are returned in dependency order, which doesn't depend on
+// the order plans happened to complete.
 func Execute(octx operator.Context, plan *compiler.Plan, opts Opts) (*Result, error) {
-	// safety checks:
-	// - plan should only run once per apply run
-	// - all of a plans dependencies must run before it is run
-
-	// at the top level we need to keep track of the order, and put things back
-	// together before returning the *Result.
-
-	if opts.Concurrency == 0 {
+	if opts.Diff || opts.Drift {
+		opts.Dryrun = true
+	}
+	if opts.Concurrency <= 0 {
 		opts.Concurrency = runtime.NumCPU()
 	}
 
-	ep := newExecPool(opts.Concurrency, stdio.FromContext(octx.Context))
-	ep.start(octx, opts)
-	defer ep.stop()
-	ep.add(plan)
-	return ep.wait()
+	std := stdio.FromContext(octx.Context)
+	if opts.Formatter == nil {
+		opts.Formatter = format.NewPlain(std.Stdout())
+	}
+
+	graph, err := newPlanGraph(plan)
+	if err != nil {
+		return nil, err
+	}
+	res := newScheduler(std, graph, opts.Concurrency).run(octx, opts)
+	return res, res.Err()
 }
 
 func executePlan(octx operator.Context, std *stdio.StdIO, opts Opts, plan *compiler.Plan) (*PlanResult, error) {
@@ -52,42 +70,109 @@ func executePlan(octx operator.Context, std *stdio.StdIO, opts Opts, plan *compi
 		std.Debug("plan dir:", octx.PlanDir.Join(""))
 	}
 
+	opts.Formatter.Write(format.Event{Type: format.EventPlanStart, Plan: plan.Name})
+	finalRes := &PlanResult{Plan: plan, Name: plan.Name}
 	prevs, currs, err := readOpStates(octx, plan, opts)
 	if err != nil {
-		return nil, err
+		return finalRes, err
 	}
 	if err := plan.TextSummary(std.Stdout(), prevs, currs); err != nil {
-		return nil, err
+		return finalRes, err
+	}
+
+	handlers, err := plan.Handlers()
+	if err != nil {
+		return finalRes, err
 	}
+	notified := make(map[string][]string)
 
 	dirty := false
-	finalRes := &PlanResult{Plan: plan, Name: plan.Name}
+	dirtyFrom := ""
 	for i, op := range plan.Operations {
+		start := time.Now()
 		res, err := executeOperation(octx, op, opts, dirty, prevs[i], currs[i])
+		if err == nil && res != nil && res.Dirty && opts.Dryrun {
+			res.Explanation, err = explainOperation(octx, res, dirtyFrom)
+		}
+		if err == nil && res != nil && opts.Drift {
+			res.Drift, err = detectDrift(octx, res)
+		}
+		if res != nil {
+			res.Duration = time.Since(start)
+			opts.Formatter.Write(operationEvent(plan, res, err))
+		}
 		if err != nil {
-			return nil, err
+			return finalRes, newOperationError(plan, op, err)
 		}
 		if res != nil && res.Dirty {
+			if !dirty {
+				dirtyFrom = res.Name
+			}
 			dirty = true
 		}
 		if res != nil {
 			finalRes.Operations = append(finalRes.Operations, res)
+			// a dry run can't know whether the target would change, so
+			// handlers are notified by any operation that would run.
+			if res.TargetChanged || (opts.Dryrun && res.Dirty) {
+				for _, name := range op.Info().Data().Notify {
+					notified[name] = append(notified[name], res.Name)
+				}
+			}
 		}
 	}
 	if len(finalRes.Operations) == 0 {
 		return nil, nil
 	}
 	finalRes.Changed = dirty
+
+	for _, h := range handlers {
+		notifiedBy, ok := notified[h.Name]
+		if !ok {
+			continue
+		}
+		hres, err := executeHandler(octx, opts, h, notifiedBy)
+		if hres != nil {
+			opts.Formatter.Write(handlerEvent(plan, hres, err))
+			finalRes.Handlers = append(finalRes.Handlers, hres)
+		}
+		if err != nil {
+			return finalRes, newOperationError(plan, h.Operation, err)
+		}
+	}
 	return finalRes, nil
 }
 
+// executeHandler runs a handler that was notified by the operations in
+// notifiedBy. Handlers always run when notified, as if an earlier operation
+// was dirty.
+func executeHandler(octx operator.Context, opts Opts, h compiler.Handler, notifiedBy []string) (*HandlerResult, error) {
+	start := time.Now()
+	prev, curr, err := readOpState(octx, h.Operation, opts)
+	if err != nil {
+		return nil, err
+	}
+	res, err := executeOperation(octx, h.Operation, opts, true, prev, curr)
+	if res == nil {
+		return nil, err
+	}
+	res.Duration = time.Since(start)
+	return &HandlerResult{OperationResult: res, Handler: h.Name, NotifiedBy: notifiedBy}, err
+}
+
+func handlerEvent(plan *compiler.Plan, res *HandlerResult, err error) format.Event {
+	ev := operationEvent(plan, res.OperationResult, err)
+	ev.Handler = res.Handler
+	return ev
+}
+
 func readOpStates(octx operator.Context, plan *compiler.Plan, opts Opts) ([]state.State, []state.State, error) {
 	var prevs []state.State
 	var currs []state.State
 	for _, op := range plan.Operations {
 		prev, curr, err := readOpState(octx, op, opts)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, newOperationError(plan, op, err)
 		}
 		prevs = append(prevs, prev)
 		currs = append(currs, curr)
@@ -95,12 +180,22 @@ func readOpStates(octx operator.Context, plan *compiler.Plan, opts Opts) ([]stat
 	return prevs, currs, nil
 }
 
+func newOperationError(plan *compiler.Plan, op operator.Interface, err error) *OperationError {
+	info := op.Info()
+	return &OperationError{
+		Plan:      plan.Name,
+		Operation: info.Name(),
+		Target:    info.Data().Command.Target,
+		Err:       err,
+	}
+}
+
 func readOpState(octx operator.Context, op operator.Interface, opts Opts) (state.State, state.State, error) {
 	info := op.Info()
 	name := info.Name()
 
 	// skip planops because planner handles running them outside this context
-	if name == "plan" || name == "dependency" {
+	if name == "plan" || name == "dependency" || name == "handler" {
 		return state.State{}, state.State{}, nil
 	}
 
@@ -122,12 +217,14 @@ func executeOperation(octx operator.Context, op operator.Interface, opts Opts, d
 	info := op.Info()
 	name := info.Name()
 	// skip planops because planner handles running them outside this context
-	if name == "plan" || name == "dependency" {
+	if name == "plan" || name == "dependency" || name == "handler" {
 		return nil, nil
 	}
 	data := info.Data()
 
 	res := &OperationResult{
+		Name:      name,
+		op:        op,
 		prevState: prevst,
 		currState: st,
 	}
@@ -138,25 +235,27 @@ func executeOperation(octx operator.Context, op operator.Interface, opts Opts, d
 	desiredSt := state.New()
 	origOp, err := compiler.GetOperation(op)
 	if err != nil {
-		return nil, err
+		return res, err
 	}
 	// fmt.Println("executeOperation plan dir:", octx.PlanDir.Join("/"))
 	if dop, ok := origOp.(operator.DesiredStater); ok {
 		var err error
 		desiredSt, err = dop.DesiredState(octx)
 		if err != nil {
-			return nil, err
+			return res, err
 		}
 	}
+	res.desiredState = desiredSt
 	// desiredSt.WriteTo(os.Stdout)
 
 	prevEmpty := prevSrcSt.Empty()
 	changed, err := getOpChanged(octx, op, prevSrcSt, srcSt, desiredSt)
 	if err != nil {
-		return nil, err
+		return res, err
 	}
+	res.PrevEmpty = prevEmpty
+	res.Changed = changed
 	dirty = dirty || prevEmpty || changed
-	executed := false
 	if dirty {
 		dryrunLabel := ""
 		if opts.Dryrun {
@@ -169,26 +268,31 @@ func executeOperation(octx operator.Context, op operator.Interface, opts Opts, d
 		std.Debugf("-> execute %s%s (%+v)", opFmt, dryrunLabel, data.Command.Target)
 
 		if !opts.Dryrun {
-			executed = true
-			if err := op.Run(octx); err != nil {
-				return nil, err
+			res.Executed = true
+			if err := op.Run(octx.WithPrevState(prevst)); err != nil {
+				return res, err
 			}
 
 			finalSt, err := op.GetState(octx.WithGotState(true))
 			if err != nil {
-				return nil, err
+				return res, err
 			}
 			res.finalState = finalSt
 
 			if err := operator.SaveState(data, finalSt, opts.StateDir); err != nil {
-				return nil, err
+				return res, err
 			}
 
 			targetSt := finalSt.Target()
 			// fmt.Println("ASDF")
 			// targetSt.WriteTo(os.Stdout)
 			// fmt.Println("\n", targetSt.Changed(prevst.Target()))
-			if !targetSt.Empty() && !targetSt.Changed(prevst.Target()) {
+			if !targetSt.Empty() {
+				res.TargetChanged = targetSt.Changed(prevst.Target())
+			} else {
+				res.TargetChanged = finalSt.Changed(prevst)
+			}
+			if !targetSt.Empty() && !res.TargetChanged {
 				std.Debug("-> target state hasn't changed after execution")
 				if !prevDirty {
 					dirty = false
@@ -198,17 +302,35 @@ func executeOperation(octx operator.Context, op operator.Interface, opts Opts, d
 	}
 
 	// fmt.Printf("%25s: [empty: %8v] [changed: %8v] [dirty: %8v]\n", op.Info().Name(), prevSrcSt.Empty(), changed, dirty)
-	fm := &format.DefaultFormatter{}
-	fm.OpComplete(os.Stdout, op.Info().Name(), prevSrcSt.Empty(), changed, dirty, executed)
-	res.op = op
-	res.Name = op.Info().Name()
-	res.PrevEmpty = prevEmpty
-	res.Changed = changed
 	res.Dirty = dirty
-	res.Executed = executed
 	return res, nil
 }
 
+func operationEvent(plan *compiler.Plan, res *OperationResult, err error) format.Event {
+	ev := format.Event{
+		Type:         format.EventOperation,
+		Plan:         plan.Name,
+		Operation:    res.Name,
+		PrevState:    &res.prevState,
+		CurrentState: &res.currState,
+		Empty:        res.PrevEmpty,
+		Changed:      res.Changed,
+		Dirty:        res.Dirty,
+		Executed:     res.Executed,
+		DurationMS:   format.Milliseconds(res.Duration),
+	}
+	if res.op != nil {
+		ev.Target = res.op.Info().Data().Command.Target
+	}
+	if !res.desiredState.Empty() {
+		ev.DesiredState = &res.desiredState
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	return ev
+}
+
 func getOpChanged(octx operator.Context, op operator.Interface, prevst, currst, desiredst state.State) (bool, error) {
 	origOp, err := compiler.GetOperation(op)
 	if err != nil {
@@ -1,43 +1,50 @@
 package execute
 
 import (
-	"context"
+	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/jeffrom/polyester/compiler"
 	"github.com/jeffrom/polyester/manifest"
 	"github.com/jeffrom/polyester/operator"
 	"github.com/jeffrom/polyester/operator/opfs"
-	"github.com/jeffrom/polyester/stdio"
+	"github.com/jeffrom/polyester/planner/format"
 	"github.com/jeffrom/polyester/testenv"
 )
 
-func TestPool(t *testing.T) {
+func TestExecute(t *testing.T) {
 	tcs := []struct {
 		name        string
 		dir         string
 		concurrency int
+		expect      []string
 	}{
 		{
-			name: "noop",
-			dir:  testenv.Path("testdata", "noop"),
+			name:   "noop",
+			dir:    testenv.Path("testdata", "noop"),
+			expect: []string{"main"},
 		},
 		{
-			name: "basic",
-			dir:  testenv.Path("testdata", "basic"),
+			name:        "basic",
+			dir:         testenv.Path("testdata", "basic"),
+			concurrency: 1,
+			expect:      []string{"first-touch", "gitty", "touchy", "main"},
 		},
 		{
 			name:        "basic-p4",
 			dir:         testenv.Path("testdata", "basic"),
 			concurrency: 4,
+			expect:      []string{"first-touch", "gitty", "touchy", "main"},
 		},
 	}
 
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			ctx := context.Background()
+			ctx := testenv.Context()
 			tmpdir := testenv.TempPlanDir(t, tc.dir)
 			defer testenv.RemoveOnSuccess(t, tmpdir)
 			planDir := filepath.Join(tmpdir, "manifest")
@@ -52,15 +59,10 @@ func TestPool(t *testing.T) {
 
 			octx := operator.NewContext(ctx, opfs.New(dirRoot), opfs.NewPlanDirFS(planDir), nil)
 			opts := Opts{
-				DirRoot:  dirRoot,
-				StateDir: stateDir,
-			}
-			n := 1
-			if tc.concurrency > 0 {
-				n = tc.concurrency
+				DirRoot:     dirRoot,
+				StateDir:    stateDir,
+				Concurrency: tc.concurrency,
 			}
-			ep := newExecPool(n, &stdio.StdIO{})
-			ep.start(octx, opts)
 
 			mani, err := manifest.LoadDir(planDir)
 			if err != nil {
@@ -71,15 +73,107 @@ func TestPool(t *testing.T) {
 				t.Fatalf("compile failed: %+v", err)
 			}
 
-			ep.add(pl)
-
-			res, err := ep.wait()
+			res, err := Execute(octx, pl, opts)
 			if err != nil {
-				t.Fatalf("execPool wait failed: %+v", err)
+				t.Fatalf("execute failed: %+v", err)
 			}
 			if res == nil {
 				t.Fatal("result was nil")
 			}
+
+			var names []string
+			for _, planRes := range res.Plans {
+				names = append(names, planRes.Name)
+			}
+			if !reflect.DeepEqual(names, tc.expect) {
+				t.Errorf("expected plan results %v, got %v", tc.expect, names)
+			}
 		})
 	}
 }
+
+func TestPlanGraph(t *testing.T) {
+	a := &compiler.Plan{Name: "a"}
+	b := &compiler.Plan{Name: "b", Dependencies: []*compiler.Plan{a}}
+	c := &compiler.Plan{Name: "c", Dependencies: []*compiler.Plan{a}}
+	d := &compiler.Plan{Name: "d", Dependencies: []*compiler.Plan{c, b}}
+	main := &compiler.Plan{Name: "main", Plans: []*compiler.Plan{d, c, b}}
+
+	g, err := newPlanGraph(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, pl := range g.plans {
+		names = append(names, pl.Name)
+	}
+	if expect := []string{"a", "b", "c", "d", "main"}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("expected plans %v, got %v", expect, names)
+	}
+	if expect := []int{0, 1, 1, 2, 0}; !reflect.DeepEqual(g.ndeps, expect) {
+		t.Errorf("expected dependency counts %v, got %v", expect, g.ndeps)
+	}
+	if expect := []int{1, 2}; !reflect.DeepEqual(g.dependents[0], expect) {
+		t.Errorf("expected dependents of a to be %v, got %v", expect, g.dependents[0])
+	}
+
+	a.Dependencies = []*compiler.Plan{d}
+	_, err = newPlanGraph(main)
+	if err == nil {
+		t.Fatal("expected circular dependency error")
+	}
+	if expect := "circular dependency: d -> c -> a -> d"; err.Error() != expect {
+		t.Errorf("expected error %q, got %q", expect, err.Error())
+	}
+}
+
+func TestExecuteEvents(t *testing.T) {
+	ctx := testenv.Context()
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "noop"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+	planDir := filepath.Join(tmpdir, "manifest")
+	stateDir := filepath.Join(tmpdir, "state")
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		panic(err)
+	}
+
+	mani, err := manifest.LoadDir(planDir)
+	if err != nil {
+		t.Fatalf("manifest.LoadDir failed: %+v", err)
+	}
+	pl, err := compiler.New().Compile(ctx, mani)
+	if err != nil {
+		t.Fatalf("compile failed: %+v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	octx := operator.NewContext(ctx, opfs.New(tmpdir), opfs.NewPlanDirFS(planDir), nil)
+	opts := Opts{
+		DirRoot:   tmpdir,
+		StateDir:  stateDir,
+		Formatter: format.NewJSONWriter(buf),
+	}
+	if _, err := Execute(octx, pl, opts); err != nil {
+		t.Fatalf("execute failed: %+v", err)
+	}
+
+	var types []format.EventType
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		ev := format.Event{}
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal("decode event failed:", err)
+		}
+		if ev.Plan != "main" {
+			t.Errorf("expected event for plan main, got %q", ev.Plan)
+		}
+		if ev.Type == format.EventOperation && (ev.Operation != "noop" || !ev.Executed || ev.PrevState == nil) {
+			t.Errorf("unexpected operation event: %+v", ev)
+		}
+		types = append(types, ev.Type)
+	}
+	expect := []format.EventType{format.EventPlanStart, format.EventOperation, format.EventPlanFinish}
+	if !reflect.DeepEqual(types, expect) {
+		t.Errorf("expected events %v, got %v", expect, types)
+	}
+}
@@ -0,0 +1,258 @@
+package execute
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/jeffrom/polyester/compiler"
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/planner/format"
+	"github.com/jeffrom/polyester/state"
+)
+
+// Explanation describes why an operation is dirty.
+type Explanation struct {
+	// PrevEmpty is true when the operation has never run.
+	PrevEmpty bool `json:"prev_empty"`
+	// Changes lists each state entry that differs from the previous state.
+	Changes []string `json:"changes,omitempty"`
+	// CustomChanges is true when the operator decides whether it changed
+	// itself, so Changes may not account for it being dirty.
+	CustomChanges bool `json:"custom_changes,omitempty"`
+	// InheritedFrom is the earlier operation in the plan that made this one
+	// dirty, if it wasn't dirty on its own.
+	InheritedFrom string `json:"inherited_from,omitempty"`
+	// Contents are the files the operation would write.
+	Contents []ContentChange `json:"contents,omitempty"`
+}
+
+// ContentChange is the current and desired contents of a file.
+type ContentChange struct {
+	Path    string `json:"path"`
+	Current []byte `json:"-"`
+	Desired []byte `json:"-"`
+}
+
+func explainOperation(octx operator.Context, res *OperationResult, inheritedFrom string) (*Explanation, error) {
+	origOp, err := compiler.GetOperation(res.op)
+	if err != nil {
+		return nil, err
+	}
+
+	prevSrcSt := res.prevState.Source()
+	cmpSt := res.desiredState
+	if cmpSt.Empty() {
+		cmpSt = res.currState.Source()
+	}
+
+	ex := &Explanation{
+		PrevEmpty: res.PrevEmpty,
+		Changes:   prevSrcSt.Changes(cmpSt),
+	}
+	if _, ok := origOp.(operator.ChangeDetector); ok {
+		ex.CustomChanges = true
+	}
+	if !res.PrevEmpty && !res.Changed {
+		ex.InheritedFrom = inheritedFrom
+	}
+
+	if dcop, ok := origOp.(operator.DesiredContenter); ok {
+		contents, err := dcop.DesiredContents(octx)
+		if err != nil {
+			return nil, err
+		}
+		for _, dc := range contents {
+			curr, err := readCurrent(octx, dc.Path)
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Equal(curr, dc.Contents) {
+				continue
+			}
+			ex.Contents = append(ex.Contents, ContentChange{
+				Path:    dc.Path,
+				Current: dc.Mask(curr),
+				Desired: dc.Mask(dc.Contents),
+			})
+		}
+	}
+	return ex, nil
+}
+
+// Drift is a file that changed since it was last written by an operation,
+// even though the operation's inputs didn't change.
+type Drift struct {
+	Path string `json:"path"`
+	// Changes lists how the file differs from its state after the last
+	// apply.
+	Changes []string `json:"changes"`
+	Current []byte   `json:"-"`
+	Desired []byte   `json:"-"`
+}
+
+// detectDrift compares the files an operation writes with their state after
+// the last apply. Operations that haven't been applied yet can't drift.
+func detectDrift(octx operator.Context, res *OperationResult) ([]Drift, error) {
+	origOp, err := compiler.GetOperation(res.op)
+	if err != nil {
+		return nil, err
+	}
+	dcop, ok := origOp.(operator.DesiredContenter)
+	if !ok || res.prevState.Empty() {
+		return nil, nil
+	}
+	contents, err := dcop.DesiredContents(octx)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []Drift
+	for _, dc := range contents {
+		prevEnt, ok := res.prevState.Get(dc.Path)
+		if !ok {
+			continue
+		}
+		currEnt, ok := res.currState.Get(dc.Path)
+		if !ok {
+			currEnt = state.Entry{Name: dc.Path}
+		}
+		changes := prevEnt.Changes(currEnt)
+		if len(changes) == 0 {
+			continue
+		}
+		curr, err := readCurrent(octx, dc.Path)
+		if err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, Drift{
+			Path:    dc.Path,
+			Changes: changes,
+			Current: dc.Mask(curr),
+			Desired: dc.Mask(dc.Contents),
+		})
+	}
+	return drifts, nil
+}
+
+// readCurrent reads the file at p, returning no contents if it doesn't exist.
+func readCurrent(octx operator.Context, p string) ([]byte, error) {
+	b, err := octx.FS.ReadFile(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return b, nil
+}
+
+// WriteDiff writes why each dirty operation would run, followed by a unified
+// diff of the files it would write. Operations are only explained in dry
+// runs.
+func (r Result) WriteDiff(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	n := 0
+	for _, plan := range r.Plans {
+		if plan == nil {
+			continue
+		}
+		for _, opRes := range plan.Operations {
+			if !opRes.Dirty || opRes.Explanation == nil {
+				continue
+			}
+			n++
+			if err := writeExplanation(bw, plan.Name, opRes); err != nil {
+				return err
+			}
+		}
+	}
+	if n == 0 {
+		bw.WriteString("no changes\n")
+	}
+	return bw.Flush()
+}
+
+func writeExplanation(bw *bufio.Writer, planName string, opRes *OperationResult) error {
+	origOp, err := compiler.GetOperation(opRes.op)
+	if err != nil {
+		return err
+	}
+	var opFmt string
+	if sr, ok := origOp.(fmt.Stringer); ok {
+		opFmt = sr.String()
+	} else {
+		b, err := json.Marshal(origOp.Info().Data().Command.Target)
+		if err != nil {
+			return err
+		}
+		opFmt = string(b)
+	}
+
+	ex := opRes.Explanation
+	bw.WriteString(fmt.Sprintf("%s: %s %s\n", planName, opRes.Name, opFmt))
+	switch {
+	case ex.PrevEmpty:
+		bw.WriteString("  no previous state\n")
+	case ex.InheritedFrom != "":
+		bw.WriteString(fmt.Sprintf("  dirty because %s is dirty\n", ex.InheritedFrom))
+	}
+	for _, change := range ex.Changes {
+		bw.WriteString(fmt.Sprintf("  changed: %s\n", change))
+	}
+	if !ex.PrevEmpty && ex.InheritedFrom == "" && len(ex.Changes) == 0 && ex.CustomChanges {
+		bw.WriteString("  changed: reported by operator\n")
+	}
+	for _, cc := range ex.Contents {
+		if err := format.UnifiedDiff(bw, path.Join("a", cc.Path), path.Join("b", cc.Path), cc.Current, cc.Desired); err != nil {
+			return err
+		}
+	}
+	bw.WriteString("\n")
+	return nil
+}
+
+// Drifted returns the number of files that drifted. Drift is only detected
+// when the plans were executed with Opts.Drift.
+func (r Result) Drifted() int {
+	n := 0
+	for _, plan := range r.Plans {
+		if plan == nil {
+			continue
+		}
+		for _, opRes := range plan.Operations {
+			n += len(opRes.Drift)
+		}
+	}
+	return n
+}
+
+// WriteDrift writes each file that drifted, followed by a unified diff from
+// its desired contents to its contents on disk.
+func (r Result) WriteDrift(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, plan := range r.Plans {
+		if plan == nil {
+			continue
+		}
+		for _, opRes := range plan.Operations {
+			for _, d := range opRes.Drift {
+				bw.WriteString(fmt.Sprintf("%s: %s %s\n", plan.Name, opRes.Name, d.Path))
+				for _, change := range d.Changes {
+					bw.WriteString(fmt.Sprintf("  changed: %s\n", change))
+				}
+				if err := format.UnifiedDiff(bw, path.Join("desired", d.Path), path.Join("current", d.Path), d.Desired, d.Current); err != nil {
+					return err
+				}
+				bw.WriteString("\n")
+			}
+		}
+	}
+	if r.Drifted() == 0 {
+		bw.WriteString("no drift\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,90 @@
+package execute
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// OperationError is the error of a plan that failed while reading the state
+// of, or running, one of its operations.
+type OperationError struct {
+	Plan      string      `json:"plan"`
+	Operation string      `json:"operation"`
+	Target    interface{} `json:"target,omitempty"`
+	Err       error       `json:"-"`
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("plan %s: %s: %v", e.Plan, e.Operation, e.Err)
+}
+
+func (e *OperationError) Unwrap() error { return e.Err }
+
+// Status summarizes the outcome of executing a manifest.
+type Status int
+
+const (
+	// StatusSuccess means every plan completed.
+	StatusSuccess Status = iota
+	// StatusPartialFailure means at least one plan failed, and at least one
+	// plan completed.
+	StatusPartialFailure
+	// StatusFailure means no plan completed.
+	StatusFailure
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusSuccess:
+		return "success"
+	case StatusPartialFailure:
+		return "partial failure"
+	case StatusFailure:
+		return "failure"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// ExitCode returns the process exit code for the status: 0 for success, 1 for
+// failure, and 2 for partial failure.
+func (s Status) ExitCode() int {
+	switch s {
+	case StatusSuccess:
+		return 0
+	case StatusPartialFailure:
+		return 2
+	}
+	return 1
+}
+
+// FailureError is returned when one or more plans fail. It contains every
+// failed operation.
+type FailureError struct {
+	Status   Status
+	Failures []*OperationError
+}
+
+func (e *FailureError) Error() string {
+	if len(e.Failures) == 1 {
+		return e.Failures[0].Error()
+	}
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = f.Error()
+	}
+	return fmt.Sprintf("%d plans failed:\n\t%s", len(e.Failures), strings.Join(msgs, "\n\t"))
+}
+
+// ExitCode returns the process exit code for the error's status.
+func (e *FailureError) ExitCode() int { return e.Status.ExitCode() }
+
+// planFailure returns the plan's error as an *OperationError. Errors that
+// didn't come from an operation have an empty Operation.
+func planFailure(res *PlanResult) *OperationError {
+	var opErr *OperationError
+	if errors.As(res.Error, &opErr) {
+		return opErr
+	}
+	return &OperationError{Plan: res.Name, Err: res.Error}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/jeffrom/polyester/compiler"
 	"github.com/jeffrom/polyester/operator"
@@ -16,21 +18,53 @@ type Result struct {
 	Plans []*PlanResult `json:"plans"`
 }
 
+// Err returns a *FailureError containing every failure, or nil if no plans
+// failed.
 func (r Result) Err() error {
+	failures := r.Failures()
+	if len(failures) == 0 {
+		return nil
+	}
+	return &FailureError{Status: r.Status(), Failures: failures}
+}
+
+// Failures returns the failed operation of each failed plan.
+func (r Result) Failures() []*OperationError {
+	var failures []*OperationError
+	for _, plan := range r.Plans {
+		if plan == nil || plan.Error == nil {
+			continue
+		}
+		failures = append(failures, planFailure(plan))
+	}
+	return failures
+}
+
+// Status returns whether all, some, or none of the plans completed.
+func (r Result) Status() Status {
+	completed, failed := 0, 0
 	for _, plan := range r.Plans {
 		if plan == nil {
 			continue
 		}
-		if plan.Error != nil {
-			return plan.Error
+		if plan.Error != nil || plan.SkippedBy != "" {
+			failed++
+		} else {
+			completed++
 		}
 	}
-	return nil
+	if failed == 0 {
+		return StatusSuccess
+	}
+	if completed == 0 {
+		return StatusFailure
+	}
+	return StatusPartialFailure
 }
 
 func (r Result) Changed() bool {
 	for _, pl := range r.Plans {
-		if pl.Changed {
+		if pl != nil && pl.Changed {
 			return true
 		}
 	}
@@ -49,7 +83,11 @@ func (r Result) TextSummary(w io.Writer) error {
 		}
 		// bw.WriteString("---\n")
 		label := "dirty"
-		if !plan.Changed {
+		if plan.Error != nil {
+			label = "failed"
+		} else if plan.SkippedBy != "" {
+			label = "skipped (dependency " + plan.SkippedBy + " failed)"
+		} else if !plan.Changed {
 			label = "clean"
 		}
 		bw.WriteString(fmt.Sprintf("%20s(%d): %s\n", plan.Name, len(plan.Operations), label))
@@ -84,10 +122,48 @@ func (r Result) TextSummary(w io.Writer) error {
 				// fmt.Println(plan.Name, opRes.Name, "state diff:", dmp.DiffText2(diffs))
 			}
 		}
+		for _, hres := range plan.Handlers {
+			label := "ran"
+			if !hres.Executed {
+				label = "would run"
+			}
+			bw.WriteString(fmt.Sprintf("handler %s (%s) %s, notified by %s\n", hres.Handler, hres.Name, label, strings.Join(hres.NotifiedBy, ", ")))
+		}
+	}
+	if err := r.writeFailures(bw); err != nil {
+		return err
 	}
 	return bw.Flush()
 }
 
+func (r Result) writeFailures(bw *bufio.Writer) error {
+	failures := r.Failures()
+	if len(failures) == 0 {
+		return nil
+	}
+
+	bw.WriteString(fmt.Sprintf("%d plan(s) failed (%s):\n", len(failures), r.Status()))
+	tw := format.NewTabWriter(bw)
+	format.WriteTabHeader(tw,
+		"PLAN",
+		"OPERATION",
+		"TARGET",
+		"ERROR",
+	)
+	for _, f := range failures {
+		target := ""
+		if f.Target != nil {
+			b, err := json.Marshal(f.Target)
+			if err != nil {
+				return err
+			}
+			target = string(b)
+		}
+		format.WriteTabRow(tw, f.Plan, f.Operation, target, f.Err.Error())
+	}
+	return tw.Flush()
+}
+
 func (r Result) writeStateChanges(bw *bufio.Writer) error {
 	planChanges := 0
 	for _, plan := range r.Plans {
@@ -177,7 +253,22 @@ type PlanResult struct {
 	Operations []*OperationResult `json:"operations"`
 	Changed    bool               `json:"changed"`
 	Error      error              `json:"error"`
-	Plan       *compiler.Plan
+	// SkippedBy is the name of the failed dependency that caused the plan to
+	// be skipped, if any.
+	SkippedBy string `json:"skipped_by,omitempty"`
+	// Handlers are the results of the handlers that were notified, in the
+	// order they were declared.
+	Handlers []*HandlerResult `json:"handlers,omitempty"`
+	Plan     *compiler.Plan
+}
+
+// HandlerResult is the result of a handler that ran at the end of a plan.
+type HandlerResult struct {
+	*OperationResult
+	Handler string `json:"handler"`
+	// NotifiedBy are the names of the operations that changed their targets
+	// and notified the handler.
+	NotifiedBy []string `json:"notified_by"`
 }
 
 type OperationResult struct {
@@ -186,9 +277,23 @@ type OperationResult struct {
 	Changed   bool   `json:"changed"`
 	PrevEmpty bool   `json:"prev_empty"`
 	Executed  bool   `json:"executed"`
+	// TargetChanged is true if the operation executed and its target state,
+	// or its state if it has no target entries, changed. Handlers the
+	// operation notifies only run if it is true.
+	TargetChanged bool `json:"target_changed"`
+	// Duration is how long it took to check and, if dirty, run the
+	// operation.
+	Duration time.Duration `json:"duration"`
+	// Explanation describes why the operation is dirty. It is only set for
+	// dry runs.
+	Explanation *Explanation `json:"explanation,omitempty"`
+	// Drift lists the files the operation wrote that changed since. It is
+	// only set when executing with Opts.Drift.
+	Drift []Drift `json:"drift,omitempty"`
 
-	op         operator.Interface
-	prevState  state.State
-	currState  state.State
-	finalState state.State
+	op           operator.Interface
+	prevState    state.State
+	currState    state.State
+	desiredState state.State
+	finalState   state.State
 }
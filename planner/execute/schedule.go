@@ -0,0 +1,215 @@
+package execute
+
+import (
+	"time"
+
+	"github.com/jeffrom/polyester/compiler"
+	"github.com/jeffrom/polyester/operator"
+	"github.com/jeffrom/polyester/planner/format"
+	"github.com/jeffrom/polyester/stdio"
+)
+
+// planGraph is the dependency graph of every plan in a manifest. It is built
+// once per apply.
+type planGraph struct {
+	// plans are sorted so every plan comes after its dependencies.
+	plans []*compiler.Plan
+	// dependents are the indexes of the plans that depend on each plan.
+	dependents [][]int
+	// ndeps is the number of dependencies of each plan.
+	ndeps []int
+}
+
+func newPlanGraph(plan *compiler.Plan) (*planGraph, error) {
+	plans, err := plan.All()
+	if err != nil {
+		return nil, err
+	}
+
+	idx := make(map[string]int, len(plans))
+	for i, pl := range plans {
+		idx[pl.Name] = i
+	}
+	g := &planGraph{
+		plans:      plans,
+		dependents: make([][]int, len(plans)),
+		ndeps:      make([]int, len(plans)),
+	}
+	for i, pl := range plans {
+		seen := make(map[int]bool)
+		for _, dep := range pl.Dependencies {
+			j := idx[dep.Name]
+			if seen[j] {
+				continue
+			}
+			seen[j] = true
+			g.dependents[j] = append(g.dependents[j], i)
+			g.ndeps[i]++
+		}
+	}
+	return g, nil
+}
+
+// scheduler runs the plans in a planGraph on up to concurrency goroutines. A
+// plan starts as soon as all of its dependencies have completed. When more
+// than one plan is ready, the one that comes first in the graph's sorted order
+// starts first, so a scheduler with a concurrency of one always runs plans in
+// the same order.
+type scheduler struct {
+	std         *stdio.StdIO
+	graph       *planGraph
+	concurrency int
+}
+
+func newScheduler(std *stdio.StdIO, graph *planGraph, concurrency int) *scheduler {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &scheduler{
+		std:         std,
+		graph:       graph,
+		concurrency: concurrency,
+	}
+}
+
+type planDone struct {
+	idx      int
+	res      *PlanResult
+	duration time.Duration
+}
+
+// run executes the plans and returns their results in the graph's sorted
+// order. After a plan fails, no new plans are started, but plans that are
+// already running are allowed to finish. If opts.KeepGoing is set, only the
+// plans that depend on the failed plan, directly or indirectly, are skipped.
+func (s *scheduler) run(octx operator.Context, opts Opts) *Result {
+	g := s.graph
+	n := len(g.plans)
+	waiting := append([]int{}, g.ndeps...)
+	results := make([]*PlanResult, n)
+	doneC := make(chan planDone)
+
+	var ready []int
+	for i := range g.plans {
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	complete := func(i int) {
+		for _, j := range g.dependents[i] {
+			waiting[j]--
+			if waiting[j] == 0 {
+				ready = insertSorted(ready, j)
+			}
+		}
+	}
+
+	running, remaining := 0, n
+	failed := false
+	var skip func(i int, failedName string)
+	skip = func(i int, failedName string) {
+		for _, j := range g.dependents[i] {
+			if results[j] != nil {
+				continue
+			}
+			plan := g.plans[j]
+			s.std.Debugf("scheduler: skipping plan %s because %s failed", plan.Name, failedName)
+			results[j] = &PlanResult{Plan: plan, Name: plan.Name, SkippedBy: failedName}
+			opts.Formatter.Write(format.Event{Type: format.EventPlanFinish, Plan: plan.Name, SkippedBy: failedName})
+			remaining--
+			skip(j, failedName)
+		}
+	}
+	for remaining > 0 {
+		for !failed && running < s.concurrency && len(ready) > 0 && octx.Context.Err() == nil {
+			i := ready[0]
+			ready = ready[1:]
+			plan := g.plans[i]
+			if len(plan.RealOps()) == 0 {
+				s.std.Debugf("scheduler: plan %s has no operations", plan.Name)
+				remaining--
+				complete(i)
+				continue
+			}
+
+			s.std.Debugf("scheduler: starting plan %s", plan.Name)
+			running++
+			go func(i int) {
+				start := time.Now()
+				res := s.executePlan(octx, opts, g.plans[i])
+				doneC <- planDone{idx: i, res: res, duration: time.Since(start)}
+			}(i)
+		}
+		if running == 0 {
+			break
+		}
+
+		done := <-doneC
+		running--
+		remaining--
+		results[done.idx] = done.res
+		opts.Formatter.Write(planFinishEvent(g.plans[done.idx], done.res, done.duration))
+		if done.res != nil && done.res.Error != nil {
+			s.std.Debugf("scheduler: plan %s failed: %v", g.plans[done.idx].Name, done.res.Error)
+			if opts.KeepGoing {
+				skip(done.idx, g.plans[done.idx].Name)
+			} else {
+				failed = true
+			}
+			continue
+		}
+		complete(done.idx)
+	}
+
+	res := &Result{}
+	for _, planRes := range results {
+		if planRes != nil {
+			res.Plans = append(res.Plans, planRes)
+		}
+	}
+	if err := octx.Context.Err(); err != nil && res.Err() == nil {
+		res.Plans = append(res.Plans, &PlanResult{Name: "main", Error: err})
+	}
+	return res
+}
+
+func (s *scheduler) executePlan(octx operator.Context, opts Opts, plan *compiler.Plan) *PlanResult {
+	// each plan gets its own stdio, so the formatter can direct its output
+	std := s.std.WithScope(plan.Name)
+	std = std.WithOutput(opts.Formatter.PlanOutput(plan.Name, std.Stdout(), std.Stderr()))
+	octx.Context = stdio.SetContext(octx.Context, std)
+	planRes, err := executePlan(octx, std, opts, plan)
+	if err != nil {
+		if planRes == nil {
+			planRes = &PlanResult{Plan: plan, Name: plan.Name}
+		}
+		planRes.Error = err
+	}
+	return planRes
+}
+
+func planFinishEvent(plan *compiler.Plan, res *PlanResult, d time.Duration) format.Event {
+	ev := format.Event{
+		Type:       format.EventPlanFinish,
+		Plan:       plan.Name,
+		DurationMS: format.Milliseconds(d),
+	}
+	if res != nil {
+		ev.Changed = res.Changed
+		if res.Error != nil {
+			ev.Error = res.Error.Error()
+		}
+	}
+	return ev
+}
+
+func insertSorted(a []int, v int) []int {
+	i := 0
+	for i < len(a) && a[i] < v {
+		i++
+	}
+	a = append(a, 0)
+	copy(a[i+1:], a[i:])
+	a[i] = v
+	return a
+}
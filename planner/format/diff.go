@@ -0,0 +1,178 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// diffContext is the number of unchanged lines shown around each change in a
+// unified diff.
+const diffContext = 3
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// UnifiedDiff writes a unified diff of a and b, labeled aName and bName. It
+// writes nothing if they are equal.
+func UnifiedDiff(w io.Writer, aName, bName string, a, b []byte) error {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	if isBinary(a) || isBinary(b) {
+		_, err := fmt.Fprintf(w, "Binary files %s and %s differ\n", aName, bName)
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", aName, bName)
+	lines := diffLines(string(a), string(b))
+	for _, h := range hunks(lines) {
+		writeHunk(buf, lines, h[0], h[1])
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func diffLines(a, b string) []diffLine {
+	// diff lines by mapping each distinct line to a rune, and diffing the
+	// runes.
+	var lineArray []string
+	lineIdx := make(map[string]rune)
+	toRunes := func(s string) []rune {
+		var res []rune
+		for _, line := range strings.SplitAfter(s, "\n") {
+			if line == "" {
+				continue
+			}
+			r, ok := lineIdx[line]
+			if !ok {
+				r = lineRune(len(lineArray))
+				lineIdx[line] = r
+				lineArray = append(lineArray, line)
+			}
+			res = append(res, r)
+		}
+		return res
+	}
+	ar, br := toRunes(a), toRunes(b)
+
+	dmp := diffmatchpatch.New()
+	var lines []diffLine
+	for _, d := range dmp.DiffMainRunes(ar, br, false) {
+		op := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		}
+		for _, r := range d.Text {
+			lines = append(lines, diffLine{op: op, text: lineArray[runeLine(r)]})
+		}
+	}
+	return lines
+}
+
+// lineRune and runeLine convert between line indexes and runes, skipping the
+// surrogate range, which isn't valid in strings.
+func lineRune(i int) rune {
+	if i >= 0xd800 {
+		i += 0x800
+	}
+	return rune(i)
+}
+
+func runeLine(r rune) int {
+	if r >= 0xe000 {
+		r -= 0x800
+	}
+	return int(r)
+}
+
+// hunks returns the [start, end) ranges of lines to print, each containing one
+// or more changes and up to diffContext lines of context around them.
+func hunks(lines []diffLine) [][2]int {
+	var res [][2]int
+	for i := 0; i < len(lines); i++ {
+		if lines[i].op == ' ' {
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i + 1
+		for j := i + 1; j < len(lines); j++ {
+			if lines[j].op == ' ' {
+				if j-end >= 2*diffContext {
+					break
+				}
+				continue
+			}
+			end = j + 1
+		}
+		i = end - 1
+		end += diffContext
+		if end > len(lines) {
+			end = len(lines)
+		}
+		res = append(res, [2]int{start, end})
+	}
+	return res
+}
+
+func writeHunk(buf *bytes.Buffer, lines []diffLine, start, end int) {
+	aStart, bStart := 1, 1
+	for _, l := range lines[:start] {
+		if l.op != '+' {
+			aStart++
+		}
+		if l.op != '-' {
+			bStart++
+		}
+	}
+	aCount, bCount := 0, 0
+	for _, l := range lines[start:end] {
+		if l.op != '+' {
+			aCount++
+		}
+		if l.op != '-' {
+			bCount++
+		}
+	}
+	if aCount == 0 {
+		aStart--
+	}
+	if bCount == 0 {
+		bStart--
+	}
+
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+	for _, l := range lines[start:end] {
+		buf.WriteByte(l.op)
+		buf.WriteString(l.text)
+		if !strings.HasSuffix(l.text, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func isBinary(b []byte) bool {
+	if len(b) > 8000 {
+		b = b[:8000]
+	}
+	return bytes.IndexByte(b, 0) >= 0
+}
@@ -0,0 +1,110 @@
+package format
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jeffrom/polyester/state"
+)
+
+// EventType identifies what an Event reports.
+type EventType string
+
+const (
+	// EventCheck reports the result of checking a manifest.
+	EventCheck EventType = "check"
+	// EventApplyStart is written before a manifest is applied.
+	EventApplyStart EventType = "apply_start"
+	// EventApplyFinish is written after a manifest has been applied.
+	EventApplyFinish EventType = "apply_finish"
+	// EventPlanStart is written before a plan's operations are run.
+	EventPlanStart EventType = "plan_start"
+	// EventPlanFinish is written after a plan completes, fails, or is
+	// skipped.
+	EventPlanFinish EventType = "plan_finish"
+	// EventOperation is written after each operation completes or fails.
+	EventOperation EventType = "operation"
+)
+
+// Event is a machine-readable record of planner progress. Fields that don't
+// apply to an event's type are omitted.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+
+	// Dir is the manifest directory, for check and apply events.
+	Dir string `json:"dir,omitempty"`
+	// Plan is the plan name, for plan and operation events.
+	Plan string `json:"plan,omitempty"`
+
+	Operation string `json:"operation,omitempty"`
+	// Handler is the handler name, for operation events of handlers.
+	Handler      string       `json:"handler,omitempty"`
+	Target       interface{}  `json:"target,omitempty"`
+	PrevState    *state.State `json:"prev_state,omitempty"`
+	CurrentState *state.State `json:"current_state,omitempty"`
+	DesiredState *state.State `json:"desired_state,omitempty"`
+	Empty        bool         `json:"empty,omitempty"`
+	Dirty        bool         `json:"dirty,omitempty"`
+	Executed     bool         `json:"executed,omitempty"`
+
+	Changed   bool   `json:"changed,omitempty"`
+	SkippedBy string `json:"skipped_by,omitempty"`
+	Status    string `json:"status,omitempty"`
+
+	// DurationMS is the duration in milliseconds, for finish and operation
+	// events.
+	DurationMS float64 `json:"duration_ms,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	// Errors are the validation errors found, for check events.
+	Errors []CheckError `json:"errors,omitempty"`
+}
+
+// CheckError is a validation error found by check, at the position in the
+// plan script that caused it if it's known.
+type CheckError struct {
+	File      string `json:"file,omitempty"`
+	Line      uint   `json:"line,omitempty"`
+	Col       uint   `json:"col,omitempty"`
+	Plan      string `json:"plan,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Milliseconds converts d for use as Event.DurationMS.
+func Milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// JSONWriter is a Formatter that writes events as JSON lines. It is safe for
+// concurrent use, and a nil *JSONWriter discards all events.
+type JSONWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	return &JSONWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes ev as a line of JSON. If ev.Time is zero, it is set to the
+// current time.
+func (w *JSONWriter) Write(ev Event) error {
+	if w == nil {
+		return nil
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(ev)
+}
+
+func (w *JSONWriter) PlanOutput(plan string, stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	return stdout, stderr
+}
+
+func (w *JSONWriter) Close() error { return nil }
@@ -6,36 +6,67 @@ import (
 	"io"
 )
 
-// TODO operation should output smth like this (or maybe just tabwriter):
-// useradd:			[   ] [ unchanged ] [          ]
-// sh:				[ X ] [ unchanged ] [  success ]
-// atomic-copy:		[ X ] [ changed   ] [  success ]
-// apt-install:		[ X ] [ empty     ] [   failed ] error: exit status 1 (apt install abc)
-// touch:			[   ] [ unchanged ] [          ]
-//
-// if it fails, print any output (logs, combined output from shell) from the
-// operation (at the end of the run, or right when it happens?)
+// Formatter renders planner progress. Plans run concurrently, so
+// implementations must be safe for concurrent use.
+type Formatter interface {
+	// Write reports an event.
+	Write(ev Event) error
 
-// type Interface struct {
-// }
+	// PlanOutput returns the writers for standard output and standard error
+	// from the named plan's operations, such as the output of shell
+	// commands. stdout and stderr are where the output would be written
+	// otherwise.
+	PlanOutput(plan string, stdout, stderr io.Writer) (io.Writer, io.Writer)
 
-type DefaultFormatter struct{}
+	// Close is called once all plans have completed, and writes anything
+	// that was held until the end of the run.
+	Close() error
+}
+
+// DefaultFormatter is the plain formatter. It prints a line for each
+// completed operation, and passes plan output through unchanged.
+type DefaultFormatter struct {
+	W io.Writer
+}
+
+// NewPlain returns a plain formatter that writes to w.
+func NewPlain(w io.Writer) *DefaultFormatter {
+	return &DefaultFormatter{W: w}
+}
+
+func (fm DefaultFormatter) Write(ev Event) error {
+	if ev.Type != EventOperation || ev.Error != "" {
+		return nil
+	}
+	return fm.OpComplete(fm.W, ev.Operation, ev.Empty, ev.Changed, ev.Dirty, ev.Executed)
+}
+
+func (fm DefaultFormatter) PlanOutput(plan string, stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	return stdout, stderr
+}
+
+func (fm DefaultFormatter) Close() error { return nil }
 
 func (fm DefaultFormatter) OpComplete(w io.Writer, name string, empty, changed, dirty, executed bool) error {
-	stateLabel := "unchanged"
+	fmt.Fprintf(w, "%25s: [ %1s ] [ %9s ]\n", name, execLabel(executed), stateLabel(empty, changed, dirty, executed))
+	return nil
+}
+
+func execLabel(executed bool) string {
+	if executed {
+		return "X"
+	}
+	return ""
+}
+
+func stateLabel(empty, changed, dirty, executed bool) string {
 	switch {
 	case changed || dirty:
-		stateLabel = "changed"
+		return "changed"
 	case empty && executed && !dirty:
-		stateLabel = "unchanged"
+		return "unchanged"
 	case empty:
-		stateLabel = "empty"
-	}
-	execLabel := ""
-	if executed {
-		execLabel = "X"
+		return "empty"
 	}
-
-	fmt.Fprintf(w, "%25s: [ %1s ] [ %9s ]\n", name, execLabel, stateLabel)
-	return nil
+	return "unchanged"
 }
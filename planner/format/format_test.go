@@ -0,0 +1,125 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTableFormatter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fm := NewTable(buf)
+
+	stdout, stderr := fm.PlanOutput("a", nil, nil)
+	fmt.Fprintln(stdout, "discarded")
+	fm.Write(Event{Type: EventOperation, Plan: "a", Operation: "touch", Executed: true, Changed: true})
+	fmt.Fprintln(stderr, "oh no")
+	fm.Write(Event{Type: EventOperation, Plan: "a", Operation: "sh", Executed: true, Error: "exit status 1"})
+	if err := fm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `                    touch: [ X ] [ changed   ] [ success ]
+                       sh: [ X ] [ unchanged ] [  failed ] error: exit status 1
+    | oh no
+`
+	if buf.String() != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, buf.String())
+	}
+}
+
+func TestTTYFormatter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fm := NewTTY(buf)
+
+	aout, _ := fm.PlanOutput("a", nil, nil)
+	bout, _ := fm.PlanOutput("b", nil, nil)
+	fm.Write(Event{Type: EventPlanStart, Plan: "a"})
+	fm.Write(Event{Type: EventPlanStart, Plan: "b"})
+	fmt.Fprintln(aout, "a output")
+	fmt.Fprintln(bout, "b output")
+	fm.Write(Event{Type: EventOperation, Plan: "a", Operation: "sh", Error: "exit status 1"})
+	fm.Write(Event{Type: EventPlanFinish, Plan: "a", Error: "exit status 1"})
+	fm.Write(Event{Type: EventPlanFinish, Plan: "b"})
+	if err := fm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "\x1b[2A") {
+		t.Errorf("expected lines to be redrawn in place, got %q", out)
+	}
+	last := out[strings.LastIndex(out, "\x1b[2A"):]
+	for _, expect := range []string{
+		"a: [ failed  ] 1 op(s), 0 changed: exit status 1",
+		"b: [ done    ] 0 op(s), 0 changed",
+		"output of failed plan a:\n    | a output\n",
+	} {
+		if !strings.Contains(last, expect) {
+			t.Errorf("expected final output to contain %q, got %q", expect, last)
+		}
+	}
+	if strings.Contains(out, "b output") {
+		t.Errorf("expected output of successful plan b to be hidden, got %q", out)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tcs := []struct {
+		name   string
+		a      string
+		b      string
+		expect string
+	}{
+		{
+			name: "same",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+		},
+		{
+			name: "new",
+			b:    "a\n",
+			expect: `--- a
++++ b
+@@ -0,0 +1 @@
++a
+`,
+		},
+		{
+			name: "change",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			b:    "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n12\n13",
+			expect: `--- a
++++ b
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+\ No newline at end of file
+`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := UnifiedDiff(buf, "a", "b", []byte(tc.a), []byte(tc.b)); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tc.expect {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expect, buf.String())
+			}
+		})
+	}
+}
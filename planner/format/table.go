@@ -0,0 +1,96 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// TableFormatter prints a row for each operation, with whether it was
+// executed, its state, and its result:
+//
+//	useradd: [   ] [ unchanged ] [         ]
+//	     sh: [ X ] [ unchanged ] [ success ]
+//	  touch: [ X ] [ changed   ] [ success ]
+//	    apt: [ X ] [ empty     ] [  failed ] error: exit status 1
+//
+// Output from a plan's operations is held, and printed after the row of an
+// operation that fails.
+type TableFormatter struct {
+	w    io.Writer
+	mu   sync.Mutex
+	outs map[string]*bytes.Buffer
+}
+
+// NewTable returns a table formatter that writes to w.
+func NewTable(w io.Writer) *TableFormatter {
+	return &TableFormatter{w: w, outs: make(map[string]*bytes.Buffer)}
+}
+
+func (fm *TableFormatter) Write(ev Event) error {
+	if ev.Type != EventOperation {
+		return nil
+	}
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	result := ""
+	if ev.Error != "" {
+		result = "failed"
+	} else if ev.Executed {
+		result = "success"
+	}
+	line := fmt.Sprintf("%25s: [ %1s ] [ %-9s ] [ %7s ]", ev.Operation, execLabel(ev.Executed), stateLabel(ev.Empty, ev.Changed, ev.Dirty, ev.Executed), result)
+	if ev.Error != "" {
+		line += " error: " + ev.Error
+	}
+	if _, err := fmt.Fprintln(fm.w, line); err != nil {
+		return err
+	}
+
+	out := fm.outs[ev.Plan]
+	if out == nil {
+		return nil
+	}
+	defer out.Reset()
+	if ev.Error == "" || out.Len() == 0 {
+		return nil
+	}
+	return writeIndented(fm.w, out.String())
+}
+
+func (fm *TableFormatter) PlanOutput(plan string, stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	out := &bytes.Buffer{}
+	fm.outs[plan] = out
+	w := &lockedWriter{mu: &fm.mu, w: out}
+	return w, w
+}
+
+func (fm *TableFormatter) Close() error { return nil }
+
+func writeIndented(w io.Writer, s string) error {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, "    | "+line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockedWriter serializes writes to a buffer that is also read by a
+// formatter.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
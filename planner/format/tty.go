@@ -0,0 +1,126 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// TTYFormatter shows a line for each plan that updates in place as plans run
+// concurrently. Output from a plan's operations is held, and printed at the
+// end of the run for plans that failed. It is meant for interactive
+// terminals.
+type TTYFormatter struct {
+	w      io.Writer
+	mu     sync.Mutex
+	plans  []*ttyPlan
+	byName map[string]*ttyPlan
+	// drawn is the number of lines written by the last redraw.
+	drawn int
+}
+
+type ttyPlan struct {
+	name    string
+	status  string
+	op      string
+	ops     int
+	changed int
+	err     string
+	out     bytes.Buffer
+}
+
+// NewTTY returns a TTY formatter that writes to w.
+func NewTTY(w io.Writer) *TTYFormatter {
+	return &TTYFormatter{w: w, byName: make(map[string]*ttyPlan)}
+}
+
+func (fm *TTYFormatter) Write(ev Event) error {
+	if ev.Plan == "" {
+		return nil
+	}
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	pl := fm.plan(ev.Plan)
+	switch ev.Type {
+	case EventPlanStart:
+		pl.status = "running"
+	case EventOperation:
+		pl.op = ev.Operation
+		pl.ops++
+		if ev.Changed || ev.Dirty {
+			pl.changed++
+		}
+	case EventPlanFinish:
+		pl.op = ""
+		switch {
+		case ev.Error != "":
+			pl.status = "failed"
+			pl.err = ev.Error
+		case ev.SkippedBy != "":
+			pl.status = "skipped"
+			pl.err = "dependency " + ev.SkippedBy + " failed"
+		default:
+			pl.status = "done"
+		}
+	}
+	return fm.redraw()
+}
+
+func (fm *TTYFormatter) PlanOutput(plan string, stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	w := &lockedWriter{mu: &fm.mu, w: &fm.plan(plan).out}
+	return w, w
+}
+
+func (fm *TTYFormatter) Close() error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	for _, pl := range fm.plans {
+		if pl.status != "failed" || pl.out.Len() == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(fm.w, "output of failed plan %s:\n", pl.name); err != nil {
+			return err
+		}
+		if err := writeIndented(fm.w, pl.out.String()); err != nil {
+			return err
+		}
+	}
+	fm.drawn = 0
+	return nil
+}
+
+func (fm *TTYFormatter) plan(name string) *ttyPlan {
+	pl := fm.byName[name]
+	if pl == nil {
+		pl = &ttyPlan{name: name, status: "waiting"}
+		fm.byName[name] = pl
+		fm.plans = append(fm.plans, pl)
+	}
+	return pl
+}
+
+// redraw moves the cursor back over the previously drawn lines, and draws a
+// line for each plan.
+func (fm *TTYFormatter) redraw() error {
+	buf := &bytes.Buffer{}
+	if fm.drawn > 0 {
+		fmt.Fprintf(buf, "\x1b[%dA", fm.drawn)
+	}
+	for _, pl := range fm.plans {
+		detail := fmt.Sprintf("%d op(s), %d changed", pl.ops, pl.changed)
+		if pl.op != "" {
+			detail += ", " + pl.op
+		}
+		if pl.err != "" {
+			detail += ": " + pl.err
+		}
+		fmt.Fprintf(buf, "\x1b[2K%20s: [ %-7s ] %s\n", pl.name, pl.status, detail)
+	}
+	fm.drawn = len(fm.plans)
+	_, err := fm.w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,58 @@
+package planner
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestHandlers(t *testing.T) {
+	testenv.RequireEnv(t, "TESTBIN")
+
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "handlers"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	ctx := testenv.Context()
+	manifestDir := filepath.Join(tmpdir, "manifest")
+	pl := newPlanner(t, manifestDir)
+	if err := pl.Check(ctx); err != nil {
+		t.Fatal("check failed:", err)
+	}
+
+	opts := ApplyOpts{
+		DirRoot:  filepath.Join(tmpdir, "dir"),
+		StateDir: filepath.Join(tmpdir, "state"),
+	}
+	handledPath := filepath.Join(opts.DirRoot, "tmp", "test", "handlers", "handled")
+	apply := func(expectNotifiedBy []string, expectHandled string) {
+		t.Helper()
+		res, err := pl.Apply(ctx, opts)
+		if err != nil {
+			t.Fatal("apply failed:", err)
+		}
+		main := res.Plans[len(res.Plans)-1]
+		var notifiedBy []string
+		for _, hres := range main.Handlers {
+			if hres.Handler != "reload" || !hres.Executed {
+				t.Errorf("expected handler reload to be executed, got %+v", hres)
+			}
+			notifiedBy = append(notifiedBy, hres.NotifiedBy...)
+		}
+		if !reflect.DeepEqual(notifiedBy, expectNotifiedBy) {
+			t.Errorf("expected handler to be notified by %q, got %q", expectNotifiedBy, notifiedBy)
+		}
+		if got := testenv.ReadFile(t, handledPath); got != expectHandled {
+			t.Errorf("expected handler output %q, got %q", expectHandled, got)
+		}
+	}
+
+	// the handler runs once, even though two operations notified it.
+	apply([]string{"template", "template"}, "reloaded\n")
+	apply(nil, "reloaded\n")
+
+	testenv.WriteFile(t, filepath.Join(manifestDir, "templates", "greeting"), "hi\n")
+	apply([]string{"template", "template"}, "reloaded\nreloaded\n")
+	apply(nil, "reloaded\nreloaded\n")
+}
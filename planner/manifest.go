@@ -28,17 +28,20 @@ import (
 // 	dir string
 // }
 
-func (r *Planner) setupState(plan *compiler.Plan, opts ApplyOpts) (string, error) {
+func (r *Planner) setupState(std *stdio.StdIO, plan *compiler.Plan, opts ApplyOpts) (string, error) {
 	// 1. figure out if this is a single script run & find the manifest file
 	// (the nearest parent with polyester.sh)
 	mDir, err := r.findManifestDir()
 	if err != nil {
 		return "", err
 	}
-	fmt.Println("manifest dir is:", mDir)
+	std.Info("manifest dir is:", mDir)
 
 	// 2. if the directory doesn't already exist, create it
-	key := manifestKey(mDir)
+	key := r.stateKey
+	if key == "" {
+		key = manifestKey(mDir)
+	}
 	stateDir := filepath.Join(opts.StateDir, key)
 	if _, err := os.Stat(stateDir); err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
@@ -124,7 +127,15 @@ func (r *Planner) gatherOpKeys(plan *compiler.Plan, stateDir string, keys map[st
 		keys = make(map[string]bool)
 	}
 
-	for _, op := range plan.Operations {
+	ops := plan.Operations
+	handlers, err := plan.Handlers()
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range handlers {
+		ops = append(ops, h.Operation)
+	}
+	for _, op := range ops {
 		key, err := opCacheKey(op.Info().Data())
 		if err != nil {
 			return nil, err
@@ -0,0 +1,54 @@
+package planner
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jeffrom/polyester/executil"
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestOpAptInstall(t *testing.T) {
+	testenv.RequireEnv(t, "TESTBIN")
+
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "apt-install"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	apt := testenv.NewApt()
+	apt.Available("git", "1:2.30.1-1", "1:2.30.2-1")
+	executil.SetCommand(apt.Command)
+	defer executil.ResetCommand()
+
+	ctx := testenv.Context()
+	pl := newPlanner(t, filepath.Join(tmpdir, "manifest"))
+	if err := pl.Check(ctx); err != nil {
+		t.Fatal("check failed:", err)
+	}
+
+	opts := ApplyOpts{
+		DirRoot:  filepath.Join(tmpdir, "dir"),
+		StateDir: filepath.Join(tmpdir, "state"),
+	}
+	apply := func(expectCalls ...string) {
+		t.Helper()
+		apt.Reset()
+		if _, err := pl.Apply(ctx, opts); err != nil {
+			t.Fatal("apply failed:", err)
+		}
+		if calls := apt.Calls(); !reflect.DeepEqual(calls, expectCalls) {
+			t.Errorf("expected apt calls %q, got %q", expectCalls, calls)
+		}
+	}
+
+	apply("install git")
+	apply()
+	if pkg := apt.Package("git"); pkg == nil || pkg.Version != "1:2.30.2-1" {
+		t.Errorf("expected git 1:2.30.2-1 to be installed, got %+v", pkg)
+	}
+
+	// a package changed outside of polyester is installed again.
+	apt.Install("git", "1:2.30.1-1")
+	apply("install git")
+	apply()
+}
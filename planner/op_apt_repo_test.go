@@ -0,0 +1,70 @@
+package planner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestOpAptRepo(t *testing.T) {
+	testenv.RequireEnv(t, "TESTBIN")
+
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "apt-repo"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	ctx := testenv.Context()
+	manifestDir := filepath.Join(tmpdir, "manifest")
+	pl := newPlanner(t, manifestDir)
+	if err := pl.Check(ctx); err != nil {
+		t.Fatal("check failed:", err)
+	}
+
+	opts := ApplyOpts{
+		DirRoot:  filepath.Join(tmpdir, "dir"),
+		StateDir: filepath.Join(tmpdir, "state"),
+	}
+	listPath := filepath.Join(opts.DirRoot, "etc", "apt", "sources.list.d", "example.list")
+	keyringPath := filepath.Join(opts.DirRoot, "etc", "apt", "keyrings", "example.asc")
+	oldPath := filepath.Join(opts.DirRoot, "etc", "apt", "sources.list.d", "old.list")
+	if err := os.MkdirAll(filepath.Dir(oldPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	testenv.WriteFile(t, oldPath, "deb https://old.example.com/debian bullseye main\n")
+
+	expectList := "# managed by polyester\n" +
+		"deb [arch=amd64 signed-by=/etc/apt/keyrings/example.asc] https://deb.example.com/debian bullseye main contrib\n"
+	for i := 0; i < 3; i++ {
+		res, err := pl.Apply(ctx, opts)
+		if err != nil {
+			t.Fatal("apply failed:", err)
+		}
+		if changed := res.Changed(); i == 0 && !changed {
+			t.Error("expected first run to be changed")
+		} else if i != 0 && changed {
+			t.Errorf("expected run #%d not to be changed", i+1)
+		}
+		if got := testenv.ReadFile(t, listPath); got != expectList {
+			t.Fatalf("run #%d: expected:\n%s\ngot:\n%s", i+1, expectList, got)
+		}
+		if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+			t.Fatalf("run #%d: expected %s to be removed, got %v", i+1, oldPath, err)
+		}
+	}
+
+	// a new key is copied to the keyring, and changes the repo.
+	keyPath := filepath.Join(manifestDir, "files", "example.asc")
+	key := "-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nnewkey\n-----END PGP PUBLIC KEY BLOCK-----\n"
+	testenv.WriteFile(t, keyPath, key)
+	res, err := pl.Apply(ctx, opts)
+	if err != nil {
+		t.Fatal("apply failed:", err)
+	}
+	if !res.Changed() {
+		t.Error("expected apply to be changed after the key changed")
+	}
+	if got := testenv.ReadFile(t, keyringPath); got != key {
+		t.Errorf("expected keyring:\n%s\ngot:\n%s", key, got)
+	}
+}
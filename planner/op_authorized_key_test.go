@@ -0,0 +1,113 @@
+package planner
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestOpAuthorizedKey(t *testing.T) {
+	testenv.RequireEnv(t, "TESTBIN")
+
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "authorized-key"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := testenv.Context()
+	pl := newPlanner(t, filepath.Join(tmpdir, "manifest"))
+	if err := pl.Check(ctx); err != nil {
+		t.Fatal("check failed:", err)
+	}
+
+	opts := ApplyOpts{
+		DirRoot:  filepath.Join(tmpdir, "dir"),
+		StateDir: filepath.Join(tmpdir, "state"),
+	}
+	sshDir := filepath.Join(opts.DirRoot, u.HomeDir, ".ssh")
+	keysPath := filepath.Join(sshDir, "authorized_keys")
+	expect := "no-pty ssh-ed25519 a2V5LWE= alice@laptop\n" +
+		"command=\"/usr/local/bin/deploy\" ssh-ed25519 a2V5LWI= deploy@ci\n"
+	apply := func(expectChanged bool, expect string) {
+		t.Helper()
+		res, err := pl.Apply(ctx, opts)
+		if err != nil {
+			t.Fatal("apply failed:", err)
+		}
+		if changed := res.Changed(); changed != expectChanged {
+			t.Errorf("expected changed: %v, got %v", expectChanged, changed)
+		}
+		if got := testenv.ReadFile(t, keysPath); got != expect {
+			t.Errorf("expected:\n%s\ngot:\n%s", expect, got)
+		}
+	}
+
+	apply(true, expect)
+	for p, mode := range map[string]os.FileMode{sshDir: 0700, keysPath: 0600} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("expected %s to have mode %#o, got %#o", p, mode, info.Mode().Perm())
+		}
+	}
+	apply(false, expect)
+
+	// keys added by hand are kept.
+	hand := "ssh-rsa a2V5LWM= carol@laptop\n"
+	testenv.WriteFile(t, keysPath, expect+hand)
+	apply(false, expect+hand)
+
+	// a managed key removed by hand is added back.
+	testenv.WriteFile(t, keysPath, hand)
+	apply(true, hand+"no-pty ssh-ed25519 a2V5LWE= alice@laptop\n"+
+		"command=\"/usr/local/bin/deploy\" ssh-ed25519 a2V5LWI= deploy@ci\n")
+
+	// so are the directory's modes.
+	if err := os.Chmod(sshDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	res, err := pl.Apply(ctx, opts)
+	if err != nil {
+		t.Fatal("apply failed:", err)
+	}
+	if !res.Changed() {
+		t.Error("expected apply to be changed after the .ssh mode changed")
+	}
+	if info, err := os.Stat(sshDir); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0700 {
+		t.Errorf("expected .ssh mode to be restored, got %#o", info.Mode().Perm())
+	}
+
+	// on a fresh host, the user is added earlier in the plan, so it doesn't
+	// exist yet when the states of the plan's operations are read.
+	freshDir := filepath.Join(tmpdir, "fresh")
+	if err := os.MkdirAll(freshDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	testenv.WriteFile(t, filepath.Join(freshDir, "polyester.sh"), `#!/bin/sh
+set -eu
+
+P useradd --create-home polyester-newuser
+P authorized-key polyester-newuser "ssh-ed25519 a2V5LWE= alice@laptop"
+`)
+	res, err = newPlanner(t, freshDir).Apply(ctx, ApplyOpts{
+		Dryrun:   true,
+		DirRoot:  filepath.Join(tmpdir, "fresh-dir"),
+		StateDir: filepath.Join(tmpdir, "fresh-state"),
+	})
+	if err != nil {
+		t.Fatal("dryrun apply for a new user failed:", err)
+	}
+	if !res.Changed() {
+		t.Error("expected dryrun apply for a new user to be changed")
+	}
+}
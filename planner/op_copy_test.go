@@ -1,7 +1,6 @@
 package planner
 
 import (
-	"context"
 	"path/filepath"
 	"testing"
 
@@ -24,7 +23,7 @@ func testOpCopySimple(t *testing.T) {
 		t.Fatal("expected planner not to be nil")
 	}
 
-	ctx := context.Background()
+	ctx := testenv.Context()
 	if err := pl.Check(ctx); err != nil {
 		t.Fatal("check failed", err)
 	}
@@ -56,7 +55,7 @@ func testOpCopyChangeSource(t *testing.T) {
 	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "copy"))
 	defer testenv.RemoveOnSuccess(t, tmpdir)
 
-	ctx := context.Background()
+	ctx := testenv.Context()
 	opts := ApplyOpts{
 		DirRoot:  filepath.Join(tmpdir, "dir"),
 		StateDir: filepath.Join(tmpdir, "state"),
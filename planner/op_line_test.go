@@ -0,0 +1,56 @@
+package planner
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestOpLine(t *testing.T) {
+	testenv.RequireEnv(t, "TESTBIN")
+
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "line"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	ctx := testenv.Context()
+	pl := newPlanner(t, filepath.Join(tmpdir, "manifest"))
+	if err := pl.Check(ctx); err != nil {
+		t.Fatal("check failed:", err)
+	}
+
+	opts := ApplyOpts{
+		DirRoot:  filepath.Join(tmpdir, "dir"),
+		StateDir: filepath.Join(tmpdir, "state"),
+	}
+	confPath := filepath.Join(opts.DirRoot, "tmp", "test", "line", "sysctl.conf")
+	expect := "net.ipv4.ip_forward = 1\nvm.swappiness = 10\n" +
+		"# BEGIN sshd\nkernel.panic = 10\nkernel.panic_on_oops = 1\n# END sshd\n"
+	for i := 0; i < 3; i++ {
+		res, err := pl.Apply(ctx, opts)
+		if err != nil {
+			t.Fatal("apply failed:", err)
+		}
+		if changed := res.Changed(); i == 0 && !changed {
+			t.Error("expected first run to be changed")
+		} else if i != 0 && changed {
+			t.Errorf("expected run #%d not to be changed", i+1)
+		}
+		if got := testenv.ReadFile(t, confPath); got != expect {
+			t.Fatalf("run #%d: expected:\n%s\ngot:\n%s", i+1, expect, got)
+		}
+	}
+
+	// an edit that removes a managed line makes the operation dirty again.
+	testenv.WriteFile(t, confPath, "net.ipv4.ip_forward = 1\nvm.swappiness = 60\n")
+	res, err := pl.Apply(ctx, opts)
+	if err != nil {
+		t.Fatal("apply failed:", err)
+	}
+	if !res.Changed() {
+		t.Error("expected apply to be changed after the file was edited")
+	}
+	if got := testenv.ReadFile(t, confPath); got != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, got)
+	}
+}
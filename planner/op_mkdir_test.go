@@ -1,7 +1,6 @@
 package planner
 
 import (
-	"context"
 	"path/filepath"
 	"testing"
 
@@ -23,7 +22,7 @@ func testOpMkdirSimple(t *testing.T) {
 		t.Fatal("expected planner not to be nil")
 	}
 
-	ctx := context.Background()
+	ctx := testenv.Context()
 	if err := pl.Check(ctx); err != nil {
 		t.Fatal("check failed", err)
 	}
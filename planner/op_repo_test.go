@@ -31,7 +31,7 @@ func testOpRepoSimple(t *testing.T) {
 	os.Setenv("REPO_URL", repoURL)
 	defer os.Unsetenv("REPO_URL")
 
-	ctx := context.Background()
+	ctx := testenv.Context()
 
 	pl := newPlanner(t, filepath.Join(tmpdir, "manifest"))
 	if pl == nil {
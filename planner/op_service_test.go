@@ -0,0 +1,77 @@
+package planner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jeffrom/polyester/executil"
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestOpService(t *testing.T) {
+	testenv.RequireEnv(t, "TESTBIN")
+
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "service"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	systemctl := testenv.NewSystemctl()
+	executil.SetCommand(systemctl.Command)
+	defer executil.ResetCommand()
+
+	ctx := testenv.Context()
+	manifestDir := filepath.Join(tmpdir, "manifest")
+	pl := newPlanner(t, manifestDir)
+	if err := pl.Check(ctx); err != nil {
+		t.Fatal("check failed:", err)
+	}
+
+	opts := ApplyOpts{
+		DirRoot:       filepath.Join(tmpdir, "dir"),
+		StateDir:      filepath.Join(tmpdir, "state"),
+		IdentityPaths: []string{testenv.Path("testdata", "age.agent.key")},
+	}
+	apply := func(expectCalls ...string) {
+		t.Helper()
+		systemctl.Reset()
+		if _, err := pl.Apply(ctx, opts); err != nil {
+			t.Fatal("apply failed:", err)
+		}
+		if calls := systemctl.Calls(); !reflect.DeepEqual(calls, expectCalls) {
+			t.Errorf("expected systemctl calls %q, got %q", expectCalls, calls)
+		}
+	}
+
+	apply("daemon-reload", "enable app.service", "start app.service")
+	unit := testenv.ReadFile(t, filepath.Join(opts.DirRoot, "etc", "systemd", "system", "app.service"))
+	if !strings.Contains(unit, `Description=app, listening on :8080`) || !strings.Contains(unit, "EnvironmentFile=/etc/polyester/env/app.service.env") {
+		t.Errorf("unexpected unit:\n%s", unit)
+	}
+	envPath := filepath.Join(opts.DirRoot, "etc", "polyester", "env", "app.service.env")
+	if env := testenv.ReadFile(t, envPath); env != "DB_PASSWORD=\"hunter2\"\n" {
+		t.Errorf("unexpected environment file: %q", env)
+	}
+	info, err := os.Stat(envPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected environment file mode 0600, got %s", info.Mode())
+	}
+
+	apply()
+
+	// a config change earlier in the plan restarts the service.
+	testenv.WriteFile(t, filepath.Join(manifestDir, "templates", "app.conf"), "listen = changed\n")
+	apply("restart app.service")
+
+	// a change to the unit reloads systemd first.
+	testenv.WriteFile(t, filepath.Join(manifestDir, "vars", "default.yaml"), "app:\n  listen: \":9090\"\n")
+	apply("daemon-reload", "restart app.service")
+
+	systemctl.Unit("app.service").Active = false
+	apply("start app.service")
+	apply()
+}
@@ -1,7 +1,6 @@
 package planner
 
 import (
-	"context"
 	"path/filepath"
 	"testing"
 
@@ -27,6 +26,6 @@ func testOpSHSimple(t *testing.T) {
 		DirRoot:  filepath.Join(tmpdir, "dir"),
 		StateDir: filepath.Join(tmpdir, "state"),
 	}
-	ctx := context.Background()
+	ctx := testenv.Context()
 	doApply(ctx, t, pl, opts, true)
 }
@@ -0,0 +1,60 @@
+package planner
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jeffrom/polyester/executil"
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestOpSystemd(t *testing.T) {
+	testenv.RequireEnv(t, "TESTBIN")
+
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "systemd"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	systemctl := testenv.NewSystemctl()
+	executil.SetCommand(systemctl.Command)
+	defer executil.ResetCommand()
+
+	ctx := testenv.Context()
+	manifestDir := filepath.Join(tmpdir, "manifest")
+	pl := newPlanner(t, manifestDir)
+	if err := pl.Check(ctx); err != nil {
+		t.Fatal("check failed:", err)
+	}
+
+	opts := ApplyOpts{
+		DirRoot:  filepath.Join(tmpdir, "dir"),
+		StateDir: filepath.Join(tmpdir, "state"),
+	}
+	apply := func(expectCalls ...string) {
+		t.Helper()
+		systemctl.Reset()
+		if _, err := pl.Apply(ctx, opts); err != nil {
+			t.Fatal("apply failed:", err)
+		}
+		if calls := systemctl.Calls(); !reflect.DeepEqual(calls, expectCalls) {
+			t.Errorf("expected systemctl calls %q, got %q", expectCalls, calls)
+		}
+	}
+
+	apply("enable nginx.service", "start nginx.service")
+	apply()
+
+	testenv.WriteFile(t, filepath.Join(manifestDir, "templates", "site"), "server_name example.org;\n")
+	apply("reload nginx.service")
+
+	testenv.WriteFile(t, filepath.Join(manifestDir, "templates", "nginx.conf"), "worker_processes 2;\n")
+	apply("restart nginx.service")
+	apply()
+
+	systemctl.Unit("nginx.service").Active = false
+	apply("start nginx.service")
+
+	systemctl.Unit("nginx.service").Enabled = false
+	apply("enable nginx.service")
+	apply()
+}
@@ -0,0 +1,79 @@
+package planner
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jeffrom/polyester/testenv"
+)
+
+func TestOpTemplate(t *testing.T) {
+	testenv.RequireEnv(t, "TESTBIN")
+
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "template"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	ctx := testenv.Context()
+	opts := ApplyOpts{
+		DirRoot:       filepath.Join(tmpdir, "dir"),
+		StateDir:      filepath.Join(tmpdir, "state"),
+		IdentityPaths: []string{testenv.Path("testdata", "age.agent.key")},
+	}
+	pl := newPlanner(t, filepath.Join(tmpdir, "manifest"))
+	for i := 0; i < 2; i++ {
+		res, err := pl.Apply(ctx, opts)
+		if err != nil {
+			t.Fatal("apply failed:", err)
+		}
+		if changed := res.Changed(); i == 0 && !changed {
+			t.Error("expected first run to be changed")
+		} else if i != 0 && changed {
+			t.Errorf("expected run #%d not to be changed", i+1)
+		}
+	}
+
+	expectContains := func(name string, expected ...string) {
+		t.Helper()
+		got := testenv.ReadFile(t, filepath.Join(opts.DirRoot, "tmp", "test", "templates", name))
+		for _, s := range expected {
+			if !strings.Contains(got, s) {
+				t.Errorf("expected %s to contain %q, got:\n%s", name, s, got)
+			}
+		}
+	}
+	expectContains("cool", "secret: it's a real wow")
+	// the nice plan's secrets are merged with, and override, the manifest's.
+	expectContains("nice-cool",
+		"secret: it's nested and a real wow",
+		"another secret: i'm a file w/ an extension",
+	)
+
+	privatePath := filepath.Join(opts.DirRoot, "tmp", "test", "templates", "privatecool")
+	expectMode := func(expected fs.FileMode) {
+		t.Helper()
+		info, err := os.Stat(privatePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != expected {
+			t.Errorf("expected mode %s, got %s", expected, mode)
+		}
+	}
+	expectMode(0600)
+
+	// changing the mode of a destination makes the operation dirty again.
+	if err := os.Chmod(privatePath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := pl.Apply(ctx, opts)
+	if err != nil {
+		t.Fatal("apply failed:", err)
+	}
+	if !res.Changed() {
+		t.Error("expected apply to be changed after the mode was changed")
+	}
+	expectMode(0600)
+}
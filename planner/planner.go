@@ -11,6 +11,19 @@ type Planner struct {
 	rootDir  string
 	planFile string
 	planDir  string
+
+	// stateKey overrides the state directory key, which is otherwise derived
+	// from the manifest directory.
+	stateKey string
+	tmpDir   string
+
+	// compiledPlan is the path to a plan written by Compile. If set, plan
+	// scripts are not evaluated.
+	compiledPlan string
+
+	// Concurrency is the maximum number of plan scripts to evaluate at once
+	// when compiling. It defaults to the number of CPUs.
+	Concurrency int
 }
 
 func New(p string) (*Planner, error) {
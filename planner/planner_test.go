@@ -1,10 +1,16 @@
 package planner
 
 import (
-	"context"
+	"bytes"
+	"errors"
+	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/jeffrom/polyester/manifest"
+	"github.com/jeffrom/polyester/planner/execute"
 	"github.com/jeffrom/polyester/testenv"
 )
 
@@ -16,6 +22,11 @@ func TestPlanner(t *testing.T) {
 	testenv.RequireEnv(t, "TESTBIN")
 
 	t.Run("noop", testNoop)
+	t.Run("archive", testArchive)
+	t.Run("compiled", testCompiled)
+	t.Run("keep-going", testKeepGoing)
+	t.Run("diff", testDiff)
+	t.Run("drift", testDrift)
 }
 
 func testNoop(t *testing.T) {
@@ -27,7 +38,7 @@ func testNoop(t *testing.T) {
 		t.Fatal("expected planner not to be nil")
 	}
 
-	ctx := context.Background()
+	ctx := testenv.Context()
 	if err := pl.Check(ctx); err != nil {
 		t.Fatal("check failed", err)
 	}
@@ -55,6 +66,290 @@ func testNoop(t *testing.T) {
 	}
 }
 
+func testArchive(t *testing.T) {
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "noop"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	mani, err := manifest.LoadDir(filepath.Join(tmpdir, "manifest"))
+	if err != nil {
+		t.Fatal("load manifest failed:", err)
+	}
+	mani.Metadata = &manifest.Metadata{Name: "noop", Version: "0.1.0"}
+	archivePath, err := manifest.Save(mani, filepath.Join(tmpdir, "archive"))
+	if err != nil {
+		t.Fatal("save manifest failed:", err)
+	}
+
+	ctx := testenv.Context()
+	opts := ApplyOpts{
+		DirRoot:  filepath.Join(tmpdir, "dir"),
+		StateDir: filepath.Join(tmpdir, "state"),
+	}
+	for i := 0; i < 3; i++ {
+		pl, err := NewFromArchive(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := pl.Apply(ctx, opts)
+		if err != nil {
+			t.Fatal("apply failed", err)
+		}
+		if err := pl.Close(); err != nil {
+			t.Fatal("close failed", err)
+		}
+		if changed := res.Changed(); i == 0 && !changed {
+			t.Error("expected first run to be changed")
+		} else if i != 0 && changed {
+			t.Errorf("expected run #%d not to be changed", i+1)
+		}
+	}
+}
+
+func testCompiled(t *testing.T) {
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "noop"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	ctx := testenv.Context()
+	manifestDir := filepath.Join(tmpdir, "manifest")
+	planPath := filepath.Join(tmpdir, "plan.json")
+	f, err := os.Create(planPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newPlanner(t, manifestDir).Compile(ctx, f); err != nil {
+		t.Fatal("compile failed:", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := ApplyOpts{
+		DirRoot:  filepath.Join(tmpdir, "dir"),
+		StateDir: filepath.Join(tmpdir, "state"),
+	}
+	for i := 0; i < 3; i++ {
+		pl, err := NewFromPlanFile(planPath, manifestDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pl.Check(ctx); err != nil {
+			t.Fatal("check failed:", err)
+		}
+
+		res, err := pl.Apply(ctx, opts)
+		if err != nil {
+			t.Fatal("apply failed", err)
+		}
+		if changed := res.Changed(); i == 0 && !changed {
+			t.Error("expected first run to be changed")
+		} else if i != 0 && changed {
+			t.Errorf("expected run #%d not to be changed", i+1)
+		}
+	}
+
+	mainPath := filepath.Join(manifestDir, "polyester.sh")
+	testenv.WriteFile(t, mainPath, testenv.ReadFile(t, mainPath)+"polyester noop\n")
+	pl, err := NewFromPlanFile(planPath, manifestDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pl.Apply(ctx, opts)
+	if err == nil {
+		t.Fatal("expected apply to fail after the manifest changed")
+	}
+	if expect := "does not match the manifest in " + manifestDir + " "; !strings.Contains(err.Error(), expect) {
+		t.Errorf("expected error to contain %q, got %v", expect, err)
+	}
+}
+
+func testKeepGoing(t *testing.T) {
+	tcs := []struct {
+		name      string
+		keepGoing bool
+		status    execute.Status
+		results   map[string]string
+	}{
+		{
+			name:   "stop",
+			status: execute.StatusFailure,
+			results: map[string]string{
+				"broken": "failed",
+			},
+		},
+		{
+			name:      "keep-going",
+			keepGoing: true,
+			status:    execute.StatusPartialFailure,
+			results: map[string]string{
+				"broken":      "failed",
+				"dependent":   "skipped",
+				"independent": "ok",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "keep-going"))
+			defer testenv.RemoveOnSuccess(t, tmpdir)
+
+			pl := newPlanner(t, filepath.Join(tmpdir, "manifest"))
+			opts := ApplyOpts{
+				DirRoot:     filepath.Join(tmpdir, "dir"),
+				StateDir:    filepath.Join(tmpdir, "state"),
+				KeepGoing:   tc.keepGoing,
+				Concurrency: 1,
+			}
+			res, err := pl.Apply(testenv.Context(), opts)
+			if err == nil {
+				t.Fatal("expected apply to fail")
+			}
+			var failErr *execute.FailureError
+			if !errors.As(err, &failErr) {
+				t.Fatalf("expected *execute.FailureError, got %T: %v", err, err)
+			}
+			if failErr.Status != tc.status {
+				t.Errorf("expected status %s, got %s", tc.status, failErr.Status)
+			}
+			if len(failErr.Failures) != 1 {
+				t.Fatalf("expected 1 failure, got %d: %v", len(failErr.Failures), failErr)
+			}
+			if f := failErr.Failures[0]; f.Plan != "broken" || f.Operation != "sh" || f.Target == nil {
+				t.Errorf("expected sh operation in plan broken to fail, got %+v", f)
+			}
+
+			results := make(map[string]string)
+			for _, planRes := range res.Plans {
+				status := "ok"
+				if planRes.Error != nil {
+					status = "failed"
+				} else if planRes.SkippedBy != "" {
+					status = "skipped"
+				}
+				results[planRes.Name] = status
+			}
+			if !reflect.DeepEqual(results, tc.results) {
+				t.Errorf("expected results %v, got %v", tc.results, results)
+			}
+		})
+	}
+}
+
+func testDiff(t *testing.T) {
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "diff"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	ctx := testenv.Context()
+	manifestDir := filepath.Join(tmpdir, "manifest")
+	opts := ApplyOpts{
+		DirRoot:  filepath.Join(tmpdir, "dir"),
+		StateDir: filepath.Join(tmpdir, "state"),
+	}
+	diffOpts := opts
+	diffOpts.Diff = true
+	diff := func() string {
+		t.Helper()
+		res, err := newPlanner(t, manifestDir).Apply(ctx, diffOpts)
+		if err != nil {
+			t.Fatal("diff failed:", err)
+		}
+		buf := &bytes.Buffer{}
+		if err := res.WriteDiff(buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	expectContains := func(out string, expected ...string) {
+		t.Helper()
+		for _, s := range expected {
+			if !strings.Contains(out, s) {
+				t.Errorf("expected diff to contain %q, got:\n%s", s, out)
+			}
+		}
+	}
+
+	out := diff()
+	expectContains(out,
+		"no previous state",
+		"+++ b/tmp/test/diff/greeting",
+		"+hello world",
+	)
+	if _, err := os.Stat(filepath.Join(opts.DirRoot, "tmp", "test", "diff", "greeting")); err == nil {
+		t.Fatal("expected diff not to write the template")
+	}
+
+	if _, err := newPlanner(t, manifestDir).Apply(ctx, opts); err != nil {
+		t.Fatal("apply failed:", err)
+	}
+	if out := diff(); out != "no changes\n" {
+		t.Errorf("expected no changes after apply, got:\n%s", out)
+	}
+
+	varsPath := filepath.Join(manifestDir, "vars", "default.yaml")
+	testenv.WriteFile(t, varsPath, "greeting:\n  name: polyester\n")
+	out = diff()
+	expectContains(out,
+		"changed: ",
+		"-hello world",
+		"+hello polyester",
+		" unchanged",
+		"dirty because template is dirty",
+	)
+}
+
+func testDrift(t *testing.T) {
+	tmpdir := testenv.TempPlanDir(t, testenv.Path("testdata", "diff"))
+	defer testenv.RemoveOnSuccess(t, tmpdir)
+
+	ctx := testenv.Context()
+	manifestDir := filepath.Join(tmpdir, "manifest")
+	opts := ApplyOpts{
+		DirRoot:  filepath.Join(tmpdir, "dir"),
+		StateDir: filepath.Join(tmpdir, "state"),
+	}
+	driftOpts := opts
+	driftOpts.Drift = true
+	drift := func() (int, string) {
+		t.Helper()
+		res, err := newPlanner(t, manifestDir).Apply(ctx, driftOpts)
+		if err != nil {
+			t.Fatal("drift failed:", err)
+		}
+		buf := &bytes.Buffer{}
+		if err := res.WriteDrift(buf); err != nil {
+			t.Fatal(err)
+		}
+		return res.Drifted(), buf.String()
+	}
+
+	if n, out := drift(); n != 0 {
+		t.Errorf("expected no drift before the first apply, got:\n%s", out)
+	}
+	if _, err := newPlanner(t, manifestDir).Apply(ctx, opts); err != nil {
+		t.Fatal("apply failed:", err)
+	}
+	if n, out := drift(); n != 0 {
+		t.Errorf("expected no drift after apply, got:\n%s", out)
+	}
+
+	greetingPath := filepath.Join(opts.DirRoot, "tmp", "test", "diff", "greeting")
+	testenv.WriteFile(t, greetingPath, "hello world\nedited by hand\n")
+	n, out := drift()
+	if n != 1 {
+		t.Fatalf("expected 1 drifted file, got %d:\n%s", n, out)
+	}
+	for _, s := range []string{
+		"changed: checksum",
+		"-unchanged",
+		"+edited by hand",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected drift to contain %q, got:\n%s", s, out)
+		}
+	}
+}
+
 func newPlanner(t testing.TB, p string) *Planner {
 	t.Helper()
 	pl, err := New(p)
@@ -6,10 +6,14 @@ import (
 	"github.com/jeffrom/polyester/operator/templates"
 )
 
-func (r *Planner) setupTemplates(ctx context.Context) (*templates.Templates, error) {
+// setupTemplates loads the manifest's templates, once for every plan in the
+// apply. The age identities used to decrypt its secrets are read when the
+// first secret is decrypted.
+func (r *Planner) setupTemplates(ctx context.Context, opts ApplyOpts) (*templates.Templates, error) {
 	tmpl := templates.New(r.planDir)
 	if err := tmpl.Load(); err != nil {
 		return nil, err
 	}
+	tmpl.SetIdentityPaths(opts.IdentityPaths)
 	return tmpl, nil
 }
@@ -2,7 +2,12 @@ package state
 
 import (
 	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
 	"reflect"
+	"sort"
+	"time"
 
 	"github.com/jeffrom/polyester/operator/opfs"
 )
@@ -40,6 +45,9 @@ func (e Entry) Changed(oe Entry) bool {
 			// fmt.Println(sf.Info.Name(), "changed bc diff file info", sf.Info.IsDir(), of.Info.IsDir())
 			return true
 		}
+		if ownerChanged(sf.Info, of.Info) {
+			return true
+		}
 	}
 
 	if (e.KV == nil) != (oe.KV == nil) {
@@ -66,6 +74,103 @@ func (e Entry) Changed(oe Entry) bool {
 	return false
 }
 
+// Changes describes each difference between e and oe that Changed would
+// detect, such as a changed checksum, mode, modification time, owner, or KV
+// key.
+func (e Entry) Changes(oe Entry) []string {
+	var changes []string
+	if e.Name != oe.Name {
+		changes = append(changes, fmt.Sprintf("name %q -> %q", e.Name, oe.Name))
+	}
+
+	switch {
+	case e.File == nil && oe.File != nil:
+		changes = append(changes, "file added")
+	case e.File != nil && oe.File == nil:
+		changes = append(changes, "file removed")
+	case e.File != nil:
+		sf, of := e.File, oe.File
+		if !bytes.Equal(sf.SHA256, of.SHA256) {
+			changes = append(changes, fmt.Sprintf("checksum %s -> %s", shortSum(sf.SHA256), shortSum(of.SHA256)))
+		}
+		if (sf.Info == nil) != (of.Info == nil) {
+			changes = append(changes, "file info added or removed")
+		} else if sf.Info != nil {
+			if sf.Info.IsDir() != of.Info.IsDir() {
+				changes = append(changes, fmt.Sprintf("directory %v -> %v", sf.Info.IsDir(), of.Info.IsDir()))
+			}
+			if sf.Info.Mode() != of.Info.Mode() {
+				changes = append(changes, fmt.Sprintf("mode %s -> %s", sf.Info.Mode(), of.Info.Mode()))
+			}
+			if !sf.Info.ModTime().Equal(of.Info.ModTime()) {
+				changes = append(changes, fmt.Sprintf("mtime %s -> %s", fmtTime(sf.Info.ModTime()), fmtTime(of.Info.ModTime())))
+			}
+			if ownerChanged(sf.Info, of.Info) {
+				uid, gid, _ := opfs.Owner(sf.Info)
+				ouid, ogid, _ := opfs.Owner(of.Info)
+				changes = append(changes, fmt.Sprintf("uid/gid %d:%d -> %d:%d", uid, gid, ouid, ogid))
+			}
+		}
+	}
+
+	var keys []string
+	for k := range e.KV {
+		keys = append(keys, k)
+	}
+	for k := range oe.KV {
+		if _, ok := e.KV[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, ok := e.KV[k]
+		ov, ook := oe.KV[k]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("key %q added: %v", k, ov))
+		case !ook:
+			changes = append(changes, fmt.Sprintf("key %q removed", k))
+		case !reflect.DeepEqual(v, ov):
+			changes = append(changes, fmt.Sprintf("key %q: %v -> %v", k, v, ov))
+		}
+	}
+	if len(changes) == 0 && (e.KV == nil) != (oe.KV == nil) {
+		changes = append(changes, "kv added or removed")
+	}
+	return changes
+}
+
+// ownerChanged returns true if the files have different owners. Files whose
+// owner isn't known, such as those in state written before ownership was
+// tracked, are not considered changed.
+func ownerChanged(a, b fs.FileInfo) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	uid, gid, ok := opfs.Owner(a)
+	ouid, ogid, ook := opfs.Owner(b)
+	return ok && ook && (uid != ouid || gid != ogid)
+}
+
+func shortSum(sum []byte) string {
+	if len(sum) == 0 {
+		return "none"
+	}
+	h := hex.EncodeToString(sum)
+	if len(h) > 12 {
+		h = h[:12]
+	}
+	return h
+}
+
+func fmtTime(t time.Time) string {
+	if t.IsZero() {
+		return "none"
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
 func (e Entry) WithoutTimestamps() Entry {
 	file := e.File
 	if file != nil {
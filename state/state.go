@@ -128,6 +128,45 @@ func (s State) Changed(other State) bool {
 	return false
 }
 
+// Changes describes how each entry of s differs from the entry with the same
+// name in other. Each description is prefixed with the entry name.
+func (s State) Changes(other State) []string {
+	others := make(map[string]Entry, len(other.Entries))
+	for _, ent := range other.Entries {
+		others[ent.Name] = ent
+	}
+	seen := make(map[string]bool, len(s.Entries))
+
+	var changes []string
+	for _, ent := range s.Entries {
+		seen[ent.Name] = true
+		oent, ok := others[ent.Name]
+		if !ok {
+			changes = append(changes, ent.Name+": removed")
+			continue
+		}
+		for _, chg := range ent.Changes(oent) {
+			changes = append(changes, ent.Name+": "+chg)
+		}
+	}
+	for _, oent := range other.Entries {
+		if !seen[oent.Name] {
+			changes = append(changes, oent.Name+": added")
+		}
+	}
+	return changes
+}
+
+// Get returns the entry with the given name.
+func (s State) Get(name string) (Entry, bool) {
+	for _, ent := range s.Entries {
+		if ent.Name == name {
+			return ent, true
+		}
+	}
+	return Entry{}, false
+}
+
 func (s State) Map(fn func(e Entry) Entry) State {
 	res := make([]Entry, len(s.Entries))
 	for i, e := range s.Entries {
@@ -1,7 +1,10 @@
 package state
 
 import (
+	"reflect"
 	"testing"
+
+	"github.com/jeffrom/polyester/operator/opfs"
 )
 
 type KVI = map[string]interface{}
@@ -39,6 +42,30 @@ func TestStateChange(t *testing.T) {
 			b:            fromEntries(kviEntry("a", KVI{"attr": "true"})),
 			expectChange: true,
 		},
+		{
+			name:         "owner",
+			a:            fromEntries(ownerEntry("a", 0, 0)),
+			b:            fromEntries(ownerEntry("a", 1000, 0)),
+			expectChange: true,
+		},
+		{
+			name:         "group",
+			a:            fromEntries(ownerEntry("a", 0, 0)),
+			b:            fromEntries(ownerEntry("a", 0, 1000)),
+			expectChange: true,
+		},
+		{
+			name: "owner-same",
+			a:    fromEntries(ownerEntry("a", 1000, 1000)),
+			b:    fromEntries(ownerEntry("a", 1000, 1000)),
+		},
+		{
+			name: "owner-unknown",
+			a: fromEntries(Entry{Name: "a", File: &opfs.StateFileEntry{
+				Info: opfs.StateFileInfo{RawName: "a"},
+			}}),
+			b: fromEntries(ownerEntry("a", 1000, 1000)),
+		},
 	}
 
 	for _, tc := range tcs {
@@ -55,6 +82,12 @@ func TestStateChange(t *testing.T) {
 
 func kviEntry(name string, kvi KVI) Entry { return Entry{Name: name, KV: kvi} }
 
+func ownerEntry(name string, uid, gid uint32) Entry {
+	return Entry{Name: name, File: &opfs.StateFileEntry{
+		Info: opfs.StateFileInfo{RawName: name, RawUID: &uid, RawGID: &gid},
+	}}
+}
+
 func fromEntries(entries ...Entry) State { return State{Entries: entries} }
 
 // func fromString(t testing.TB, s string) State {
@@ -67,3 +100,59 @@ func fromEntries(entries ...Entry) State { return State{Entries: entries} }
 // 	}
 // 	return st
 // }
+
+func TestStateChanges(t *testing.T) {
+	tcs := []struct {
+		name   string
+		a      State
+		b      State
+		expect []string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "kv-same",
+			a:    fromEntries(kviEntry("a", KVI{"attr": true})),
+			b:    fromEntries(kviEntry("a", KVI{"attr": true})),
+		},
+		{
+			name: "kv-keys",
+			a:    fromEntries(kviEntry("a", KVI{"attr": true, "old": 1})),
+			b:    fromEntries(kviEntry("a", KVI{"attr": false, "new": 2})),
+			expect: []string{
+				`a: key "attr": true -> false`,
+				`a: key "new" added: 2`,
+				`a: key "old" removed`,
+			},
+		},
+		{
+			name:   "entries",
+			a:      fromEntries(kviEntry("a", nil), kviEntry("b", nil)),
+			b:      fromEntries(kviEntry("b", nil), kviEntry("c", nil)),
+			expect: []string{"a: removed", "c: added"},
+		},
+		{
+			name:   "owner",
+			a:      fromEntries(ownerEntry("a", 0, 0)),
+			b:      fromEntries(ownerEntry("a", 1000, 100)),
+			expect: []string{"a: uid/gid 0:0 -> 1000:100"},
+		},
+		{
+			name: "owner-unknown",
+			a: fromEntries(Entry{Name: "a", File: &opfs.StateFileEntry{
+				Info: opfs.StateFileInfo{RawName: "a"},
+			}}),
+			b: fromEntries(ownerEntry("a", 1000, 1000)),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			changes := tc.a.Changes(tc.b)
+			if !reflect.DeepEqual(changes, tc.expect) {
+				t.Errorf("expected changes %q, got %q", tc.expect, changes)
+			}
+		})
+	}
+}
@@ -18,18 +18,17 @@ func NewPrefixWriter(w io.Writer, prefix string) *PrefixWriter {
 
 func (w *PrefixWriter) Write(p []byte) (int, error) {
 	s := bufio.NewScanner(bytes.NewReader(p))
-	total := 0
 	for s.Scan() {
 		line := s.Text()
 		res := fmt.Sprintf("%20s |  %s\n", w.prefix, line)
-		n, err := w.w.Write([]byte(res))
-		total += n
-		if err != nil {
-			return total, err
+		if _, err := w.w.Write([]byte(res)); err != nil {
+			return 0, err
 		}
 	}
 	if err := s.Err(); err != nil {
-		return total, nil
+		return 0, err
 	}
-	return total, nil
+	// report the number of bytes consumed, not written, so callers such as
+	// io.Copy don't treat the prefixed output as a short write.
+	return len(p), nil
 }
@@ -42,9 +42,21 @@ func (o StdIO) Stderr() io.Writer {
 	return os.Stderr
 }
 
+// WithScope returns a copy of o with its scope set to scopes. The copy can be
+// used concurrently with o.
 func (o *StdIO) WithScope(scopes ...string) *StdIO {
-	o.scopes = scopes
-	return o
+	c := *o
+	c.scopes = scopes
+	return &c
+}
+
+// WithOutput returns a copy of o that writes standard output to out and
+// standard error to errw.
+func (o *StdIO) WithOutput(out, errw io.Writer) *StdIO {
+	c := *o
+	c.Out = out
+	c.Err = errw
+	return &c
 }
 
 func (o *StdIO) AppendScope(scopes ...string) *StdIO {
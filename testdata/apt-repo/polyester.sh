@@ -0,0 +1,5 @@
+#!/bin/sh
+set -eu
+
+P apt-repo --key example.asc --arch amd64 example https://deb.example.com/debian bullseye main contrib
+P apt-repo --absent old
@@ -0,0 +1,7 @@
+#!/bin/sh
+set -eu
+
+user=$(id -un)
+
+P authorized-key --option no-pty "$user" "ssh-ed25519 a2V5LWE= alice@laptop"
+P authorized-key --key-file deploy.pub "$user"
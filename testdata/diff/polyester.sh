@@ -0,0 +1,9 @@
+#!/bin/sh
+set -eu
+
+testdir=/tmp/test/diff
+
+P mkdir $testdir
+
+P template greeting $testdir/greeting
+P touch $testdir/after
@@ -0,0 +1,10 @@
+#!/bin/sh
+set -eu
+
+testdir=/tmp/test/handlers
+
+P mkdir $testdir
+P handler reload sh --dir $testdir "echo reloaded >> handled"
+P template --notify reload greeting $testdir/greeting
+P template --notify reload greeting $testdir/greeting2
+P touch $testdir/untracked
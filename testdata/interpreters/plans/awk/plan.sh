@@ -0,0 +1,5 @@
+#!/usr/bin/awk -f
+# writes intermediate plan entries to fd 3 without polyester.
+BEGIN {
+	print "name: touch\nargs:\n  path: /tmp/polyester-awk\n---" > "/dev/fd/3"
+}
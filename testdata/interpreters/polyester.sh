@@ -0,0 +1,10 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+testdir=/tmp/polyester-interpreters
+files=(one two)
+for f in "${files[@]}"; do
+	[[ -n "$f" ]] && P touch "$testdir/$f"
+done
+
+P plan awk
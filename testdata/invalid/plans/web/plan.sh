@@ -0,0 +1,7 @@
+#!/bin/sh
+set -e
+
+repo=example
+
+P apt-repo --key "$repo.asc" --key-url https://example.com/key.asc \
+	"$repo/web" https://example.com/apt
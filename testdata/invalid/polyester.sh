@@ -0,0 +1,10 @@
+#!/bin/sh
+set -e
+
+unit=app
+
+P plan web
+P systemd "$unit"
+P line --insert-after a --insert-before b "/etc/$unit.conf"
+P template missing.conf /etc/app.conf
+P apt-repo bad/name https://example.com/apt stable
@@ -0,0 +1,4 @@
+#!/bin/sh
+set -eu
+
+polyester sh --target broken 'exit 1'
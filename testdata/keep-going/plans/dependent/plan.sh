@@ -0,0 +1,6 @@
+#!/bin/sh
+set -eu
+
+polyester dependency broken
+
+polyester touch /tmp/dependent
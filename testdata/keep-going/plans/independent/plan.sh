@@ -0,0 +1,4 @@
+#!/bin/sh
+set -eu
+
+polyester touch /tmp/independent
@@ -0,0 +1,4 @@
+#!/bin/sh
+set -eu
+
+polyester plan broken dependent independent
@@ -0,0 +1,10 @@
+#!/bin/sh
+set -eu
+
+testdir=/tmp/test/line
+
+P mkdir $testdir
+P line --create --regexp '^vm\.swappiness' $testdir/sysctl.conf "vm.swappiness = 10"
+P line --insert-before '^vm\.' $testdir/sysctl.conf "net.ipv4.ip_forward = 1"
+P line --block --marker sshd $testdir/sysctl.conf "kernel.panic = 10
+kernel.panic_on_oops = 1"
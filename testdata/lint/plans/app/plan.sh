@@ -0,0 +1,7 @@
+#!/bin/sh
+set -e
+
+P pcopy app.conf 'missing/*.conf' /etc/app/
+P template greeting /etc/app/greeting
+P template app.service /etc/systemd/system/app.service
+P apt-repo --key app.asc app https://example.com/apt stable main
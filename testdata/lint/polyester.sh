@@ -0,0 +1,16 @@
+#!/bin/sh
+set -e
+
+P touch --nope greeting
+P frobnicate greeting
+P plan app missing
+P dependency nothere
+P template greeting /tmp/greeting
+P template missing.conf /tmp/missing.conf
+P handler notice sh "echo changed"
+P handler broken nope
+
+if [ -n "$HOME" ]; then
+	P mkdir
+fi
+P touch "$HOME/unchecked"
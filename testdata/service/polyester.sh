@@ -0,0 +1,6 @@
+#!/bin/sh
+set -eu
+
+P mkdir /tmp/test/service
+P template app.conf /tmp/test/service/app.conf
+P service --unit-template app.service --env-secret DB_PASSWORD=db/password app
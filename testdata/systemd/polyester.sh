@@ -0,0 +1,9 @@
+#!/bin/sh
+set -eu
+
+testdir=/tmp/test/systemd
+
+P mkdir $testdir
+P template nginx.conf $testdir/nginx.conf
+P template site $testdir/site
+P systemd --enabled --state running --restart-on "$testdir/*.conf" --reload-on $testdir/site nginx
@@ -12,5 +12,6 @@ P template cool $testdir/cool2
 P template \
     --data extra.yaml \
     cool $testdir/extracool
+P template --mode 0600 cool $testdir/privatecool
 
 # ls -alF /src/testdata/template/plans/nice/secrets/
@@ -1,4 +1,7 @@
 #!/bin/sh
 set -eu
 
-polyester useradd --create-home --shell /bin/sh cooluser
+polyester groupadd --system coolgroup
+polyester useradd --create-home --shell /bin/sh --add-group coolgroup cooluser
+polyester userdel olduser
+polyester authorized-key cooluser "ssh-ed25519 a2V5LWE= alice@laptop"
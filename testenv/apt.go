@@ -0,0 +1,209 @@
+package testenv
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Apt is an in-memory fake of apt and dpkg-query. Its Command method can be
+// passed to executil.SetCommand. Other commands are run normally.
+type Apt struct {
+	mu sync.Mutex
+	// available are the versions of each package that can be installed,
+	// oldest first.
+	available map[string][]string
+	packages  map[string]*FakePackage
+	calls     [][]string
+}
+
+// FakePackage is a package in a fake dpkg database.
+type FakePackage struct {
+	Version string
+	// Status is installed, or config-files if the package was removed but
+	// its configuration files were kept.
+	Status string
+}
+
+// NewApt returns a fake apt with no available or installed packages.
+func NewApt() *Apt {
+	return &Apt{
+		available: make(map[string][]string),
+		packages:  make(map[string]*FakePackage),
+	}
+}
+
+// Available makes versions of a package available to install. The last
+// version is installed when none is requested.
+func (a *Apt) Available(name string, versions ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.available[name] = append(a.available[name], versions...)
+}
+
+// Install installs a package as if it was installed outside of polyester.
+func (a *Apt) Install(name, version string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.packages[name] = &FakePackage{Version: version, Status: "installed"}
+}
+
+// Package returns the package from the dpkg database, or nil if it isn't
+// known.
+func (a *Apt) Package(name string) *FakePackage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	pkg, ok := a.packages[name]
+	if !ok {
+		return nil
+	}
+	cp := *pkg
+	return &cp
+}
+
+// Calls returns the arguments of each apt call, without flags, such as
+// "install git". dpkg-query calls aren't included.
+func (a *Apt) Calls() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var res []string
+	for _, call := range a.calls {
+		res = append(res, strings.Join(call, " "))
+	}
+	return res
+}
+
+// Reset clears the recorded calls.
+func (a *Apt) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = nil
+}
+
+// Command runs apt, apt-get and dpkg-query against the fake.
+func (a *Apt) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	switch name {
+	case "dpkg-query":
+		return a.dpkgQuery(ctx, args)
+	case "apt", "apt-get":
+	default:
+		return exec.CommandContext(ctx, name, args...)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var rest []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) == 0 {
+		return fakeExit(ctx, "", "E: Invalid operation\n", 100)
+	}
+	a.calls = append(a.calls, rest)
+
+	verb, pkgs := rest[0], rest[1:]
+	switch verb {
+	case "update":
+		return fakeOutput(ctx, "")
+	case "install":
+		return a.install(ctx, pkgs)
+	case "remove", "purge":
+		for _, name := range pkgs {
+			if _, ok := a.packages[name]; !ok && len(a.available[name]) == 0 {
+				return fakeExit(ctx, "", fmt.Sprintf("E: Unable to locate package %s\n", name), 100)
+			}
+		}
+		for _, name := range pkgs {
+			pkg, ok := a.packages[name]
+			if !ok {
+				continue
+			}
+			if verb == "purge" {
+				delete(a.packages, name)
+			} else if pkg.Status == "installed" {
+				pkg.Status = "config-files"
+			}
+		}
+		return fakeOutput(ctx, "")
+	}
+	return fakeExit(ctx, "", fmt.Sprintf("E: Invalid operation %s\n", verb), 100)
+}
+
+// install installs pkgs, in the form name or name=version. Like apt, nothing
+// is installed if any of the packages can't be.
+func (a *Apt) install(ctx context.Context, pkgs []string) *exec.Cmd {
+	next := make(map[string]string)
+	for _, arg := range pkgs {
+		parts := strings.SplitN(arg, "=", 2)
+		name := parts[0]
+		versions := a.available[name]
+		if len(versions) == 0 {
+			return fakeExit(ctx, "", fmt.Sprintf("E: Unable to locate package %s\n", name), 100)
+		}
+		version := versions[len(versions)-1]
+		if len(parts) > 1 {
+			version = parts[1]
+			found := false
+			for _, v := range versions {
+				found = found || v == version
+			}
+			if !found {
+				return fakeExit(ctx, "", fmt.Sprintf("E: Version '%s' for '%s' was not found\n", version, name), 100)
+			}
+		}
+		next[name] = version
+	}
+	for name, version := range next {
+		a.packages[name] = &FakePackage{Version: version, Status: "installed"}
+	}
+	return fakeOutput(ctx, "")
+}
+
+// dpkgQuery supports dpkg-query -W, with a format of ${binary:Package},
+// ${Version} and ${db:Status-Status} fields.
+func (a *Apt) dpkgQuery(ctx context.Context, args []string) *exec.Cmd {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	format := "${binary:Package}\t${Version}\n"
+	var names []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-f", "--showformat":
+			i++
+			if i < len(args) {
+				format = args[i]
+			}
+		case "-W", "--show":
+		default:
+			names = append(names, args[i])
+		}
+	}
+
+	out, errs := &strings.Builder{}, &strings.Builder{}
+	code := 0
+	for _, name := range names {
+		pkg, ok := a.packages[name]
+		if !ok {
+			fmt.Fprintf(errs, "dpkg-query: no packages found matching %s\n", name)
+			code = 1
+			continue
+		}
+		r := strings.NewReplacer(
+			"${binary:Package}", name,
+			"${Version}", pkg.Version,
+			"${db:Status-Status}", pkg.Status,
+			`\n`, "\n",
+		)
+		out.WriteString(r.Replace(format))
+	}
+	return fakeExit(ctx, out.String(), errs.String(), code)
+}
+
+func fakeExit(ctx context.Context, stdout, stderr string, code int) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", `printf '%s' "$1"; printf '%s' "$2" >&2; exit "$3"`, "sh", stdout, stderr, fmt.Sprint(code))
+}
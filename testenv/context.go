@@ -0,0 +1,13 @@
+package testenv
+
+import (
+	"context"
+
+	"github.com/jeffrom/polyester/stdio"
+)
+
+// Context returns a background context with a default stdio attached, which
+// most of polyester expects to be present.
+func Context() context.Context {
+	return stdio.SetContext(context.Background(), &stdio.StdIO{})
+}
@@ -0,0 +1,155 @@
+package testenv
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Systemctl is an in-memory fake of systemctl. Its Command method can be
+// passed to executil.SetCommand. Other commands are run normally.
+type Systemctl struct {
+	mu    sync.Mutex
+	units map[string]*FakeUnit
+	calls [][]string
+}
+
+// FakeUnit is the status of a unit in a fake systemctl.
+type FakeUnit struct {
+	Active  bool
+	Enabled bool
+	// Restarts counts restarts, including try-restarts of active units.
+	Restarts int
+	// Reloads counts reloads.
+	Reloads int
+}
+
+// NewSystemctl returns a fake systemctl with no units.
+func NewSystemctl() *Systemctl {
+	return &Systemctl{units: make(map[string]*FakeUnit)}
+}
+
+// Unit returns the status of unit, adding it if it doesn't exist.
+func (s *Systemctl) Unit(name string) *FakeUnit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unit(name)
+}
+
+func (s *Systemctl) unit(name string) *FakeUnit {
+	u, ok := s.units[name]
+	if !ok {
+		u = &FakeUnit{}
+		s.units[name] = u
+	}
+	return u
+}
+
+// Calls returns the arguments of each systemctl call that changed a unit,
+// such as "start foo.service". show calls aren't included.
+func (s *Systemctl) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []string
+	for _, call := range s.calls {
+		res = append(res, strings.Join(call, " "))
+	}
+	return res
+}
+
+// Reset clears the recorded calls.
+func (s *Systemctl) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+// Command runs systemctl against the fake.
+func (s *Systemctl) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if name != "systemctl" {
+		return exec.CommandContext(ctx, name, args...)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var flags, rest []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			flags = append(flags, arg)
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) == 0 {
+		return fakeFailure(ctx, "systemctl: no command given")
+	}
+	verb, units := rest[0], rest[1:]
+	if verb != "show" {
+		s.calls = append(s.calls, rest)
+	}
+
+	switch verb {
+	case "daemon-reload":
+		return fakeOutput(ctx, "")
+	case "show":
+		buf := &strings.Builder{}
+		for _, name := range units {
+			u := s.unit(name)
+			active, enabled := "inactive", "disabled"
+			if u.Active {
+				active = "active"
+			}
+			if u.Enabled {
+				enabled = "enabled"
+			}
+			fmt.Fprintf(buf, "Id=%s\nLoadState=loaded\nActiveState=%s\nUnitFileState=%s\n\n", name, active, enabled)
+		}
+		return fakeOutput(ctx, buf.String())
+	}
+
+	for _, name := range units {
+		u := s.unit(name)
+		switch verb {
+		case "start":
+			u.Active = true
+		case "stop":
+			u.Active = false
+		case "restart":
+			u.Active = true
+			u.Restarts++
+		case "try-restart":
+			if u.Active {
+				u.Restarts++
+			}
+		case "reload":
+			if !u.Active {
+				return fakeFailure(ctx, "Failed to reload "+name+": unit is not active.")
+			}
+			u.Reloads++
+		case "enable":
+			u.Enabled = true
+		case "disable":
+			u.Enabled = false
+		default:
+			return fakeFailure(ctx, "systemctl: unknown command "+verb)
+		}
+		for _, flag := range flags {
+			if flag == "--now" && verb == "enable" {
+				u.Active = true
+			} else if flag == "--now" && verb == "disable" {
+				u.Active = false
+			}
+		}
+	}
+	return fakeOutput(ctx, "")
+}
+
+func fakeOutput(ctx context.Context, out string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", `printf '%s' "$1"`, "sh", out)
+}
+
+func fakeFailure(ctx context.Context, msg string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", `printf '%s\n' "$1" >&2; exit 1`, "sh", msg)
+}